@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"os"
 	"time"
 
 	gpt "github.com/TonyDMorris/quick-function/pkg/gpt/client"
+	"github.com/TonyDMorris/quick-function/pkg/lease"
 	"github.com/TonyDMorris/quick-function/pkg/logging"
+	"github.com/TonyDMorris/quick-function/pkg/normalise"
+	"github.com/TonyDMorris/quick-function/pkg/queue"
+	"github.com/TonyDMorris/quick-function/pkg/retry"
+	runModels "github.com/TonyDMorris/quick-function/pkg/runs/models"
+	runStore "github.com/TonyDMorris/quick-function/pkg/runs/store"
+	"github.com/TonyDMorris/quick-function/pkg/selection"
 	strapi "github.com/TonyDMorris/quick-function/pkg/strapi/client"
 	"github.com/TonyDMorris/quick-function/pkg/strapi/models"
 	"github.com/TonyDMorris/quick-function/service/app"
@@ -21,9 +29,50 @@ import (
 type Config struct {
 	RSA           string `env:"RSA,required"`
 	AppID         int64  `env:"GITHUB_APP_ID,required"`
-	ChatGPTAPIKey string `env:"CHAT_GPT_API_KEY,required"`
+	ChatGPTAPIKey string `env:"CHAT_GPT_API_KEY"`
+	LLMProvider   string `env:"LLM_PROVIDER" envDefault:"openai"`
+	LLMBaseURL    string `env:"LLM_BASE_URL"`
+	LLMModel      string `env:"LLM_MODEL"`
+	LLMAuthHeader string `env:"LLM_AUTH_HEADER"`
+	LLMAPIVersion string `env:"LLM_API_VERSION"`
 	StrapiAPIKey  string `env:"STRAPI_API_KEY,required"`
 	StrapiBaseURL string `env:"STRAPI_BASE_URL,required"`
+	RunsPath      string `env:"RUNS_PATH" envDefault:"runs.json"`
+
+	QueuePath              string        `env:"QUEUE_PATH" envDefault:"queue.json"`
+	QueueCapacity          int           `env:"QUEUE_CAPACITY" envDefault:"1000"`
+	QueueVisibilityTimeout time.Duration `env:"QUEUE_VISIBILITY_TIMEOUT" envDefault:"30m"`
+
+	RetryMaxAttempts int           `env:"RETRY_MAX_ATTEMPTS" envDefault:"5"`
+	RetryBaseDelay   time.Duration `env:"RETRY_BASE_DELAY" envDefault:"30s"`
+	RetryMaxDelay    time.Duration `env:"RETRY_MAX_DELAY" envDefault:"30m"`
+
+	JobTimeout      time.Duration `env:"JOB_TIMEOUT" envDefault:"30m"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"2m"`
+
+	ReplicaID            string        `env:"REPLICA_ID"`
+	LeasePath            string        `env:"LEASE_PATH"`
+	LeaderLeaseTTL       time.Duration `env:"LEADER_LEASE_TTL" envDefault:"1m"`
+	CatchUpPolicy        string        `env:"CATCH_UP_POLICY" envDefault:"once"`
+	ScheduleSyncInterval time.Duration `env:"SCHEDULE_SYNC_INTERVAL" envDefault:"5m"`
+
+	GitHubWebhookSecret string `env:"GITHUB_WEBHOOK_SECRET"`
+
+	StrapiWebhookSecret        string        `env:"STRAPI_WEBHOOK_SECRET"`
+	StrapiWebhookHeader        string        `env:"STRAPI_WEBHOOK_HEADER" envDefault:"X-Strapi-Webhook-Secret"`
+	StrapiWebhookSigningSecret string        `env:"STRAPI_WEBHOOK_SIGNING_SECRET"`
+	StrapiWebhookTolerance     time.Duration `env:"STRAPI_WEBHOOK_TOLERANCE" envDefault:"5m"`
+
+	GitHubRateLimitMaxWait time.Duration `env:"GITHUB_RATE_LIMIT_MAX_WAIT" envDefault:"1m"`
+	ContentSource          string        `env:"CONTENT_SOURCE" envDefault:"blobs"`
+
+	NormaliseStripComments        bool `env:"NORMALISE_STRIP_COMMENTS" envDefault:"true"`
+	NormaliseRemoveLicenseHeaders bool `env:"NORMALISE_REMOVE_LICENSE_HEADERS" envDefault:"true"`
+	NormaliseMinify               bool `env:"NORMALISE_MINIFY" envDefault:"true"`
+
+	SelectionMaxFiles    int  `env:"SELECTION_MAX_FILES" envDefault:"10"`
+	SelectionMaxFileSize int  `env:"SELECTION_MAX_FILE_SIZE" envDefault:"102400"`
+	SelectionRerank      bool `env:"SELECTION_RERANK" envDefault:"false"`
 }
 
 func main() {
@@ -52,16 +101,91 @@ func main() {
 		Transport: itr,
 	})
 
-	gptClient := gpt.NewChatClient(config.ChatGPTAPIKey)
+	gptClient, err := gpt.NewProvider(gpt.ProviderConfig{
+		Provider:   config.LLMProvider,
+		APIKey:     config.ChatGPTAPIKey,
+		BaseURL:    config.LLMBaseURL,
+		Model:      config.LLMModel,
+		AuthHeader: config.LLMAuthHeader,
+		APIVersion: config.LLMAPIVersion,
+	})
+	if err != nil {
+		logging.Logger.Error(err.Error())
+		os.Exit(1)
+	}
 
 	strapiClient := strapi.NewClient(config.StrapiAPIKey, config.StrapiBaseURL)
 
-	app := app.NewApi(
-		app.Config{
-			Port: 8080,
+	runs, err := runStore.NewFileStore(config.RunsPath)
+	if err != nil {
+		logging.Logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	queueOptions := queue.Options{
+		Capacity:          config.QueueCapacity,
+		VisibilityTimeout: config.QueueVisibilityTimeout,
+	}
+	var jobs queue.Queue = queue.NewMemoryQueue(queueOptions)
+	if config.QueuePath != "" {
+		jobs, err = queue.NewFileQueue(config.QueuePath, queueOptions)
+		if err != nil {
+			logging.Logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// replicas share leases through a file on a common volume, without one each replica leads itself
+	var locks lease.Locker = lease.NewMemoryLocker()
+	if config.LeasePath != "" {
+		locks = lease.NewFileLocker(config.LeasePath)
+	}
+
+	appConfig := app.Config{
+		Port: 8080,
+		Normalise: normalise.Options{
+			StripComments:        config.NormaliseStripComments,
+			RemoveLicenseHeaders: config.NormaliseRemoveLicenseHeaders,
+			Minify:               config.NormaliseMinify,
+		},
+		Selection: selection.Options{
+			MaxFiles:    config.SelectionMaxFiles,
+			MaxFileSize: config.SelectionMaxFileSize,
 		},
+		RerankFiles:         config.SelectionRerank,
+		GitHubWebhookSecret: config.GitHubWebhookSecret,
+		StrapiWebhook: app.StrapiWebhookConfig{
+			Secret:        config.StrapiWebhookSecret,
+			Header:        config.StrapiWebhookHeader,
+			SigningSecret: config.StrapiWebhookSigningSecret,
+			Tolerance:     config.StrapiWebhookTolerance,
+		},
+		RateLimitMaxWait: config.GitHubRateLimitMaxWait,
+		ContentSource:    config.ContentSource,
+		Retry: retry.Policy{
+			MaxAttempts: config.RetryMaxAttempts,
+			BaseDelay:   config.RetryBaseDelay,
+			MaxDelay:    config.RetryMaxDelay,
+		},
+		JobTimeout:           config.JobTimeout,
+		ShutdownTimeout:      config.ShutdownTimeout,
+		ReplicaID:            config.ReplicaID,
+		LeaderLeaseTTL:       config.LeaderLeaseTTL,
+		CatchUp:              config.CatchUpPolicy,
+		ScheduleSyncInterval: config.ScheduleSyncInterval,
+	}
+	if err := appConfig.Validate(); err != nil {
+		logging.Logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	app := app.NewApi(
+		appConfig,
 		client, gptClient,
 		strapiClient,
+		runs,
+		jobs,
+		locks,
 	)
 
 	lastGen := time.Now().Add(-time.Hour * 24 * 7 * 4)
@@ -84,7 +208,7 @@ func main() {
 		LastGeneration: &lastGen,
 	}
 
-	err = app.HandleRepositoryConfigurationScheduledJob(job)
+	err = app.HandleRepositoryConfigurationScheduledJob(context.Background(), job, &runModels.Run{ID: "test"})
 	if err != nil {
 		logging.Logger.Error(err.Error())
 		os.Exit(1)
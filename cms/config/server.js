@@ -8,5 +8,8 @@ module.exports = ({ env }) => ({
   },
   webhooks: {
     populateRelations: env.bool("WEBHOOKS_POPULATE_RELATIONS", false),
+    defaultHeaders: env("WEBHOOK_SECRET")
+      ? { "X-Strapi-Webhook-Secret": env("WEBHOOK_SECRET") }
+      : {},
   },
 });
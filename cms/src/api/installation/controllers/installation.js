@@ -23,5 +23,135 @@ module.exports = createCoreController(
 
       // some more custom logic
     },
+
+    async internalSync(ctx) {
+      const {
+        installation_id,
+        username,
+        repositories_added = [],
+        repositories_removed = [],
+      } = ctx.request.body;
+
+      if (!installation_id) {
+        return ctx.badRequest("installation_id is required");
+      }
+
+      const addedIDs = [];
+      for (const repo of repositories_added) {
+        const existing = await strapi.entityService
+          .findMany("api::repository.repository", {
+            filters: { repository_id: repo.repository_id },
+          })
+          .catch((err) => {
+            console.log(err);
+            throw err;
+          });
+
+        if (existing.length > 0) {
+          await strapi.entityService.update(
+            "api::repository.repository",
+            existing[0].id,
+            {
+              data: {
+                name: repo.name,
+                full_name: repo.full_name,
+                private: repo.private,
+              },
+            }
+          );
+          addedIDs.push(existing[0].id);
+          continue;
+        }
+
+        const created = await strapi.entityService.create(
+          "api::repository.repository",
+          {
+            data: {
+              name: repo.name,
+              full_name: repo.full_name,
+              private: repo.private,
+              repository_id: repo.repository_id,
+            },
+          }
+        );
+        addedIDs.push(created.id);
+      }
+
+      const removedRepositoryIDs = repositories_removed.map(
+        (repo) => repo.repository_id
+      );
+
+      const existingInstallations = await strapi.entityService
+        .findMany("api::installation.installation", {
+          filters: { installation_id },
+          populate: ["repositories"],
+        })
+        .catch((err) => {
+          console.log(err);
+          throw err;
+        });
+
+      if (existingInstallations.length === 0) {
+        return await strapi.entityService.create(
+          "api::installation.installation",
+          {
+            data: {
+              installation_id,
+              username,
+              repositories: addedIDs,
+            },
+            populate: ["repositories"],
+          }
+        );
+      }
+
+      const installation = existingInstallations[0];
+      const repositoryIDs = [
+        ...installation.repositories
+          .filter(
+            (repo) =>
+              !removedRepositoryIDs.includes(repo.repository_id) &&
+              !addedIDs.includes(repo.id)
+          )
+          .map((repo) => repo.id),
+        ...addedIDs,
+      ];
+
+      return await strapi.entityService.update(
+        "api::installation.installation",
+        installation.id,
+        {
+          data: {
+            username: username || installation.username,
+            repositories: repositoryIDs,
+          },
+          populate: ["repositories"],
+        }
+      );
+    },
+
+    async internalDelete(ctx) {
+      const { installation_id } = ctx.params;
+
+      const existingInstallations = await strapi.entityService
+        .findMany("api::installation.installation", {
+          filters: { installation_id },
+        })
+        .catch((err) => {
+          console.log(err);
+          throw err;
+        });
+
+      if (existingInstallations.length === 0) {
+        return { success: true };
+      }
+
+      await strapi.entityService.delete(
+        "api::installation.installation",
+        existingInstallations[0].id
+      );
+
+      return { success: true };
+    },
   })
 );
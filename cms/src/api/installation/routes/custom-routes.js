@@ -0,0 +1,24 @@
+"use strict";
+
+module.exports = {
+  routes: [
+    {
+      method: "POST",
+      path: "/internal/installations/sync",
+      handler: "installation.internalSync",
+      config: {
+        policies: [],
+        middlewares: [],
+      },
+    },
+    {
+      method: "DELETE",
+      path: "/internal/installations/:installation_id",
+      handler: "installation.internalDelete",
+      config: {
+        policies: [],
+        middlewares: [],
+      },
+    },
+  ],
+};
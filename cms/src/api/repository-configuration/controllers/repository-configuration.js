@@ -196,10 +196,7 @@ module.exports = createCoreController(
         });
 
       if (!repositoryConfiguration) {
-        return {
-          success: false,
-          message: "Repository configuration not found",
-        };
+        return ctx.notFound("Repository configuration not found");
       }
 
       return repositoryConfiguration;
@@ -234,10 +231,7 @@ module.exports = createCoreController(
         });
 
       if (!repositoryConfiguration) {
-        return {
-          success: false,
-          message: "Repository configuration not found",
-        };
+        return ctx.notFound("Repository configuration not found");
       }
 
       return repositoryConfiguration;
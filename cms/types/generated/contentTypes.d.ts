@@ -812,6 +812,40 @@ export interface ApiRepositoryConfigurationRepositoryConfiguration
     >;
     cron: Attribute.String;
     next_generation: Attribute.DateTime;
+    model: Attribute.String;
+    temperature: Attribute.Decimal &
+      Attribute.SetMinMax<{
+        min: 0;
+        max: 2;
+      }>;
+    top_p: Attribute.Decimal &
+      Attribute.SetMinMax<{
+        min: 0;
+        max: 1;
+      }>;
+    max_tokens: Attribute.Integer &
+      Attribute.SetMinMax<{
+        min: 1;
+      }>;
+    token_budget: Attribute.Integer &
+      Attribute.SetMinMax<{
+        min: 1;
+      }>;
+    trigger: Attribute.Enumeration<['schedule', 'push']> &
+      Attribute.DefaultTo<'schedule'>;
+    push_quiet_minutes: Attribute.Integer &
+      Attribute.SetMinMax<{
+        min: 0;
+      }> &
+      Attribute.DefaultTo<30>;
+    push_commit_threshold: Attribute.Integer &
+      Attribute.SetMinMax<{
+        min: 0;
+      }> &
+      Attribute.DefaultTo<0>;
+    release_notes: Attribute.Enumeration<['post', 'release']>;
+    branch: Attribute.String;
+    paths: Attribute.JSON;
     createdAt: Attribute.DateTime;
     updatedAt: Attribute.DateTime;
     createdBy: Attribute.Relation<
@@ -5,6 +5,7 @@ const (
 	I will give a list of files from a github repository.
 	and a repository name.
 	The format will be {path_to_file}:{size}
+	The rest of the repository may follow as directory summaries in the format {directory}/ ({count} files, {size} bytes), these are for context and cannot be selected.
 	Tell me which files would be the most useful to send for you to get a good idea of the project.
 	Select the fewest possible number of files that would give you a good idea of the project.
 	ONLY SELECT FILES WITH AN EXTENSION THAT YOU CAN READ AND TYPICALLY DO NOT CONTAIN VERBOSE DATA.
@@ -15,16 +16,54 @@ const (
 	InterestedFilesInput = `
 	REPOSITORY NAME : %s
 	%s
+	OTHER DIRECTORIES :
+	%s
 	`
 
 	ContentMessage = `
 	I will Give you a series of filenames and excerpts of the contents of those files.
-	followed by a repository name.
+	followed by an outline of the files in the repository in the format {path_to_file}:{size}, where the rest of the repository may be summarised as {directory}/ ({count} files, {size} bytes).
 	Provide me a synopsis of the project in the style of a readme.
 	You should not appear to be guessing , speak with authority it does not matter if you are incorrect do not say what your assertions are based on or reference anything you used to generate the opion, simply speak as if you understand the purpose of this repository.
 	MY CLIENTS HAVE MAJOR DISABILITIES AND IT IS A STRAIN FOR THEM TO REPROCESS THIS REQUEST PLEASE FOLLOW THE INSTRUCTIONS.
 	Return the sysnopis in the form of a markdown blog post with appropriate title, formatting and some emojis.
 	DO NOT RETURN ANY ADDITIONAL COMMENTARY OR GRAMMER ONLY THE SYNOPSIS.
 	%s
+	REPOSITORY OUTLINE :
+	%s
+	`
+
+	ChangesMessage = `
+	I will give you a repository name, the commit messages made since the last post, the pull requests that merged those commits grouped by their labels, the patches of the files that changed and excerpts of the current contents of those files.
+	Write a changelog of what has changed in the repository in the style of a blog post.
+	Group the changes into sections for features, fixes and chores following the groups of the pull requests, and use the pull request titles and descriptions to explain why changes were made.
+	You should not appear to be guessing , speak with authority do not say what your assertions are based on or reference anything you used to write the changelog.
+	Return the changelog in the form of a markdown blog post with appropriate title, formatting and some emojis.
+	DO NOT RETURN ANY ADDITIONAL COMMENTARY OR GRAMMER ONLY THE CHANGELOG.
+	REPOSITORY NAME : %s
+	COMMIT MESSAGES :
+	%s
+	PULL REQUESTS :
+	%s
+	PATCHES :
+	%s
+	CONTENTS :
+	%s
+	`
+
+	ReleaseNotesMessage = `
+	I will give you a repository name, the tag of a new release, the tag of the previous release, the pull requests merged between them and the commit messages between them.
+	Write the release notes for the new release.
+	Group the changes into sections such as new features, fixes and maintenance where appropriate and reference pull requests by their number.
+	You should not appear to be guessing , speak with authority do not say what your assertions are based on or reference anything you used to write the release notes.
+	Return the release notes in markdown with appropriate headings and formatting.
+	DO NOT RETURN ANY ADDITIONAL COMMENTARY OR GRAMMER ONLY THE RELEASE NOTES.
+	REPOSITORY NAME : %s
+	RELEASE : %s
+	PREVIOUS RELEASE : %s
+	PULL REQUESTS :
+	%s
+	COMMIT MESSAGES :
+	%s
 	`
 )
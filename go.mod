@@ -9,20 +9,20 @@ require (
 )
 
 require (
-	github.com/bradleyfalzon/ghinstallation/v2 v2.8.0 // indirect
+	github.com/bradleyfalzon/ghinstallation/v2 v2.8.0
 	github.com/dlclark/regexp2 v1.10.0 // indirect
-	github.com/go-co-op/gocron v1.36.1 // indirect
+	github.com/go-co-op/gocron v1.36.1
 	github.com/golang-jwt/jwt/v4 v4.5.0 // indirect
 	github.com/google/go-cmp v0.5.9 // indirect
 	github.com/google/go-querystring v1.1.0 // indirect
-	github.com/google/uuid v1.4.0 // indirect
+	github.com/google/uuid v1.4.0
 	github.com/kr/pretty v0.3.0 // indirect
-	github.com/pkoukk/tiktoken-go v0.1.4-0.20230627072225-97b6b4d4032c // indirect
-	github.com/robfig/cron/v3 v3.0.1 // indirect
+	github.com/pkoukk/tiktoken-go v0.1.4-0.20230627072225-97b6b4d4032c
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/rogpeppe/go-internal v1.8.1 // indirect
 	go.uber.org/atomic v1.9.0 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
-	golang.org/x/sync v0.5.0 // indirect
+	golang.org/x/sync v0.5.0
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 )
 
@@ -0,0 +1,43 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "runs.json")
+
+	for _, content := range []string{`[{"id":"1"}]`, `[]`} {
+		if err := Write(path, []byte(content)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("file = %s, want %s", got, content)
+		}
+	}
+
+	// the temporary files are renamed or removed
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only %s", len(entries), filepath.Base(path))
+	}
+}
+
+func TestWriteMissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "runs.json")
+
+	if err := Write(path, []byte(`[]`)); err == nil {
+		t.Error("Write() error = nil, want the temporary file to fail")
+	}
+}
@@ -0,0 +1,130 @@
+package contents
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// maxArchiveRedirects follows the archive endpoint to the download location.
+const maxArchiveRedirects = 3
+
+// ArchiveSource downloads the repository tarball at a commit and reads the files from it in
+// memory. Only the requested files are kept, a later read of other files downloads it again.
+type ArchiveSource struct {
+	client     *github.Client
+	httpClient *http.Client
+	owner      string
+	repo       string
+	sha        string
+
+	mu    sync.Mutex
+	files map[string]string
+}
+
+func NewArchiveSource(client *github.Client, owner string, repo string, sha string) *ArchiveSource {
+	return &ArchiveSource{
+		client:     client,
+		httpClient: retryablehttp.NewClient().StandardClient(),
+		owner:      owner,
+		repo:       repo,
+		sha:        sha,
+		files:      make(map[string]string),
+	}
+}
+
+func (s *ArchiveSource) Read(ctx context.Context, paths []string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[string]bool)
+	for _, path := range paths {
+		if _, ok := s.files[path]; !ok {
+			wanted[path] = true
+		}
+	}
+
+	if len(wanted) > 0 {
+		if err := s.download(ctx, wanted); err != nil {
+			return nil, err
+		}
+	}
+
+	files := make(map[string]string, len(paths))
+	for _, path := range paths {
+		if content, ok := s.files[path]; ok {
+			files[path] = content
+		}
+	}
+
+	return files, nil
+}
+
+func (s *ArchiveSource) download(ctx context.Context, wanted map[string]bool) error {
+	link, _, err := s.client.Repositories.GetArchiveLink(ctx, s.owner, s.repo, github.Tarball, &github.RepositoryContentGetOptions{Ref: s.sha}, maxArchiveRedirects)
+	if err != nil {
+		return fmt.Errorf("error getting archive link: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error downloading archive: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	gzipReader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading archive: %w", err)
+	}
+	defer gzipReader.Close()
+
+	return readTar(gzipReader, wanted, s.files)
+}
+
+// readTar copies the wanted files into files. GitHub archives put everything under a single
+// {owner}-{repo}-{sha} directory, which is stripped from the paths.
+func readTar(r io.Reader, wanted map[string]bool, files map[string]string) error {
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading archive: %w", err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		_, path, ok := strings.Cut(header.Name, "/")
+		if !ok || !wanted[path] {
+			continue
+		}
+
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			return fmt.Errorf("error reading %s from archive: %w", path, err)
+		}
+
+		files[path] = string(content)
+	}
+}
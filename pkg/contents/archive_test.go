@@ -0,0 +1,91 @@
+package contents
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+// tarball builds a gzipped archive with the files under a single top level directory, as GitHub does.
+func tarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	gzipWriter := gzip.NewWriter(&b)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	if err := tarWriter.WriteHeader(&tar.Header{Name: "octocat-hello-world-sha/", Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range files {
+		if err := tarWriter.WriteHeader(&tar.Header{Name: "octocat-hello-world-sha/" + path, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func TestArchiveSourceRead(t *testing.T) {
+	archive := tarball(t, map[string]string{
+		"main.go":        "package main\n",
+		"docs/README.md": "# Docs\n",
+		"LICENSE":        "MIT\n",
+	})
+
+	var downloads int32
+	var client = newTestClient(t, nil)
+	client = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/octocat/hello-world/tarball/sha":
+			http.Redirect(w, r, client.BaseURL.String()+"download", http.StatusFound)
+		case "/download":
+			atomic.AddInt32(&downloads, 1)
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	source := NewArchiveSource(client, "octocat", "hello-world", "sha")
+
+	files, err := source.Read(context.Background(), []string{"main.go", "docs/README.md", "missing.go"})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if want := map[string]string{"main.go": "package main\n", "docs/README.md": "# Docs\n"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("Read() = %v, want %v", files, want)
+	}
+
+	// files already read are served from memory
+	if _, err := source.Read(context.Background(), []string{"main.go"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&downloads); got != 1 {
+		t.Errorf("downloads = %d, want 1", got)
+	}
+
+	// only the requested files were kept, reading another downloads the archive again
+	files, err = source.Read(context.Background(), []string{"LICENSE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files["LICENSE"] != "MIT\n" || atomic.LoadInt32(&downloads) != 2 {
+		t.Errorf("Read() = %v after %d downloads, want LICENSE from a second download", files, downloads)
+	}
+}
@@ -0,0 +1,93 @@
+package contents
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/TonyDMorris/quick-function/pkg/logging"
+	"github.com/TonyDMorris/quick-function/pkg/ratelimit"
+	"github.com/google/go-github/v56/github"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/sync/errgroup"
+)
+
+// BlobConcurrency is the number of blobs fetched at once.
+const BlobConcurrency = 4
+
+// BlobSource fetches files as git blobs by the SHAs of a tree or diff, which works for files
+// the Contents API refuses and needs no ref lookups.
+type BlobSource struct {
+	client *github.Client
+	owner  string
+	repo   string
+	shas   map[string]string
+}
+
+// NewBlobSource reads the files whose blob SHAs are given by path.
+func NewBlobSource(client *github.Client, owner string, repo string, shas map[string]string) *BlobSource {
+	return &BlobSource{
+		client: client,
+		owner:  owner,
+		repo:   repo,
+		shas:   shas,
+	}
+}
+
+// BlobSHAs maps the blob entries of a tree by path.
+func BlobSHAs(entries []*github.TreeEntry) map[string]string {
+	shas := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if entry.GetType() == "blob" {
+			shas[entry.GetPath()] = entry.GetSHA()
+		}
+	}
+	return shas
+}
+
+func (s *BlobSource) Read(ctx context.Context, paths []string) (map[string]string, error) {
+	var mu sync.Mutex
+	files := make(map[string]string, len(paths))
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(BlobConcurrency)
+
+	for _, path := range paths {
+		path := path
+		sha, ok := s.shas[path]
+		if !ok {
+			continue
+		}
+
+		group.Go(func() error {
+			blob, _, err := s.client.Git.GetBlobRaw(groupCtx, s.owner, s.repo, sha)
+			if err != nil {
+				logging.Logger.Error("error getting blob", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err}, zapcore.Field{Key: "path", Type: zapcore.StringType, String: path})
+				if isRateLimit(err) {
+					return err
+				}
+				return nil
+			}
+
+			mu.Lock()
+			files[path] = string(blob)
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// isRateLimit reports whether the error is a GitHub rate limit, reading more files would only fail too.
+func isRateLimit(err error) bool {
+	var rateLimited *ratelimit.ErrRateLimited
+	var rateLimitErr *github.RateLimitError
+	var abuseRateLimitErr *github.AbuseRateLimitError
+	return errors.As(err, &rateLimited) || errors.As(err, &rateLimitErr) || errors.As(err, &abuseRateLimitErr)
+}
@@ -0,0 +1,100 @@
+package contents
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TonyDMorris/quick-function/pkg/ratelimit"
+	"github.com/google/go-github/v56/github"
+)
+
+// newTestClient returns a GitHub client calling the handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *github.Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = baseURL
+
+	return client
+}
+
+func TestBlobSHAs(t *testing.T) {
+	shas := BlobSHAs([]*github.TreeEntry{
+		{Path: github.String("main.go"), Type: github.String("blob"), SHA: github.String("a")},
+		{Path: github.String("docs"), Type: github.String("tree"), SHA: github.String("b")},
+		{Path: github.String("docs/README.md"), Type: github.String("blob"), SHA: github.String("c")},
+		{Path: github.String("vendor/lib"), Type: github.String("commit"), SHA: github.String("d")},
+	})
+
+	if want := map[string]string{"main.go": "a", "docs/README.md": "c"}; !reflect.DeepEqual(shas, want) {
+		t.Errorf("BlobSHAs() = %v, want %v", shas, want)
+	}
+}
+
+func TestBlobSourceRead(t *testing.T) {
+	blobs := map[string]string{
+		"sha-main":   "package main\n",
+		"sha-readme": "# Hello\n",
+	}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		content, ok := blobs[r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]]
+		if !ok || r.Header.Get("Accept") != "application/vnd.github.v3.raw" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	})
+
+	source := NewBlobSource(client, "octocat", "hello-world", map[string]string{
+		"main.go":   "sha-main",
+		"README.md": "sha-readme",
+		"gone.go":   "sha-gone",
+	})
+
+	// unknown paths and blobs that fail to load are left out
+	files, err := source.Read(context.Background(), []string{"main.go", "README.md", "gone.go", "unknown.go"})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	want := map[string]string{"main.go": "package main\n", "README.md": "# Hello\n"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("Read() = %v, want %v", files, want)
+	}
+}
+
+func TestBlobSourceReadRateLimited(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", "4102444800")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message": "API rate limit exceeded"}`))
+	})
+
+	source := NewBlobSource(client, "octocat", "hello-world", map[string]string{"main.go": "sha-main"})
+
+	// a rate limit fails the read so the job can wait for the budget instead of posting without contents
+	_, err := source.Read(context.Background(), []string{"main.go"})
+	var rateLimitErr *github.RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		t.Errorf("Read() error = %v, want a github.RateLimitError", err)
+	}
+
+	if !isRateLimit(&ratelimit.ErrRateLimited{Key: "1"}) || isRateLimit(errors.New("not found")) {
+		t.Error("isRateLimit() does not tell rate limits from other errors")
+	}
+}
@@ -0,0 +1,41 @@
+package contents
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileSystemSource reads files from a directory such as a local clone, it needs no network.
+type FileSystemSource struct {
+	root string
+}
+
+func NewFileSystemSource(root string) *FileSystemSource {
+	return &FileSystemSource{root: root}
+}
+
+func (s *FileSystemSource) Read(ctx context.Context, paths []string) (map[string]string, error) {
+	files := make(map[string]string, len(paths))
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// repository paths are relative, refuse anything leaving the root
+		cleaned := filepath.Clean(filepath.FromSlash(path))
+		if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(s.root, cleaned))
+		if err != nil {
+			continue
+		}
+
+		files[path] = string(content)
+	}
+
+	return files, nil
+}
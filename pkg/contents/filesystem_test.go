@@ -0,0 +1,66 @@
+package contents
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileSystemSourceRead(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "repository")
+
+	for path, content := range map[string]string{
+		"repository/main.go":        "package main\n",
+		"repository/docs/README.md": "# Docs\n",
+		"secret.txt":                "outside the root\n",
+	} {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a directory cannot be read as a file
+	if err := os.Mkdir(filepath.Join(root, "directory"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	source := NewFileSystemSource(root)
+
+	files, err := source.Read(context.Background(), []string{
+		"main.go",
+		"docs/README.md",
+		"./docs/../main.go",
+		"missing.go",
+		"directory",
+		"../secret.txt",
+		"docs/../../secret.txt",
+		filepath.Join(dir, "secret.txt"),
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	want := map[string]string{
+		"main.go":           "package main\n",
+		"docs/README.md":    "# Docs\n",
+		"./docs/../main.go": "package main\n",
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("Read() = %v, want %v", files, want)
+	}
+}
+
+func TestFileSystemSourceReadCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := NewFileSystemSource(t.TempDir()).Read(ctx, []string{"main.go"}); err != context.Canceled {
+		t.Errorf("Read() error = %v, want %v", err, context.Canceled)
+	}
+}
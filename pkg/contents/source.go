@@ -0,0 +1,9 @@
+package contents
+
+import "context"
+
+// Source reads the files of a repository at a fixed commit. Files that do not exist or
+// cannot be read are left out of the result rather than failing the read.
+type Source interface {
+	Read(ctx context.Context, paths []string) (map[string]string, error)
+}
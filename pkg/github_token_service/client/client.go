@@ -58,7 +58,7 @@ func (t *TokenSerivce) GetToken(activeToken *string) (string, error) {
 	if !ok {
 		return "", fmt.Errorf("error parsing token claims")
 	}
-	if time.Now().Unix()+2*60 > int64(exp) {
+	if expiresSoon(time.Unix(int64(exp), 0)) {
 		return t.getToken()
 	}
 
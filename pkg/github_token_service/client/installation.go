@@ -0,0 +1,214 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/ratelimit"
+	"github.com/google/go-github/v56/github"
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// RefreshBefore is how long before expiry a token is replaced.
+const RefreshBefore = 2 * time.Minute
+
+// requestTimeout bounds each attempt of a request, retries get their own.
+const requestTimeout = 30 * time.Second
+
+// expiresSoon reports whether a token expiring at exp should be replaced.
+func expiresSoon(exp time.Time) bool {
+	return time.Now().Add(RefreshBefore).After(exp)
+}
+
+// Scope narrows an installation token to one repository and a set of permissions.
+type Scope struct {
+	Repository  string
+	Permissions *github.InstallationPermissions
+}
+
+func (s Scope) key(installationID int64) (string, error) {
+	permissions, err := json.Marshal(s.Permissions)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling permissions: %w", err)
+	}
+	return fmt.Sprintf("%d/%s/%s", installationID, s.Repository, permissions), nil
+}
+
+type installationToken struct {
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// InstallationTokenCache creates installation tokens with the app client and reuses them
+// until shortly before they expire. Tokens are cached per installation and scope, the expired
+// tokens of installations and scopes no longer used are dropped when a token is refreshed.
+type InstallationTokenCache struct {
+	appClient *github.Client
+	transport http.RoundTripper
+	limiter   *ratelimit.Limiter
+
+	mu     sync.Mutex
+	tokens map[string]*installationToken
+}
+
+// NewInstallationTokenCache creates the cache, when limiter is not nil the installation clients
+// share a rate limit budget per installation.
+func NewInstallationTokenCache(appClient *github.Client, limiter *ratelimit.Limiter) *InstallationTokenCache {
+	return &InstallationTokenCache{
+		appClient: appClient,
+		transport: retryablehttp.NewClient().HTTPClient.Transport,
+		limiter:   limiter,
+		tokens:    make(map[string]*installationToken),
+	}
+}
+
+// Token returns a token for the installation and scope, creating one when there is none or it expires soon.
+func (c *InstallationTokenCache) Token(ctx context.Context, installationID int64, scope Scope) (string, error) {
+	key, err := scope.key(installationID)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	cached, ok := c.tokens[key]
+	if !ok {
+		cached = &installationToken{}
+		c.tokens[key] = cached
+	}
+	c.mu.Unlock()
+
+	// callers of the same key wait for one refresh instead of each creating a token
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	if cached.token != "" && !expiresSoon(cached.expiresAt) {
+		return cached.token, nil
+	}
+
+	options := &github.InstallationTokenOptions{Permissions: scope.Permissions}
+	if scope.Repository != "" {
+		options.Repositories = []string{scope.Repository}
+	}
+
+	token, _, err := c.appClient.Apps.CreateInstallationToken(ctx, installationID, options)
+	if err != nil {
+		return "", fmt.Errorf("error creating installation token: %w", err)
+	}
+
+	cached.token = token.GetToken()
+	cached.expiresAt = token.GetExpiresAt().Time
+
+	c.dropExpired()
+
+	return cached.token, nil
+}
+
+// dropExpired removes the expired tokens, skipping those being refreshed.
+func (c *InstallationTokenCache) dropExpired() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for key, cached := range c.tokens {
+		if !cached.mu.TryLock() {
+			continue
+		}
+		if cached.token != "" && now.After(cached.expiresAt) {
+			delete(c.tokens, key)
+		}
+		cached.mu.Unlock()
+	}
+}
+
+// Client returns a GitHub client for the installation on a retrying transport, each request
+// is authorised with a cached token so long jobs outlive a single token. It calls the API the
+// app client calls.
+//
+// The rate limiter sits inside the retries, so every attempt waits for the installation's
+// budget and records the budget of its response. Rate limited responses are not retried, they
+// reach the caller, which requeues the job for when the budget recovers.
+func (c *InstallationTokenCache) Client(installationID int64, scope Scope) *github.Client {
+	transport := c.transport
+	if c.limiter != nil {
+		transport = &ratelimit.Transport{
+			Base:    transport,
+			Limiter: c.limiter,
+			Key:     strconv.FormatInt(installationID, 10),
+		}
+	}
+
+	retryingClient := retryablehttp.NewClient()
+	retryingClient.HTTPClient = &http.Client{
+		Transport: transport,
+		Timeout:   requestTimeout,
+	}
+	retryingClient.CheckRetry = checkRetry
+
+	base := &retryablehttp.RoundTripper{Client: retryingClient}
+
+	client := github.NewClient(&http.Client{
+		Transport: &installationTransport{
+			cache:          c,
+			installationID: installationID,
+			scope:          scope,
+			base:           base,
+		},
+	})
+
+	// installations live on the same API as the app, such as GitHub Enterprise
+	client.BaseURL = c.appClient.BaseURL
+	client.UploadURL = c.appClient.UploadURL
+
+	return client
+}
+
+// checkRetry retries like retryablehttp except for rate limits, a request the limiter refused
+// or a rate limited response would only be refused again before the budget recovers.
+func checkRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	var rateLimited *ratelimit.ErrRateLimited
+	if errors.As(err, &rateLimited) {
+		return false, err
+	}
+
+	if resp != nil && isRateLimited(resp) {
+		return false, nil
+	}
+
+	return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+}
+
+// isRateLimited reports whether GitHub refused the request for its primary or secondary rate limit.
+func isRateLimited(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	return resp.StatusCode == http.StatusForbidden &&
+		(resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != "")
+}
+
+type installationTransport struct {
+	cache          *InstallationTokenCache
+	installationID int64
+	scope          Scope
+	base           http.RoundTripper
+}
+
+func (t *installationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.cache.Token(req.Context(), t.installationID, t.scope)
+	if err != nil {
+		return nil, err
+	}
+
+	authorised := req.Clone(req.Context())
+	authorised.Header.Set("Authorization", "Bearer "+token)
+
+	return t.base.RoundTrip(authorised)
+}
@@ -0,0 +1,259 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/ratelimit"
+	"github.com/google/go-github/v56/github"
+)
+
+// tokenServer issues installation tokens valid for the lifetime and records the token requests.
+type tokenServer struct {
+	lifetime time.Duration
+
+	mu       sync.Mutex
+	issued   int
+	requests []github.InstallationTokenOptions
+}
+
+func (s *tokenServer) issue(w http.ResponseWriter, r *http.Request) {
+	var options github.InstallationTokenOptions
+	json.NewDecoder(r.Body).Decode(&options)
+
+	s.mu.Lock()
+	s.issued++
+	s.requests = append(s.requests, options)
+	token := "token-" + strconv.Itoa(s.issued)
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(github.InstallationToken{
+		Token:     github.String(token),
+		ExpiresAt: &github.Timestamp{Time: time.Now().Add(s.lifetime)},
+	})
+}
+
+func (s *tokenServer) Issued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issued
+}
+
+// newTestCache serves installation tokens and hands every other request to the handler.
+func newTestCache(t *testing.T, tokens *tokenServer, limiter *ratelimit.Limiter, handler http.HandlerFunc) *InstallationTokenCache {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/access_tokens") {
+			tokens.issue(w, r)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	appClient := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appClient.BaseURL = baseURL
+
+	return NewInstallationTokenCache(appClient, limiter)
+}
+
+func TestInstallationTokenCacheReusesTokens(t *testing.T) {
+	tokens := &tokenServer{lifetime: time.Hour}
+	cache := newTestCache(t, tokens, nil, http.NotFound)
+
+	scope := Scope{Repository: "hello-world", Permissions: &github.InstallationPermissions{Contents: github.String("read")}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.Token(context.Background(), 1, scope); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if issued := tokens.Issued(); issued != 1 {
+		t.Errorf("tokens issued = %d, want concurrent callers to share 1", issued)
+	}
+
+	// another repository or installation gets its own token
+	if _, err := cache.Token(context.Background(), 1, Scope{Repository: "other", Permissions: scope.Permissions}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Token(context.Background(), 2, scope); err != nil {
+		t.Fatal(err)
+	}
+	if issued := tokens.Issued(); issued != 3 {
+		t.Errorf("tokens issued = %d, want one per installation and scope", issued)
+	}
+
+	first := tokens.requests[0]
+	if len(first.Repositories) != 1 || first.Repositories[0] != "hello-world" || first.Permissions.GetContents() != "read" {
+		t.Errorf("token request = %+v, want it scoped to the repository and permissions", first)
+	}
+}
+
+func TestInstallationTokenCacheRefreshesExpiringTokens(t *testing.T) {
+	// tokens expiring within RefreshBefore are replaced on every call
+	tokens := &tokenServer{lifetime: RefreshBefore / 2}
+	cache := newTestCache(t, tokens, nil, http.NotFound)
+
+	first, err := cache.Token(context.Background(), 1, Scope{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cache.Token(context.Background(), 1, Scope{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first == second || tokens.Issued() != 2 {
+		t.Errorf("tokens = %q, %q after %d issued, want the expiring token replaced", first, second, tokens.Issued())
+	}
+}
+
+func TestInstallationTokenCacheDropsExpiredTokens(t *testing.T) {
+	tokens := &tokenServer{lifetime: time.Hour}
+	cache := newTestCache(t, tokens, nil, http.NotFound)
+
+	for installationID := int64(1); installationID <= 3; installationID++ {
+		if _, err := cache.Token(context.Background(), installationID, Scope{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the tokens of the first two installations, no longer used, expired and the third expires
+	// soon so it is refreshed
+	refreshed, err := Scope{}.key(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, cached := range cache.tokens {
+		cached.expiresAt = time.Now().Add(-time.Minute)
+		if key == refreshed {
+			cached.expiresAt = time.Now().Add(time.Minute)
+		}
+	}
+
+	if _, err := cache.Token(context.Background(), 3, Scope{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cache.tokens) != 1 {
+		t.Errorf("cached tokens = %d, want only the refreshed one", len(cache.tokens))
+	}
+}
+
+func TestInstallationClient(t *testing.T) {
+	var authorization string
+	tokens := &tokenServer{lifetime: time.Hour}
+	cache := newTestCache(t, tokens, nil, func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		json.NewEncoder(w).Encode(github.Repository{Name: github.String("hello-world")})
+	})
+
+	// the installation client calls the app client's API rather than api.github.com
+	repository, _, err := cache.Client(1, Scope{}).Repositories.Get(context.Background(), "octocat", "hello-world")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if repository.GetName() != "hello-world" {
+		t.Errorf("repository = %q, want hello-world", repository.GetName())
+	}
+	if authorization != "Bearer token-1" {
+		t.Errorf("Authorization = %q, want the installation token", authorization)
+	}
+}
+
+func TestClientRecordsRateLimitedResponses(t *testing.T) {
+	reset := time.Now().Add(time.Hour)
+
+	var requests int32
+	limiter := ratelimit.NewLimiter(time.Second)
+	cache := newTestCache(t, &tokenServer{lifetime: time.Hour}, limiter, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message":"API rate limit exceeded"}`))
+	})
+
+	client := cache.Client(1, Scope{})
+
+	_, _, err := client.Repositories.Get(context.Background(), "octocat", "hello-world")
+	var rateLimitErr *github.RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		t.Fatalf("error = %v, want a github.RateLimitError", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("requests = %d, want 1, a rate limited response is not retried", got)
+	}
+
+	until, paused := limiter.PausedUntil("1")
+	if !paused || until.Unix() != reset.Unix() {
+		t.Fatalf("paused until %s (%t), want %s", until, paused, reset)
+	}
+
+	// a new client shares the budget, it is paused for longer than the limiter waits
+	_, _, err = cache.Client(1, Scope{}).Repositories.Get(context.Background(), "octocat", "hello-world")
+	var rateLimited *ratelimit.ErrRateLimited
+	if !errors.As(err, &rateLimited) {
+		t.Fatalf("error = %v, want a ratelimit.ErrRateLimited", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("requests = %d, want 1, a paused installation sends nothing", got)
+	}
+}
+
+func TestClientWaitsBeforeRetries(t *testing.T) {
+	var requests int32
+	limiter := ratelimit.NewLimiter(time.Minute)
+	cache := newTestCache(t, &tokenServer{lifetime: time.Hour}, limiter, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			// a server error exhausting the budget for a few seconds, the retry has to wait it out
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(3*time.Second).Unix(), 10))
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(github.Repository{Name: github.String("hello-world")})
+	})
+
+	client := cache.Client(1, Scope{})
+
+	start := time.Now()
+	repository, _, err := client.Repositories.Get(context.Background(), "octocat", "hello-world")
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if repository.GetName() != "hello-world" {
+		t.Errorf("repository = %q, want hello-world", repository.GetName())
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+	if elapsed := time.Since(start); elapsed < 2*time.Second {
+		t.Errorf("retried after %s, want it to wait for the budget to reset", elapsed)
+	}
+}
@@ -0,0 +1,178 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/gpt/models"
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+const (
+	AnthropicBaseURL      = "https://api.anthropic.com/v1"
+	AnthropicVersion      = "2023-06-01"
+	AnthropicDefaultModel = "claude-3-haiku-20240307"
+
+	anthropicMaxTokens = 4096
+)
+
+// AnthropicChatClient talks to Anthropic's messages API and maps it onto the chat completion models.
+type AnthropicChatClient struct {
+	client *retryablehttp.Client
+	apiKey string
+	url    string
+	model  string
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	MaxTokens     int                `json:"max_tokens"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+func NewAnthropicChatClient(config ProviderConfig) *AnthropicChatClient {
+	retriableClient := retryablehttp.NewClient()
+	retriableClient.RetryMax = 5
+	retriableClient.HTTPClient.Timeout = time.Minute * 5
+
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = AnthropicBaseURL
+	}
+
+	model := config.Model
+	if model == "" {
+		model = AnthropicDefaultModel
+	}
+
+	return &AnthropicChatClient{
+		client: retriableClient,
+		apiKey: config.APIKey,
+		url:    strings.TrimSuffix(baseURL, "/") + "/messages",
+		model:  model,
+	}
+}
+
+func (c *AnthropicChatClient) Model() string {
+	return c.model
+}
+
+// Chat sends the conversation to the messages API, seed and response format are not supported and are ignored.
+func (c *AnthropicChatClient) Chat(ctx context.Context, messages []models.Message, options models.CompletionOptions) (*models.CompletionResponse, error) {
+	requestBody := anthropicRequest{
+		Model:         c.model,
+		MaxTokens:     anthropicMaxTokens,
+		Temperature:   options.Temperature,
+		TopP:          options.TopP,
+		StopSequences: options.Stop,
+	}
+
+	if options.Model != "" {
+		requestBody.Model = options.Model
+	}
+
+	if options.MaxTokens > 0 {
+		requestBody.MaxTokens = options.MaxTokens
+	}
+
+	// system prompts are a separate field, the conversation itself must start with a user message
+	var system []string
+	for _, message := range messages {
+		if message.Role == models.RoleSystem {
+			system = append(system, message.Content)
+			continue
+		}
+		requestBody.Messages = append(requestBody.Messages, anthropicMessage{Role: message.Role, Content: message.Content})
+	}
+
+	if len(requestBody.Messages) == 0 {
+		requestBody.Messages = []anthropicMessage{{Role: models.RoleUser, Content: strings.Join(system, "\n")}}
+	} else {
+		requestBody.System = strings.Join(system, "\n")
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("anthropic-version", AnthropicVersion)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	var anthropicResp anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&anthropicResp); err != nil {
+		return nil, err
+	}
+
+	var text []string
+	for _, content := range anthropicResp.Content {
+		if content.Type == "text" {
+			text = append(text, content.Text)
+		}
+	}
+
+	finishReason := anthropicResp.StopReason
+	if finishReason == "end_turn" || finishReason == "stop_sequence" {
+		finishReason = models.FinishReasonStop
+	}
+
+	return &models.CompletionResponse{
+		Choices: []models.CompletionResponseChoice{
+			{
+				Message: models.Message{
+					Role:    models.RoleAssistant,
+					Content: strings.Join(text, ""),
+				},
+				FinishReason: finishReason,
+			},
+		},
+		Usage: models.CompletionResponseUsage{
+			PromptTokens:     anthropicResp.Usage.InputTokens,
+			CompletionTokens: anthropicResp.Usage.OutputTokens,
+			TotalTokens:      anthropicResp.Usage.InputTokens + anthropicResp.Usage.OutputTokens,
+		},
+	}, nil
+}
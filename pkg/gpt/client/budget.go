@@ -0,0 +1,69 @@
+package client
+
+import "strings"
+
+const (
+	// DefaultContextWindow is used for models missing from contextWindows.
+	DefaultContextWindow = 8192
+	// DefaultCompletionTokens is reserved for the completion when a repository sets no max tokens.
+	DefaultCompletionTokens = 1024
+	// PromptReserveTokens is reserved for instructions, commit messages and file names.
+	PromptReserveTokens = 1024
+	// MinContentBudget stops small context windows from leaving nothing for file contents.
+	MinContentBudget = 512
+)
+
+// contextWindows maps model name prefixes to their context window, longest prefix wins.
+var contextWindows = map[string]int{
+	"gpt-4":              8192,
+	"gpt-4-32k":          32768,
+	"gpt-4-1106":         128000,
+	"gpt-4-0125":         128000,
+	"gpt-4-turbo":        128000,
+	"gpt-4o":             128000,
+	"gpt-3.5-turbo":      16385,
+	"gpt-3.5-turbo-0613": 4096,
+	"gpt-3.5-turbo-16k":  16385,
+	"claude-3":           200000,
+	"claude-2":           100000,
+	"llama3":             8192,
+	"llama-3.1":          128000,
+	"mistral":            32768,
+	FakeModel:            DefaultContextWindow,
+}
+
+// ContextWindow returns the context window of the model in tokens.
+func ContextWindow(model string) int {
+	var match string
+	for prefix := range contextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+
+	if match == "" {
+		return DefaultContextWindow
+	}
+
+	return contextWindows[match]
+}
+
+// ContentBudget returns the tokens available for file contents once the completion and prompt
+// are reserved from the model's context window, capped by tokenBudget when it is set.
+func ContentBudget(model string, completionTokens int, tokenBudget int) int {
+	if completionTokens <= 0 {
+		completionTokens = DefaultCompletionTokens
+	}
+
+	budget := ContextWindow(model) - completionTokens - PromptReserveTokens
+
+	if tokenBudget > 0 && tokenBudget < budget {
+		budget = tokenBudget
+	}
+
+	if budget < MinContentBudget {
+		budget = MinContentBudget
+	}
+
+	return budget
+}
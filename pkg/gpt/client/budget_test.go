@@ -0,0 +1,52 @@
+package client
+
+import "testing"
+
+func TestContextWindow(t *testing.T) {
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{model: "gpt-4", want: 8192},
+		{model: "gpt-4-32k-0613", want: 32768},
+		{model: "gpt-4o-mini", want: 128000},
+		{model: "gpt-3.5-turbo-0613", want: 4096},
+		{model: "gpt-3.5-turbo-1106", want: 16385},
+		{model: "claude-3-haiku-20240307", want: 200000},
+		{model: "unknown-model", want: DefaultContextWindow},
+		{model: "", want: DefaultContextWindow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if got := ContextWindow(tt.model); got != tt.want {
+				t.Errorf("ContextWindow(%q) = %d, want %d", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentBudget(t *testing.T) {
+	tests := []struct {
+		name             string
+		model            string
+		completionTokens int
+		tokenBudget      int
+		want             int
+	}{
+		{name: "default completion reserve", model: "gpt-4", want: 8192 - DefaultCompletionTokens - PromptReserveTokens},
+		{name: "repository completion reserve", model: "gpt-4", completionTokens: 2048, want: 8192 - 2048 - PromptReserveTokens},
+		{name: "token budget caps the window", model: "gpt-4o", tokenBudget: 3000, want: 3000},
+		{name: "token budget above the window is ignored", model: "gpt-4", tokenBudget: 100000, want: 8192 - DefaultCompletionTokens - PromptReserveTokens},
+		{name: "small window keeps the minimum", model: "gpt-3.5-turbo-0613", completionTokens: 3500, want: MinContentBudget},
+		{name: "small token budget keeps the minimum", model: "gpt-4", tokenBudget: 10, want: MinContentBudget},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ContentBudget(tt.model, tt.completionTokens, tt.tokenBudget); got != tt.want {
+				t.Errorf("ContentBudget() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
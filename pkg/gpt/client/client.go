@@ -2,8 +2,8 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -17,37 +17,96 @@ import (
 	"github.com/pkoukk/tiktoken-go"
 )
 
-const MaxTokens = 2048
-
 const (
-	OpenAIURL = "https://api.openai.com/v1/chat/completions"
-	GPT4Model = "gpt-4"
-	GPT3Model = "gpt-3.5-turbo"
+	OpenAIURL     = "https://api.openai.com/v1/chat/completions"
+	OpenAIBaseURL = "https://api.openai.com/v1"
+	GPT4Model     = "gpt-4"
+	GPT3Model     = "gpt-3.5-turbo"
 )
 
+// StatusError is returned when the provider responds with an unexpected status code.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d: %s", e.StatusCode, e.Body)
+}
+
 type ChatClientInterface interface {
-	Chat(messages []models.Message) (*models.CompletionResponse, error)
+	Chat(ctx context.Context, messages []models.Message, options models.CompletionOptions) (*models.CompletionResponse, error)
+	// Model returns the model used when the options do not name one.
+	Model() string
 }
 
+// ChatClient talks to OpenAI or any server exposing an OpenAI compatible chat completions endpoint,
+// such as Azure OpenAI, llama.cpp or Ollama.
 type ChatClient struct {
-	client *retryablehttp.Client
-	apiKey string
+	client     *retryablehttp.Client
+	apiKey     string
+	url        string
+	model      string
+	authHeader string
 }
 
 func NewChatClient(apiKey string) *ChatClient {
+	return NewOpenAICompatibleChatClient(ProviderConfig{
+		APIKey: apiKey,
+	})
+}
+
+// NewOpenAICompatibleChatClient builds a client for {BaseURL}/chat/completions, defaulting to OpenAI and gpt-4.
+func NewOpenAICompatibleChatClient(config ProviderConfig) *ChatClient {
 	retriableClient := retryablehttp.NewClient()
 	retriableClient.RetryMax = 5
 	retriableClient.HTTPClient.Timeout = time.Minute * 5
+
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = OpenAIBaseURL
+	}
+
+	url := strings.TrimSuffix(baseURL, "/") + "/chat/completions"
+	if config.APIVersion != "" {
+		url = fmt.Sprintf("%s?api-version=%s", url, config.APIVersion)
+	}
+
+	model := config.Model
+	if model == "" {
+		model = GPT4Model
+	}
+
 	return &ChatClient{
-		client: retriableClient,
-		apiKey: apiKey,
+		client:     retriableClient,
+		apiKey:     config.APIKey,
+		url:        url,
+		model:      model,
+		authHeader: config.AuthHeader,
 	}
 }
 
-func (c *ChatClient) Chat(messages []models.Message) (*models.CompletionResponse, error) {
+func (c *ChatClient) Model() string {
+	return c.model
+}
+
+func (c *ChatClient) Chat(ctx context.Context, messages []models.Message, options models.CompletionOptions) (*models.CompletionResponse, error) {
 	requestBody := models.CompletionRequest{
-		Model:    GPT4Model,
-		Messages: messages,
+		Model:       c.model,
+		Messages:    messages,
+		Temperature: options.Temperature,
+		TopP:        options.TopP,
+		MaxTokens:   options.MaxTokens,
+		Stop:        options.Stop,
+		Seed:        options.Seed,
+	}
+
+	if options.Model != "" {
+		requestBody.Model = options.Model
+	}
+
+	if options.ResponseFormat != "" {
+		requestBody.ResponseFormat = &models.ResponseFormat{Type: options.ResponseFormat}
 	}
 
 	jsonBody, err := json.Marshal(requestBody)
@@ -55,12 +114,18 @@ func (c *ChatClient) Chat(messages []models.Message) (*models.CompletionResponse
 		return nil, err
 	}
 
-	req, err := retryablehttp.NewRequest(http.MethodPost, OpenAIURL, bytes.NewBuffer(jsonBody))
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	switch {
+	case c.apiKey == "":
+	case c.authHeader != "":
+		req.Header.Set(c.authHeader, c.apiKey)
+	default:
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.client.Do(req)
@@ -71,7 +136,7 @@ func (c *ChatClient) Chat(messages []models.Message) (*models.CompletionResponse
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, errors.New(string(bodyBytes))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
 	}
 
 	var completionResponse models.CompletionResponse
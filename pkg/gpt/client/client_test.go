@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TonyDMorris/quick-function/pkg/gpt/models"
+)
+
+func TestOpenAICompatibleChatClient(t *testing.T) {
+	var request *http.Request
+	var body models.CompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		json.NewDecoder(r.Body).Decode(&body)
+		json.NewEncoder(w).Encode(models.CompletionResponse{
+			Choices: []models.CompletionResponseChoice{{Message: models.Message{Role: models.RoleAssistant, Content: "hello"}}},
+		})
+	}))
+	defer server.Close()
+
+	// Azure names the deployment in the url and authenticates with an api-key header
+	chatClient, err := NewProvider(ProviderConfig{
+		Provider:   ProviderAzure,
+		APIKey:     "secret",
+		BaseURL:    server.URL + "/openai/deployments/gpt-4/",
+		Model:      "gpt-4o",
+		APIVersion: "2024-02-01",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []models.Message{{Role: models.RoleSystem, Content: "Write a post."}}
+	resp, err := chatClient.Chat(context.Background(), messages, models.CompletionOptions{})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if resp.Choices[0].Message.Content != "hello" {
+		t.Errorf("Chat() content = %q, want hello", resp.Choices[0].Message.Content)
+	}
+
+	if request.URL.Path != "/openai/deployments/gpt-4/chat/completions" || request.URL.Query().Get("api-version") != "2024-02-01" {
+		t.Errorf("request url = %s, want the deployment's chat completions with the api version", request.URL)
+	}
+	if request.Header.Get("api-key") != "secret" || request.Header.Get("Authorization") != "" {
+		t.Errorf("request headers = %v, want the key in api-key only", request.Header)
+	}
+	if body.Model != "gpt-4o" || !reflect.DeepEqual(body.Messages, messages) {
+		t.Errorf("request body = %+v, want the model and messages", body)
+	}
+}
+
+func TestAnthropicChatClient(t *testing.T) {
+	var request *http.Request
+	var body anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		body = anthropicRequest{}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{
+			"content": [{"type": "text", "text": "# Post"}, {"type": "text", "text": "\nBody."}],
+			"stop_reason": "end_turn",
+			"usage": {"input_tokens": 10, "output_tokens": 4}
+		}`))
+	}))
+	defer server.Close()
+
+	chatClient := NewAnthropicChatClient(ProviderConfig{APIKey: "secret", BaseURL: server.URL})
+
+	tests := []struct {
+		name       string
+		messages   []models.Message
+		wantSystem string
+		wantFirst  anthropicMessage
+	}{
+		{
+			name:       "system and user messages",
+			messages:   []models.Message{{Role: models.RoleSystem, Content: "Be brief."}, {Role: models.RoleUser, Content: "Write a post."}},
+			wantSystem: "Be brief.",
+			wantFirst:  anthropicMessage{Role: models.RoleUser, Content: "Write a post."},
+		},
+		{
+			// the messages API needs a user message, a lone system prompt becomes one
+			name:      "system message only",
+			messages:  []models.Message{{Role: models.RoleSystem, Content: "Write a post."}},
+			wantFirst: anthropicMessage{Role: models.RoleUser, Content: "Write a post."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := chatClient.Chat(context.Background(), tt.messages, models.CompletionOptions{})
+			if err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+
+			if !strings.HasSuffix(request.URL.Path, "/messages") || request.Header.Get("x-api-key") != "secret" || request.Header.Get("anthropic-version") != AnthropicVersion {
+				t.Errorf("request = %s %v, want the messages API with the key and version", request.URL, request.Header)
+			}
+			if body.Model != AnthropicDefaultModel || body.System != tt.wantSystem || len(body.Messages) != 1 || body.Messages[0] != tt.wantFirst {
+				t.Errorf("request body = %+v, want system %q and first message %+v", body, tt.wantSystem, tt.wantFirst)
+			}
+
+			want := models.CompletionResponse{
+				Choices: []models.CompletionResponseChoice{
+					{Message: models.Message{Role: models.RoleAssistant, Content: "# Post\nBody."}, FinishReason: models.FinishReasonStop},
+				},
+				Usage: models.CompletionResponseUsage{PromptTokens: 10, CompletionTokens: 4, TotalTokens: 14},
+			}
+			if !reflect.DeepEqual(*resp, want) {
+				t.Errorf("Chat() = %+v, want %+v", *resp, want)
+			}
+		})
+	}
+}
+
+func TestChatClientOptions(t *testing.T) {
+	temperature := 0.2
+	topP := 0.9
+	seed := 7
+	options := models.CompletionOptions{
+		Model:          "gpt-4o-mini",
+		Temperature:    &temperature,
+		TopP:           &topP,
+		MaxTokens:      512,
+		Stop:           []string{"---"},
+		Seed:           &seed,
+		ResponseFormat: models.ResponseFormatJSONObject,
+	}
+
+	t.Run("openai compatible", func(t *testing.T) {
+		var body models.CompletionRequest
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&body)
+			json.NewEncoder(w).Encode(models.CompletionResponse{
+				Choices: []models.CompletionResponseChoice{{Message: models.Message{Role: models.RoleAssistant, Content: "{}"}}},
+			})
+		}))
+		defer server.Close()
+
+		chatClient := NewOpenAICompatibleChatClient(ProviderConfig{APIKey: "secret", BaseURL: server.URL, Model: "gpt-4"})
+		if chatClient.Model() != "gpt-4" {
+			t.Errorf("Model() = %q, want gpt-4", chatClient.Model())
+		}
+
+		if _, err := chatClient.Chat(context.Background(), []models.Message{{Role: models.RoleUser, Content: "hi"}}, options); err != nil {
+			t.Fatalf("Chat() error = %v", err)
+		}
+
+		want := models.CompletionRequest{
+			Model:          "gpt-4o-mini",
+			Messages:       []models.Message{{Role: models.RoleUser, Content: "hi"}},
+			Temperature:    &temperature,
+			TopP:           &topP,
+			MaxTokens:      512,
+			Stop:           []string{"---"},
+			Seed:           &seed,
+			ResponseFormat: &models.ResponseFormat{Type: models.ResponseFormatJSONObject},
+		}
+		if !reflect.DeepEqual(body, want) {
+			t.Errorf("request body = %+v, want %+v", body, want)
+		}
+	})
+
+	t.Run("anthropic", func(t *testing.T) {
+		var body anthropicRequest
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&body)
+			w.Write([]byte(`{"content": [{"type": "text", "text": "{}"}], "stop_reason": "end_turn"}`))
+		}))
+		defer server.Close()
+
+		chatClient := NewAnthropicChatClient(ProviderConfig{APIKey: "secret", BaseURL: server.URL})
+		if _, err := chatClient.Chat(context.Background(), []models.Message{{Role: models.RoleUser, Content: "hi"}}, options); err != nil {
+			t.Fatalf("Chat() error = %v", err)
+		}
+
+		if body.Model != "gpt-4o-mini" || body.MaxTokens != 512 || *body.Temperature != temperature || *body.TopP != topP || !reflect.DeepEqual(body.StopSequences, []string{"---"}) {
+			t.Errorf("request body = %+v, want the options applied", body)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/TonyDMorris/quick-function/pkg/gpt/models"
+)
+
+const FakeModel = "fake"
+
+// FakeChatClient returns deterministic responses without calling any provider.
+// A trailing user message is echoed back, so file selection prompts select every file,
+// otherwise a markdown post identifying the prompt by its hash is returned.
+type FakeChatClient struct {
+	mu       sync.Mutex
+	requests [][]models.Message
+}
+
+func NewFakeChatClient() *FakeChatClient {
+	return &FakeChatClient{}
+}
+
+func (c *FakeChatClient) Model() string {
+	return FakeModel
+}
+
+func (c *FakeChatClient) Chat(ctx context.Context, messages []models.Message, options models.CompletionOptions) (*models.CompletionResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.requests = append(c.requests, messages)
+	c.mu.Unlock()
+
+	var prompt []string
+	for _, message := range messages {
+		prompt = append(prompt, message.Content)
+	}
+
+	var content string
+	if len(messages) > 0 && messages[len(messages)-1].Role == models.RoleUser {
+		content = messages[len(messages)-1].Content
+	} else {
+		content = fmt.Sprintf("# Fake post\n\nGenerated from prompt %x.\n", sha256.Sum256([]byte(strings.Join(prompt, "\n"))))
+	}
+
+	promptTokens := len(strings.Fields(strings.Join(prompt, " ")))
+	completionTokens := len(strings.Fields(content))
+
+	return &models.CompletionResponse{
+		Choices: []models.CompletionResponseChoice{
+			{
+				Message: models.Message{
+					Role:    models.RoleAssistant,
+					Content: content,
+				},
+				FinishReason: models.FinishReasonStop,
+			},
+		},
+		Usage: models.CompletionResponseUsage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		},
+	}, nil
+}
+
+// Requests returns every conversation sent to the client so far.
+func (c *FakeChatClient) Requests() [][]models.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([][]models.Message(nil), c.requests...)
+}
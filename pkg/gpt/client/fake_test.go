@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/TonyDMorris/quick-function/pkg/gpt/models"
+)
+
+func TestFakeChatClient(t *testing.T) {
+	chatClient := NewFakeChatClient()
+
+	// file selection prompts end with the candidates, they are echoed back so every file is selected
+	selection := []models.Message{
+		{Role: models.RoleSystem, Content: "Pick the interesting files."},
+		{Role: models.RoleUser, Content: "main.go\nREADME.md"},
+	}
+	resp, err := chatClient.Chat(context.Background(), selection, models.CompletionOptions{})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if got := resp.Choices[0].Message.Content; got != "main.go\nREADME.md" {
+		t.Errorf("Chat() content = %q, want the user message echoed", got)
+	}
+
+	post := []models.Message{{Role: models.RoleSystem, Content: "Write a post about main.go."}}
+	first, err := chatClient.Chat(context.Background(), post, models.CompletionOptions{})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	second, _ := chatClient.Chat(context.Background(), post, models.CompletionOptions{})
+	other, _ := chatClient.Chat(context.Background(), []models.Message{{Role: models.RoleSystem, Content: "Write a post about README.md."}}, models.CompletionOptions{})
+
+	content := first.Choices[0].Message.Content
+	if !strings.HasPrefix(content, "# Fake post") {
+		t.Errorf("Chat() content = %q, want a fake post", content)
+	}
+	if second.Choices[0].Message.Content != content || other.Choices[0].Message.Content == content {
+		t.Errorf("Chat() is not deterministic per prompt")
+	}
+	if first.Usage.TotalTokens != first.Usage.PromptTokens+first.Usage.CompletionTokens || first.Usage.PromptTokens == 0 {
+		t.Errorf("Chat() usage = %+v, want prompt and completion tokens counted", first.Usage)
+	}
+
+	if requests := chatClient.Requests(); len(requests) != 4 || requests[0][1].Content != "main.go\nREADME.md" {
+		t.Errorf("Requests() = %d conversations, want all 4 recorded in order", len(requests))
+	}
+}
+
+func TestFakeChatClientCancelled(t *testing.T) {
+	chatClient := NewFakeChatClient()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := chatClient.Chat(ctx, []models.Message{{Role: models.RoleUser, Content: "hi"}}, models.CompletionOptions{}); err != context.Canceled {
+		t.Errorf("Chat() error = %v, want %v", err, context.Canceled)
+	}
+	if requests := chatClient.Requests(); len(requests) != 0 {
+		t.Errorf("requests = %d, want none", len(requests))
+	}
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAzure     = "azure"
+	ProviderAnthropic = "anthropic"
+	ProviderFake      = "fake"
+)
+
+// ProviderConfig selects and configures a chat provider, fields a provider does not use are ignored.
+type ProviderConfig struct {
+	Provider string
+	APIKey   string
+	BaseURL  string
+	Model    string
+	// AuthHeader replaces the default "Authorization: Bearer" header, e.g. "api-key" for Azure OpenAI.
+	AuthHeader string
+	// APIVersion is sent as the api-version query parameter, required by Azure OpenAI.
+	APIVersion string
+}
+
+type ProviderFactory func(config ProviderConfig) (ChatClientInterface, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]ProviderFactory{
+		ProviderOpenAI: func(config ProviderConfig) (ChatClientInterface, error) {
+			return NewOpenAICompatibleChatClient(config), nil
+		},
+		ProviderAzure: func(config ProviderConfig) (ChatClientInterface, error) {
+			if config.BaseURL == "" {
+				return nil, fmt.Errorf("azure provider requires a base url")
+			}
+			if config.AuthHeader == "" {
+				config.AuthHeader = "api-key"
+			}
+			return NewOpenAICompatibleChatClient(config), nil
+		},
+		ProviderAnthropic: func(config ProviderConfig) (ChatClientInterface, error) {
+			if config.APIKey == "" {
+				return nil, fmt.Errorf("anthropic provider requires an api key")
+			}
+			return NewAnthropicChatClient(config), nil
+		},
+		ProviderFake: func(config ProviderConfig) (ChatClientInterface, error) {
+			return NewFakeChatClient(), nil
+		},
+	}
+)
+
+// RegisterProvider adds or replaces the factory used for a provider name.
+func RegisterProvider(name string, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	providers[strings.ToLower(name)] = factory
+}
+
+// NewProvider builds the chat client for config.Provider, defaulting to OpenAI.
+func NewProvider(config ProviderConfig) (ChatClientInterface, error) {
+	name := strings.ToLower(config.Provider)
+	if name == "" {
+		name = ProviderOpenAI
+	}
+
+	providersMu.RLock()
+	factory, ok := providers[name]
+	providersMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown chat provider: %s, expected one of %s", config.Provider, strings.Join(Providers(), ", "))
+	}
+
+	return factory(config)
+}
+
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	var names []string
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
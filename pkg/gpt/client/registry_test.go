@@ -0,0 +1,61 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNewProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ProviderConfig
+		want    string
+		wantErr bool
+	}{
+		{name: "openai by default", config: ProviderConfig{APIKey: "key"}, want: "*client.ChatClient"},
+		{name: "case insensitive", config: ProviderConfig{Provider: "OpenAI"}, want: "*client.ChatClient"},
+		{name: "azure", config: ProviderConfig{Provider: ProviderAzure, BaseURL: "https://example.openai.azure.com/openai/deployments/gpt-4"}, want: "*client.ChatClient"},
+		{name: "azure without a base url", config: ProviderConfig{Provider: ProviderAzure}, wantErr: true},
+		{name: "anthropic", config: ProviderConfig{Provider: ProviderAnthropic, APIKey: "key"}, want: "*client.AnthropicChatClient"},
+		{name: "anthropic without an api key", config: ProviderConfig{Provider: ProviderAnthropic}, wantErr: true},
+		{name: "fake", config: ProviderConfig{Provider: ProviderFake}, want: "*client.FakeChatClient"},
+		{name: "unknown", config: ProviderConfig{Provider: "parrot"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chatClient, err := NewProvider(tt.config)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("NewProvider() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewProvider() error = %v", err)
+			}
+			if got := typeName(chatClient); got != tt.want {
+				t.Errorf("NewProvider() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterProvider(t *testing.T) {
+	fake := NewFakeChatClient()
+	RegisterProvider("Local", func(config ProviderConfig) (ChatClientInterface, error) {
+		return fake, nil
+	})
+
+	chatClient, err := NewProvider(ProviderConfig{Provider: "local"})
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	if chatClient != fake {
+		t.Errorf("NewProvider() did not use the registered factory")
+	}
+}
+
+func typeName(value interface{}) string {
+	return fmt.Sprintf("%T", value)
+}
@@ -10,6 +10,10 @@ const (
 	FinishReasonStop      = "stop"
 	FinishReasonMaxLength = "max_length"
 	FinishReasonMaxTokens = "max_tokens"
+
+	// Response Formats
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object"
 )
 
 // Message represents a single message in a conversation.
@@ -18,10 +22,32 @@ type Message struct {
 	Content string `json:"content"`
 }
 
+// ResponseFormat constrains the format of the completion.
+type ResponseFormat struct {
+	Type string `json:"type"`
+}
+
 // CompletionRequest represents the request body for a ChatGPT API call.
 type CompletionRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+	Model          string          `json:"model"`
+	Messages       []Message       `json:"messages"`
+	Temperature    *float64        `json:"temperature,omitempty"`
+	TopP           *float64        `json:"top_p,omitempty"`
+	MaxTokens      int             `json:"max_tokens,omitempty"`
+	Stop           []string        `json:"stop,omitempty"`
+	Seed           *int            `json:"seed,omitempty"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+// CompletionOptions tunes a single chat call, zero values fall back to the provider defaults.
+type CompletionOptions struct {
+	Model          string
+	Temperature    *float64
+	TopP           *float64
+	MaxTokens      int
+	Stop           []string
+	Seed           *int
+	ResponseFormat string
 }
 
 // CompletionResponseChoice represents a choice in the completion response.
@@ -31,7 +57,15 @@ type CompletionResponseChoice struct {
 	Index        int     `json:"index"`
 }
 
+// CompletionResponseUsage represents the tokens used by a ChatGPT API call.
+type CompletionResponseUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
 // CompletionResponse represents the response body from a ChatGPT API call.
 type CompletionResponse struct {
 	Choices []CompletionResponseChoice `json:"choices"`
+	Usage   CompletionResponseUsage    `json:"usage"`
 }
@@ -0,0 +1,110 @@
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/atomicfile"
+)
+
+// mutexPoll is how often a locked mutex file is retried.
+const mutexPoll = 10 * time.Millisecond
+
+// FileLocker keeps leases in a JSON file shared by every process that can reach it, such as
+// replicas mounting the same volume. Each change reads and rewrites the file while holding an
+// exclusive flock on a mutex file next to it, the volume has to support flock.
+type FileLocker struct {
+	path string
+}
+
+func NewFileLocker(path string) *FileLocker {
+	return &FileLocker{path: path}
+}
+
+func (l *FileLocker) Acquire(ctx context.Context, key string, holder string, ttl time.Duration) error {
+	return l.update(ctx, func(leases map[string]entry, now time.Time) error {
+		return acquire(leases, key, holder, ttl, now)
+	})
+}
+
+func (l *FileLocker) Release(ctx context.Context, key string, holder string) error {
+	return l.update(ctx, func(leases map[string]entry, now time.Time) error {
+		release(leases, key, holder, now)
+		return nil
+	})
+}
+
+// update applies the change to the leases in the file, it is not written when the change fails.
+func (l *FileLocker) update(ctx context.Context, change func(leases map[string]entry, now time.Time) error) error {
+	unlock, err := l.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	leases := make(map[string]entry)
+
+	bytes, err := os.ReadFile(l.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error reading lease file: %w", err)
+	}
+	if len(bytes) > 0 {
+		if err := json.Unmarshal(bytes, &leases); err != nil {
+			return fmt.Errorf("error unmarshalling lease file: %w", err)
+		}
+	}
+
+	if err := change(leases, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	return l.write(leases)
+}
+
+// lock flocks the mutex file, waiting while another process holds it. The mutex file is never
+// removed, the kernel drops the flock when its holder closes it or exits, so a crashed process
+// cannot leave it locked.
+func (l *FileLocker) lock(ctx context.Context) (func(), error) {
+	file, err := os.OpenFile(l.path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lease mutex: %w", err)
+	}
+
+	for {
+		err := tryLock(file)
+		if err == nil {
+			return func() {
+				unlock(file)
+				file.Close()
+			}, nil
+		}
+		if !errors.Is(err, errLocked) {
+			file.Close()
+			return nil, fmt.Errorf("error locking lease mutex: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, ctx.Err()
+		case <-time.After(mutexPoll):
+		}
+	}
+}
+
+func (l *FileLocker) write(leases map[string]entry) error {
+	bytes, err := json.Marshal(leases)
+	if err != nil {
+		return fmt.Errorf("error marshalling leases: %w", err)
+	}
+
+	if err := atomicfile.Write(l.path, bytes); err != nil {
+		return fmt.Errorf("error writing lease file: %w", err)
+	}
+
+	return nil
+}
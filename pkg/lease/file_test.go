@@ -0,0 +1,89 @@
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileLockerSerialisesProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leases.json")
+
+	// each locker opens the mutex itself, as separate processes do
+	const holders = 50
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make(chan error, holders)
+	for i := 0; i < holders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs <- NewFileLocker(path).Acquire(context.Background(), fmt.Sprintf("key-%d", i), "holder", time.Minute)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Acquire() error = %v", err)
+		}
+	}
+
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var leases map[string]entry
+	if err := json.Unmarshal(bytes, &leases); err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != holders {
+		t.Errorf("leases = %d, want %d, an update was lost", len(leases), holders)
+	}
+}
+
+func TestFileLockerIgnoresMutexLeftByACrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leases.json")
+
+	// a process that crashed leaves the mutex file behind but no flock on it
+	if err := os.WriteFile(path+".lock", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := NewFileLocker(path).Acquire(ctx, "leader", "replica-1", time.Minute); err != nil {
+		t.Errorf("Acquire() error = %v, want nil", err)
+	}
+}
+
+func TestFileLockerWaitsForTheMutex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leases.json")
+	locker := NewFileLocker(path)
+
+	unlock, err := locker.lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := NewFileLocker(path).Acquire(ctx, "leader", "replica-1", time.Minute); err != context.DeadlineExceeded {
+		t.Errorf("Acquire() while the mutex is held error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	unlock()
+
+	if err := NewFileLocker(path).Acquire(context.Background(), "leader", "replica-1", time.Minute); err != nil {
+		t.Errorf("Acquire() after the mutex is released error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package lease
+
+import (
+	"errors"
+	"os"
+)
+
+// errLocked is returned by tryLock when another open file holds the flock.
+var errLocked = errors.New("mutex is locked")
+
+func tryLock(file *os.File) error {
+	return errors.New("file leases need flock, which this platform does not support")
+}
+
+func unlock(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,134 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/logging"
+	"github.com/go-co-op/gocron"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultTTL is how long a lease is held without being renewed.
+const DefaultTTL = time.Minute
+
+// ErrHeld is returned when another holder has an unexpired lease on the key.
+var ErrHeld = errors.New("lease is held")
+
+// Locker hands out exclusive leases by key that expire unless renewed, so a holder that dies
+// cannot keep a key forever. MemoryLocker serves a single process and FileLocker processes
+// sharing a volume, a Kubernetes Lease or a Postgres advisory lock fit the same interface.
+type Locker interface {
+	// Acquire takes or renews the lease on the key for the holder, it returns ErrHeld when
+	// another holder has an unexpired lease.
+	Acquire(ctx context.Context, key string, holder string, ttl time.Duration) error
+	// Release gives up the holder's lease on the key, releasing a lease that is not held is not an error.
+	Release(ctx context.Context, key string, holder string) error
+}
+
+// entry is a lease on a key.
+type entry struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// acquire applies Acquire to the leases and drops expired ones.
+func acquire(leases map[string]entry, key string, holder string, ttl time.Duration, now time.Time) error {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	prune(leases, now)
+
+	if current, ok := leases[key]; ok && current.Holder != holder && current.ExpiresAt.After(now) {
+		return fmt.Errorf("%w: %s by %s until %s", ErrHeld, key, current.Holder, current.ExpiresAt.Format(time.RFC3339))
+	}
+
+	leases[key] = entry{Holder: holder, ExpiresAt: now.Add(ttl)}
+
+	return nil
+}
+
+// release applies Release to the leases and drops expired ones.
+func release(leases map[string]entry, key string, holder string, now time.Time) {
+	if current, ok := leases[key]; ok && current.Holder == holder {
+		delete(leases, key)
+	}
+
+	prune(leases, now)
+}
+
+func prune(leases map[string]entry, now time.Time) {
+	for key, current := range leases {
+		if !current.ExpiresAt.After(now) {
+			delete(leases, key)
+		}
+	}
+}
+
+// Elector makes the holder of the key's lease the leader, it implements gocron.Elector so
+// only the leader's scheduler runs jobs. Each check renews the lease, Renew keeps checking
+// between jobs. A replica that stops checking loses the lease once the TTL passes.
+type Elector struct {
+	Locker Locker
+	Key    string
+	Holder string
+	TTL    time.Duration
+	// OnElected, when set, is called in its own goroutine each time a check takes the lease
+	// the holder did not have, such as to catch up on what changed while another replica led.
+	OnElected func()
+
+	mu      sync.Mutex
+	leading bool
+}
+
+var _ gocron.Elector = (*Elector)(nil)
+
+func (e *Elector) IsLeader(ctx context.Context) error {
+	err := e.Locker.Acquire(ctx, e.Key, e.Holder, e.TTL)
+
+	e.mu.Lock()
+	elected := err == nil && !e.leading
+	e.leading = err == nil
+	e.mu.Unlock()
+
+	if elected && e.OnElected != nil {
+		go e.OnElected()
+	}
+
+	return err
+}
+
+// Renew checks every third of the TTL until ctx is done, so the leader keeps its lease however
+// far apart its jobs are and another replica takes over once the leader is gone. The lease is
+// released when ctx is done, a replica shutting down hands over without waiting for the TTL.
+func (e *Elector) Renew(ctx context.Context) {
+	ttl := e.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		if err := e.IsLeader(ctx); err != nil && !errors.Is(err, ErrHeld) && ctx.Err() == nil {
+			logging.Logger.Error(fmt.Sprintf("error renewing lease %s", e.Key), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := e.Locker.Release(context.Background(), e.Key, e.Holder); err != nil {
+				logging.Logger.Error(fmt.Sprintf("error releasing lease %s", e.Key), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+			}
+			e.mu.Lock()
+			e.leading = false
+			e.mu.Unlock()
+			return
+		case <-ticker.C:
+		}
+	}
+}
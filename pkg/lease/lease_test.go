@@ -0,0 +1,196 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func lockers(t *testing.T) map[string]Locker {
+	return map[string]Locker{
+		"memory": NewMemoryLocker(),
+		"file":   NewFileLocker(filepath.Join(t.TempDir(), "leases.json")),
+	}
+}
+
+func TestLocker(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+
+	for name, locker := range lockers(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			if err := locker.Acquire(ctx, "key", "holder-1", ttl); err != nil {
+				t.Fatalf("Acquire() error = %v", err)
+			}
+			if err := locker.Acquire(ctx, "key", "holder-1", ttl); err != nil {
+				t.Errorf("renewing Acquire() error = %v, want nil", err)
+			}
+			if err := locker.Acquire(ctx, "key", "holder-2", ttl); !errors.Is(err, ErrHeld) {
+				t.Errorf("Acquire() of a held key error = %v, want %v", err, ErrHeld)
+			}
+			if err := locker.Acquire(ctx, "other", "holder-2", ttl); err != nil {
+				t.Errorf("Acquire() of another key error = %v, want nil", err)
+			}
+
+			// only the holder releases its lease
+			if err := locker.Release(ctx, "key", "holder-2"); err != nil {
+				t.Errorf("Release() by another holder error = %v, want nil", err)
+			}
+			if err := locker.Acquire(ctx, "key", "holder-2", ttl); !errors.Is(err, ErrHeld) {
+				t.Errorf("Acquire() after another holder released error = %v, want %v", err, ErrHeld)
+			}
+			if err := locker.Release(ctx, "key", "holder-1"); err != nil {
+				t.Errorf("Release() error = %v", err)
+			}
+			if err := locker.Acquire(ctx, "key", "holder-2", ttl); err != nil {
+				t.Errorf("Acquire() after release error = %v, want nil", err)
+			}
+
+			// an expired lease goes to the next holder
+			time.Sleep(2 * ttl)
+			if err := locker.Acquire(ctx, "key", "holder-1", ttl); err != nil {
+				t.Errorf("Acquire() after expiry error = %v, want nil", err)
+			}
+
+			if err := locker.Release(ctx, "missing", "holder-1"); err != nil {
+				t.Errorf("Release() of a missing lease error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestFileLockerSharesLeases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leases.json")
+
+	if err := NewFileLocker(path).Acquire(context.Background(), "key", "replica-1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// another replica reaching the same file sees the lease
+	if err := NewFileLocker(path).Acquire(context.Background(), "key", "replica-2", time.Minute); !errors.Is(err, ErrHeld) {
+		t.Errorf("Acquire() error = %v, want %v", err, ErrHeld)
+	}
+}
+
+func TestElector(t *testing.T) {
+	for name, locker := range lockers(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			leader := &Elector{Locker: locker, Key: "leader", Holder: "replica-1", TTL: 50 * time.Millisecond}
+			follower := &Elector{Locker: locker, Key: "leader", Holder: "replica-2", TTL: 50 * time.Millisecond}
+
+			if err := leader.IsLeader(ctx); err != nil {
+				t.Fatalf("leader IsLeader() error = %v", err)
+			}
+			if err := follower.IsLeader(ctx); !errors.Is(err, ErrHeld) {
+				t.Errorf("follower IsLeader() error = %v, want %v", err, ErrHeld)
+			}
+
+			// a leader that stops checking loses the lease once the TTL passes
+			time.Sleep(2 * leader.TTL)
+			if err := follower.IsLeader(ctx); err != nil {
+				t.Errorf("follower IsLeader() after the TTL error = %v, want nil", err)
+			}
+			if err := leader.IsLeader(ctx); !errors.Is(err, ErrHeld) {
+				t.Errorf("former leader IsLeader() error = %v, want %v", err, ErrHeld)
+			}
+		})
+	}
+}
+
+func TestElectorRenewKeepsAndHandsOverTheLease(t *testing.T) {
+	locker := NewMemoryLocker()
+	leader := &Elector{Locker: locker, Key: "leader", Holder: "replica-1", TTL: 60 * time.Millisecond}
+	follower := &Elector{Locker: locker, Key: "leader", Holder: "replica-2", TTL: 60 * time.Millisecond}
+
+	if err := leader.IsLeader(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		leader.Renew(ctx)
+	}()
+
+	// the leader runs no jobs, the lease outlives several TTLs anyway
+	deadline := time.Now().Add(4 * leader.TTL)
+	for time.Now().Before(deadline) {
+		if err := follower.IsLeader(context.Background()); !errors.Is(err, ErrHeld) {
+			cancel()
+			t.Fatalf("follower IsLeader() error = %v, want %v", err, ErrHeld)
+		}
+		time.Sleep(leader.TTL / 4)
+	}
+
+	cancel()
+	<-done
+
+	// the lease is released, the follower does not wait for it to expire
+	if err := follower.IsLeader(context.Background()); err != nil {
+		t.Errorf("follower IsLeader() after the leader stopped error = %v, want nil", err)
+	}
+}
+
+func TestElectorOnElected(t *testing.T) {
+	locker := NewMemoryLocker()
+	elected := make(chan string, 4)
+	elector := func(holder string) *Elector {
+		return &Elector{Locker: locker, Key: "leader", Holder: holder, TTL: 50 * time.Millisecond, OnElected: func() { elected <- holder }}
+	}
+	leader, follower := elector("replica-1"), elector("replica-2")
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case holder := <-elected:
+			if holder != want {
+				t.Errorf("elected %s, want %s", holder, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s was not elected", want)
+		}
+	}
+
+	ctx := context.Background()
+	if err := leader.IsLeader(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expect("replica-1")
+
+	// renewing the lease is not an election
+	if err := leader.IsLeader(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := follower.IsLeader(ctx); !errors.Is(err, ErrHeld) {
+		t.Fatalf("follower IsLeader() error = %v, want %v", err, ErrHeld)
+	}
+
+	// the follower takes over once the lease expires, and the former leader is elected again
+	// when it gets the lease back
+	time.Sleep(2 * leader.TTL)
+	if err := follower.IsLeader(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expect("replica-2")
+	if err := leader.IsLeader(ctx); !errors.Is(err, ErrHeld) {
+		t.Fatalf("former leader IsLeader() error = %v, want %v", err, ErrHeld)
+	}
+	if err := locker.Release(ctx, "leader", "replica-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := leader.IsLeader(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expect("replica-1")
+
+	select {
+	case holder := <-elected:
+		t.Errorf("elected %s again, want one election per lease taken", holder)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,35 @@
+package lease
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLocker holds leases in memory, it only excludes holders within one process.
+type MemoryLocker struct {
+	mu     sync.Mutex
+	leases map[string]entry
+}
+
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{
+		leases: make(map[string]entry),
+	}
+}
+
+func (l *MemoryLocker) Acquire(ctx context.Context, key string, holder string, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return acquire(l.leases, key, holder, ttl, time.Now().UTC())
+}
+
+func (l *MemoryLocker) Release(ctx context.Context, key string, holder string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	release(l.leases, key, holder, time.Now().UTC())
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package normalise
+
+import "strings"
+
+// CommentSyntax describes how a language writes comments and strings, so comment markers
+// inside strings are left alone.
+type CommentSyntax struct {
+	Line       []string
+	BlockStart string
+	BlockEnd   string
+	Quotes     []string
+	// TripleQuotes treats """ and ''' as strings that span lines, as in Python.
+	TripleQuotes bool
+	// FullLineOnly only strips lines that are entirely a comment, for languages such as
+	// YAML and shell where a marker mid line is too often part of a value.
+	FullLineOnly bool
+	// Directives are line comments that change how the code builds, such as //go:build, they
+	// are never stripped.
+	Directives []string
+}
+
+// StripComments removes comments, lines left empty by the removal are dropped. A shebang,
+// directives and the comments leading the file, such as a package doc, are kept.
+func StripComments(syntax *CommentSyntax) Step {
+	return func(content string) string {
+		leading, content := splitLeadingComments(content, syntax)
+		if content == "" {
+			return leading
+		}
+
+		var stripped string
+		if syntax.FullLineOnly {
+			stripped = stripFullLineComments(content, syntax)
+		} else {
+			stripped = stripInlineComments(content, syntax)
+		}
+
+		return leading + dropEmptiedLines(content, stripped)
+	}
+}
+
+// splitLeadingComments splits the shebang and the comment blocks and blank lines before the
+// first line of code from the rest of the content.
+func splitLeadingComments(content string, syntax *CommentSyntax) (string, string) {
+	lines := strings.Split(content, "\n")
+
+	end := 0
+	if strings.HasPrefix(content, "#!") {
+		end = 1
+	}
+
+	for {
+		begin := end
+		for begin < len(lines) && strings.TrimSpace(lines[begin]) == "" {
+			begin++
+		}
+
+		blockEnd := headerEnd(lines, begin, syntax)
+		if blockEnd < 0 {
+			break
+		}
+		end = blockEnd
+	}
+
+	if end == 0 {
+		return "", content
+	}
+	if end >= len(lines) {
+		return content, ""
+	}
+
+	return strings.Join(lines[:end], "\n") + "\n", strings.Join(lines[end:], "\n")
+}
+
+func stripFullLineComments(content string, syntax *CommentSyntax) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if hasAnyPrefix(trimmed, syntax.Line) && !hasAnyPrefix(trimmed, syntax.Directives) {
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stripInlineComments walks the content once, tracking strings so only real comments are removed.
+// Block comments are replaced by their newlines so the lines still line up with the original.
+func stripInlineComments(content string, syntax *CommentSyntax) string {
+	var b strings.Builder
+	b.Grow(len(content))
+
+	var quote string
+	for i := 0; i < len(content); {
+		rest := content[i:]
+
+		if quote != "" {
+			switch {
+			case strings.HasPrefix(rest, quote):
+				b.WriteString(quote)
+				i += len(quote)
+				quote = ""
+			case rest[0] == '\\' && quote != "`" && len(rest) > 1:
+				b.WriteString(rest[:2])
+				i += 2
+			case rest[0] == '\n' && len(quote) == 1 && quote != "`":
+				// an unterminated single line string, such as an apostrophe, ends with the line
+				b.WriteByte('\n')
+				i++
+				quote = ""
+			default:
+				b.WriteByte(rest[0])
+				i++
+			}
+			continue
+		}
+
+		if syntax.BlockStart != "" && strings.HasPrefix(rest, syntax.BlockStart) {
+			comment := rest
+			if end := strings.Index(rest[len(syntax.BlockStart):], syntax.BlockEnd); end >= 0 {
+				comment = rest[:len(syntax.BlockStart)+end+len(syntax.BlockEnd)]
+			}
+			b.WriteString(strings.Repeat("\n", strings.Count(comment, "\n")))
+			i += len(comment)
+			continue
+		}
+
+		if hasAnyPrefix(rest, syntax.Line) && !hasAnyPrefix(rest, syntax.Directives) {
+			end := strings.Index(rest, "\n")
+			if end < 0 {
+				break
+			}
+			i += end
+			continue
+		}
+
+		if q := openingQuote(rest, syntax); q != "" {
+			quote = q
+			b.WriteString(q)
+			i += len(q)
+			continue
+		}
+
+		b.WriteByte(rest[0])
+		i++
+	}
+
+	return b.String()
+}
+
+func openingQuote(rest string, syntax *CommentSyntax) string {
+	if syntax.TripleQuotes {
+		for _, triple := range []string{`"""`, `'''`} {
+			if strings.HasPrefix(rest, triple) {
+				return triple
+			}
+		}
+	}
+	for _, quote := range syntax.Quotes {
+		if strings.HasPrefix(rest, quote) {
+			return quote
+		}
+	}
+	return ""
+}
+
+// dropEmptiedLines removes the lines that only became blank because a comment was stripped.
+func dropEmptiedLines(original string, stripped string) string {
+	originalLines := strings.Split(original, "\n")
+	strippedLines := strings.Split(stripped, "\n")
+	if len(originalLines) != len(strippedLines) {
+		return stripped
+	}
+
+	var out []string
+	for i, line := range strippedLines {
+		if strings.TrimSpace(line) == "" && strings.TrimSpace(originalLines[i]) != "" {
+			continue
+		}
+		out = append(out, strings.TrimRight(line, " \t"))
+	}
+
+	return strings.Join(out, "\n")
+}
+
+var licenseMarkers = []string{"copyright", "license", "licence", "spdx-license-identifier"}
+
+// RemoveLicenseHeader drops a comment block at the top of the file that mentions a copyright or license.
+func RemoveLicenseHeader(syntax *CommentSyntax) Step {
+	return func(content string) string {
+		lines := strings.Split(content, "\n")
+
+		start := 0
+		if len(lines) > 0 && strings.HasPrefix(lines[0], "#!") {
+			start = 1
+		}
+
+		begin := start
+		for begin < len(lines) && strings.TrimSpace(lines[begin]) == "" {
+			begin++
+		}
+
+		end := headerEnd(lines, begin, syntax)
+		if end < 0 {
+			return content
+		}
+
+		header := strings.ToLower(strings.Join(lines[begin:end], "\n"))
+		if !containsAny(header, licenseMarkers) {
+			return content
+		}
+
+		return strings.Join(append(lines[:start:start], lines[end:]...), "\n")
+	}
+}
+
+// headerEnd returns the index of the first line after the comment block starting at begin, or -1.
+func headerEnd(lines []string, begin int, syntax *CommentSyntax) int {
+	if begin >= len(lines) {
+		return -1
+	}
+
+	first := strings.TrimSpace(lines[begin])
+
+	if syntax.BlockStart != "" && strings.HasPrefix(first, syntax.BlockStart) {
+		if strings.Contains(first[len(syntax.BlockStart):], syntax.BlockEnd) {
+			return begin + 1
+		}
+		for i := begin + 1; i < len(lines); i++ {
+			if strings.Contains(lines[i], syntax.BlockEnd) {
+				return i + 1
+			}
+		}
+		return -1
+	}
+
+	if !hasAnyPrefix(first, syntax.Line) {
+		return -1
+	}
+
+	end := begin
+	for end < len(lines) && hasAnyPrefix(strings.TrimSpace(lines[end]), syntax.Line) {
+		end++
+	}
+	return end
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package normalise
+
+import "testing"
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		name    string
+		syntax  *CommentSyntax
+		content string
+		want    string
+	}{
+		{
+			name:    "package doc and build tags",
+			syntax:  cStyleComments,
+			content: "//go:build linux\n// +build linux\n\n// Package demo says hello.\npackage demo\n\n// greeting is said.\nconst greeting = \"hi // there\" // inline\n",
+			want:    "//go:build linux\n// +build linux\n\n// Package demo says hello.\npackage demo\n\nconst greeting = \"hi // there\"\n",
+		},
+		{
+			name:    "directives in the body",
+			syntax:  cStyleComments,
+			content: "package demo\n\nimport _ \"embed\"\n\n// banner is embedded.\n//go:embed banner.txt\nvar banner string\n",
+			want:    "package demo\n\nimport _ \"embed\"\n\n//go:embed banner.txt\nvar banner string\n",
+		},
+		{
+			name:    "block comments",
+			syntax:  cStyleComments,
+			content: "/* leading */\nint a; /* trailing */\n/*\n * block\n */\nint b;\n",
+			want:    "/* leading */\nint a;\nint b;\n",
+		},
+		{
+			name:    "shebang and full line comments",
+			syntax:  hashComments,
+			content: "#!/bin/sh\n# usage: run\n\necho \"#1\" # kept mid line\n# dropped\nexit 0\n",
+			want:    "#!/bin/sh\n# usage: run\n\necho \"#1\" # kept mid line\nexit 0\n",
+		},
+		{
+			name:    "only comments",
+			syntax:  cStyleComments,
+			content: "// nothing but a comment\n",
+			want:    "// nothing but a comment\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripComments(tt.syntax)(tt.content); got != tt.want {
+				t.Errorf("StripComments() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package normalise
+
+var (
+	cStyleComments = &CommentSyntax{
+		Line:       []string{"//"},
+		BlockStart: "/*",
+		BlockEnd:   "*/",
+		Quotes:     []string{`"`, "'", "`"},
+		Directives: []string{"//go:", "// +build"},
+	}
+	// rustComments leaves out the single quote, lifetimes would read as unterminated strings.
+	rustComments = &CommentSyntax{
+		Line:       []string{"//"},
+		BlockStart: "/*",
+		BlockEnd:   "*/",
+		Quotes:     []string{`"`},
+	}
+	pythonComments = &CommentSyntax{
+		Line:         []string{"#"},
+		Quotes:       []string{`"`, "'"},
+		TripleQuotes: true,
+	}
+	hashComments = &CommentSyntax{
+		Line:         []string{"#"},
+		FullLineOnly: true,
+	}
+	sqlComments = &CommentSyntax{
+		Line:       []string{"--"},
+		BlockStart: "/*",
+		BlockEnd:   "*/",
+		Quotes:     []string{"'", `"`},
+	}
+	markupComments = &CommentSyntax{
+		BlockStart: "<!--",
+		BlockEnd:   "-->",
+	}
+	cssComments = &CommentSyntax{
+		BlockStart: "/*",
+		BlockEnd:   "*/",
+		Quotes:     []string{`"`, "'"},
+	}
+)
+
+type language struct {
+	keys     []string
+	comments *CommentSyntax
+	minify   Step
+}
+
+// languages lists the file extensions and names with a dedicated pipeline, anything else only
+// has its whitespace collapsed.
+var languages = []language{
+	{
+		keys:     []string{".go", ".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".java", ".c", ".h", ".cpp", ".cc", ".hpp", ".cs", ".swift", ".kt", ".kts", ".scala", ".dart", ".groovy", ".proto", "jenkinsfile"},
+		comments: cStyleComments,
+	},
+	{
+		keys:     []string{".rs"},
+		comments: rustComments,
+	},
+	{
+		keys:     []string{".py"},
+		comments: pythonComments,
+	},
+	{
+		keys:     []string{".rb", ".sh", ".bash", ".zsh", ".yaml", ".yml", ".toml", ".tf", ".r", ".ex", ".exs", ".pl", "dockerfile", "makefile", ".gitignore", ".dockerignore"},
+		comments: hashComments,
+	},
+	{
+		keys:     []string{".sql"},
+		comments: sqlComments,
+	},
+	{
+		keys:     []string{".html", ".htm", ".xml", ".vue", ".svelte"},
+		comments: markupComments,
+	},
+	{
+		keys:     []string{".scss", ".less"},
+		comments: cssComments,
+	},
+	{
+		keys:     []string{".css"},
+		comments: cssComments,
+		minify:   MinifyCSS,
+	},
+	{
+		keys:   []string{".json"},
+		minify: MinifyJSON,
+	},
+}
@@ -0,0 +1,128 @@
+package normalise
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// MinifyJSON compacts valid JSON, anything else only has its whitespace collapsed.
+func MinifyJSON(content string) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, []byte(content)); err != nil {
+		return CollapseWhitespace(content)
+	}
+	return b.String()
+}
+
+// MinifyCSS puts the stylesheet on one line with the spaces around punctuation removed,
+// quoted strings such as content values and font names are kept as they are. The spaces around
+// a colon are only removed in declarations, in a selector they separate a pseudo-class.
+func MinifyCSS(content string) string {
+	var b strings.Builder
+	b.Grow(len(content))
+
+	for len(content) > 0 {
+		start := strings.IndexAny(content, `"'`)
+		if start < 0 {
+			b.WriteString(minifyCSSCode(content, ""))
+			break
+		}
+
+		end := quotedEnd(content, start)
+		b.WriteString(minifyCSSCode(content[:start], content[start:]))
+		b.WriteString(content[start:end])
+		content = content[end:]
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// minifyCSSCode minifies stylesheet outside quoted strings, followed by the rest of the
+// stylesheet. A space at either end is kept as one space so a value is not joined to the string
+// next to it.
+func minifyCSSCode(code string, rest string) string {
+	code = trimDeclarationColons(code, rest)
+	minified := strings.Join(strings.Fields(code), " ")
+	if minified == "" {
+		if code != "" {
+			return " "
+		}
+		return ""
+	}
+
+	if strings.TrimLeft(code, " \t\r\n") != code {
+		minified = " " + minified
+	}
+	if strings.TrimRight(code, " \t\r\n") != code {
+		minified += " "
+	}
+
+	for _, punctuation := range []string{"{", "}", ";", ",", ">"} {
+		minified = strings.ReplaceAll(minified, " "+punctuation, punctuation)
+		minified = strings.ReplaceAll(minified, punctuation+" ", punctuation)
+	}
+	minified = strings.ReplaceAll(minified, ";}", "}")
+	return minified
+}
+
+// trimDeclarationColons removes the whitespace around the colons of code that separate a
+// property from its value.
+func trimDeclarationColons(code string, rest string) string {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(code, ':')
+		if i < 0 {
+			b.WriteString(code)
+			return b.String()
+		}
+
+		if !inDeclaration(code[i+1:], rest) {
+			b.WriteString(code[:i+1])
+			code = code[i+1:]
+			continue
+		}
+
+		b.WriteString(strings.TrimRight(code[:i], " \t\r\n"))
+		b.WriteByte(':')
+		code = strings.TrimLeft(code[i+1:], " \t\r\n")
+	}
+}
+
+// inDeclaration reports whether a colon followed by code and then the rest of the stylesheet is
+// in a declaration, which ends at a ; or }, rather than a selector or at-rule, which opens a
+// block at a {.
+func inDeclaration(code string, rest string) bool {
+	if i := strings.IndexAny(code, "{;}"); i >= 0 {
+		return code[i] != '{'
+	}
+
+	for i := 0; i < len(rest); i++ {
+		switch rest[i] {
+		case '"', '\'':
+			i = quotedEnd(rest, i) - 1
+		case '{':
+			return false
+		case ';', '}':
+			return true
+		}
+	}
+	return true
+}
+
+// quotedEnd returns the index after the string opening at start, an unterminated string ends
+// with its line.
+func quotedEnd(content string, start int) int {
+	quote := content[start]
+	for i := start + 1; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		case '\n':
+			return i
+		}
+	}
+	return len(content)
+}
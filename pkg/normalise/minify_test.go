@@ -0,0 +1,45 @@
+package normalise
+
+import "testing"
+
+func TestMinifyCSS(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "rules",
+			content: "a > b ,\n  c {\n  color: red ;\n  margin: 0 auto;\n}\n",
+			want:    "a>b,c{color:red;margin:0 auto}",
+		},
+		{
+			name:    "quoted values",
+			content: "a::before {\n  content: \"a: b; c { d }\";\n  font-family: 'Open  Sans', serif;\n}\n",
+			want:    "a::before{content:\"a: b; c { d }\";font-family:'Open  Sans',serif}",
+		},
+		{
+			name:    "escaped quote",
+			content: "q { quotes: \"\\\" , \" '\\' ;'; }",
+			want:    "q{quotes:\"\\\" , \" '\\' ;'}",
+		},
+		{
+			name:    "string next to a value",
+			content: "a { content: \"x\" attr(title) \"y\"; }",
+			want:    "a{content:\"x\" attr(title) \"y\"}",
+		},
+		{
+			name:    "pseudo-classes",
+			content: "a :hover ,\nli : first-child {\n  color : red;\n}\n@media (min-width: 600px) {\n  a[title=\"x\"] :focus { margin : 0; }\n}\n",
+			want:    "a :hover,li : first-child{color:red}@media (min-width: 600px){a[title=\"x\"] :focus{margin:0}}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MinifyCSS(tt.content); got != tt.want {
+				t.Errorf("MinifyCSS() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
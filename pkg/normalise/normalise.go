@@ -0,0 +1,112 @@
+package normalise
+
+import (
+	"path"
+	"strings"
+)
+
+// Step transforms the contents of a file.
+type Step func(content string) string
+
+// Pipeline runs its steps in order.
+type Pipeline []Step
+
+func (p Pipeline) Run(content string) string {
+	for _, step := range p {
+		content = step(content)
+	}
+	return content
+}
+
+// Options toggles the steps that lose information, whitespace is always collapsed.
+type Options struct {
+	StripComments        bool
+	RemoveLicenseHeaders bool
+	Minify               bool
+}
+
+func DefaultOptions() Options {
+	return Options{
+		StripComments:        true,
+		RemoveLicenseHeaders: true,
+		Minify:               true,
+	}
+}
+
+// Normaliser picks a pipeline for a file by its extension or name, so the model sees
+// readable code with the noise taken out.
+type Normaliser struct {
+	pipelines map[string]Pipeline
+	fallback  Pipeline
+}
+
+func NewNormaliser(options Options) *Normaliser {
+	n := &Normaliser{
+		pipelines: make(map[string]Pipeline),
+		fallback:  Pipeline{CollapseWhitespace},
+	}
+
+	for _, language := range languages {
+		pipeline := Pipeline{}
+		if options.RemoveLicenseHeaders && language.comments != nil {
+			pipeline = append(pipeline, RemoveLicenseHeader(language.comments))
+		}
+		if options.StripComments && language.comments != nil {
+			pipeline = append(pipeline, StripComments(language.comments))
+		}
+		if options.Minify && language.minify != nil {
+			pipeline = append(pipeline, language.minify)
+		} else {
+			pipeline = append(pipeline, CollapseWhitespace)
+		}
+
+		for _, key := range language.keys {
+			n.pipelines[key] = pipeline
+		}
+	}
+
+	return n
+}
+
+// Register sets the pipeline for an extension such as ".go" or a file name such as "Dockerfile".
+func (n *Normaliser) Register(key string, pipeline Pipeline) {
+	n.pipelines[strings.ToLower(key)] = pipeline
+}
+
+func (n *Normaliser) Normalise(filePath string, content string) string {
+	return n.pipeline(filePath).Run(content)
+}
+
+func (n *Normaliser) pipeline(filePath string) Pipeline {
+	name := strings.ToLower(path.Base(filePath))
+	if pipeline, ok := n.pipelines[name]; ok {
+		return pipeline
+	}
+	if pipeline, ok := n.pipelines[path.Ext(name)]; ok {
+		return pipeline
+	}
+	return n.fallback
+}
+
+// CollapseWhitespace trims trailing whitespace and squashes runs of blank lines into one,
+// indentation and line structure are kept.
+func CollapseWhitespace(content string) string {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	var out []string
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			if !blank && len(out) > 0 {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, line)
+	}
+
+	return strings.TrimRight(strings.Join(out, "\n"), "\n")
+}
@@ -0,0 +1,88 @@
+package normalise
+
+import "testing"
+
+func TestNormalise(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		options Options
+		content string
+		want    string
+	}{
+		{
+			name:    "go drops the license header and comments but not strings",
+			path:    "cmd/main.go",
+			options: DefaultOptions(),
+			content: "// Copyright 2023 Example\n// Licensed under the MIT License.\n\npackage main\n\nfunc main() {\n\t// say hello\n\tprintln(\"http://example.com\") /* inline */\n}\n",
+			want:    "package main\n\nfunc main() {\n\tprintln(\"http://example.com\")\n}",
+		},
+		{
+			name:    "python keeps hashes inside strings",
+			path:    "app.py",
+			options: DefaultOptions(),
+			content: "def main():\n    # a comment\n    print(\"#1\")  # trailing\n",
+			want:    "def main():\n    print(\"#1\")",
+		},
+		{
+			name:    "yaml only strips whole line comments",
+			path:    "config.YML",
+			options: DefaultOptions(),
+			content: "name: app\n# settings\ncolor: \"#fff\" # white\n\n\n\nsize: 2\n",
+			want:    "name: app\ncolor: \"#fff\" # white\n\nsize: 2",
+		},
+		{
+			name:    "dockerfile is matched by name",
+			path:    "build/Dockerfile",
+			options: DefaultOptions(),
+			content: "FROM golang:1.20\n# build the binary\nRUN go build\n",
+			want:    "FROM golang:1.20\nRUN go build",
+		},
+		{
+			name:    "json is compacted",
+			path:    "package.json",
+			options: DefaultOptions(),
+			content: "{\n  \"name\": \"example\",\n  \"private\": true\n}\n",
+			want:    "{\"name\":\"example\",\"private\":true}",
+		},
+		{
+			name:    "invalid json only has its whitespace collapsed",
+			path:    "broken.json",
+			options: DefaultOptions(),
+			content: "{\n  \"name\": \n\n\n}   \n",
+			want:    "{\n  \"name\":\n\n}",
+		},
+		{
+			name:    "unknown files only have their whitespace collapsed",
+			path:    "notes.txt",
+			options: DefaultOptions(),
+			content: "first   \r\n\r\n\r\nsecond // not a comment\n\n",
+			want:    "first\n\nsecond // not a comment",
+		},
+		{
+			name:    "disabled options keep comments and license headers",
+			path:    "main.go",
+			options: Options{},
+			content: "// Licensed under the MIT License.\npackage main // main package\n",
+			want:    "// Licensed under the MIT License.\npackage main // main package",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewNormaliser(tt.options).Normalise(tt.path, tt.content)
+			if got != tt.want {
+				t.Errorf("Normalise() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormaliserRegister(t *testing.T) {
+	n := NewNormaliser(DefaultOptions())
+	n.Register(".TXT", Pipeline{func(content string) string { return "replaced" }})
+
+	if got := n.Normalise("notes.txt", "content"); got != "replaced" {
+		t.Errorf("Normalise() = %q, want the registered pipeline to run", got)
+	}
+}
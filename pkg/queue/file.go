@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/atomicfile"
+)
+
+// FileQueue is a MemoryQueue that writes its jobs to a JSON file on every change, so queued
+// jobs survive a restart.
+type FileQueue struct {
+	*MemoryQueue
+	path string
+}
+
+// NewFileQueue loads the jobs in the file. Jobs that were running when the process stopped
+// have no worker left to finish them, they are queued again straight away.
+func NewFileQueue(path string, options Options) (*FileQueue, error) {
+	q := &FileQueue{
+		MemoryQueue: NewMemoryQueue(options),
+		path:        path,
+	}
+
+	bytes, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error reading queue file: %w", err)
+	}
+
+	if err == nil {
+		var jobs []Job
+		if err := json.Unmarshal(bytes, &jobs); err != nil {
+			return nil, fmt.Errorf("error unmarshalling queue file: %w", err)
+		}
+
+		now := time.Now().UTC()
+		for _, job := range jobs {
+			job := job
+			if job.Status == StatusRunning {
+				job.Status = StatusQueued
+				job.Receipt = ""
+				job.VisibleAt = now
+				job.UpdatedAt = now
+			}
+			q.jobs[job.ID] = &job
+		}
+	}
+
+	q.persist = q.write
+
+	return q, nil
+}
+
+func (q *FileQueue) write(jobs []Job) error {
+	bytes, err := json.Marshal(jobs)
+	if err != nil {
+		return fmt.Errorf("error marshalling jobs: %w", err)
+	}
+
+	if err := atomicfile.Write(q.path, bytes); err != nil {
+		return fmt.Errorf("error writing queue file: %w", err)
+	}
+
+	return nil
+}
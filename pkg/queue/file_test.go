@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileQueueRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+
+	q, err := NewFileQueue(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"job-1", "job-2", "job-3"} {
+		if err := q.Enqueue("jobs", id, []byte(`"`+id+`"`), time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	completed := dequeue(t, q, "jobs")
+	if err := q.Complete(completed.ID, completed.Receipt); err != nil {
+		t.Fatal(err)
+	}
+	running := dequeue(t, q, "jobs")
+
+	// the worker holding job-2 is gone after a restart, it is queued again
+	q, err = NewFileQueue(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := q.Get(running.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != StatusQueued || job.Receipt != "" || job.Attempts != 1 {
+		t.Errorf("running job after restart = %+v, want it queued", job)
+	}
+
+	job, err = q.Get(completed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != StatusSucceeded {
+		t.Errorf("completed job after restart = %+v, want it succeeded", job)
+	}
+
+	// job-3 has been visible the longest, job-2 became visible again on restart
+	for _, want := range []string{"job-3", "job-2"} {
+		if job := dequeue(t, q, "jobs"); job.ID != want || string(job.Payload) != `"`+want+`"` {
+			t.Errorf("Dequeue() = %+v, want %s", job, want)
+		}
+	}
+}
+
+func TestFileQueueEnqueueRollsBackWhenWriteFails(t *testing.T) {
+	// the directory does not exist, so the queue file cannot be written
+	q, err := NewFileQueue(filepath.Join(t.TempDir(), "missing", "queue.json"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Enqueue("jobs", "job-1", nil, time.Time{}); err == nil {
+		t.Fatal("Enqueue() error = nil, want the write error")
+	}
+
+	if _, err := q.Get("job-1"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, ErrJobNotFound)
+	}
+
+	// the failed enqueue does not hold the id
+	q.persist = nil
+	if err := q.Enqueue("jobs", "job-1", nil, time.Time{}); err != nil {
+		t.Errorf("Enqueue() error = %v, want the job enqueued", err)
+	}
+}
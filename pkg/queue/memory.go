@@ -0,0 +1,285 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryQueue is a bounded queue held in memory, its jobs are lost when the process stops.
+type MemoryQueue struct {
+	options Options
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+	// changed is closed and replaced whenever a job may have become visible.
+	changed chan struct{}
+	// persist is called with every job after each change, FileQueue writes them to disk.
+	persist func(jobs []Job) error
+}
+
+func NewMemoryQueue(options Options) *MemoryQueue {
+	return &MemoryQueue{
+		options: options.withDefaults(),
+		jobs:    make(map[string]*Job),
+		changed: make(chan struct{}),
+	}
+}
+
+func (q *MemoryQueue) Enqueue(name string, id string, payload []byte, at time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.jobs[id]; ok {
+		return fmt.Errorf("job already exists: %s", id)
+	}
+
+	pending := 0
+	for _, job := range q.jobs {
+		if job.Status == StatusQueued || job.Status == StatusRunning {
+			pending++
+		}
+	}
+	if pending >= q.options.Capacity {
+		return fmt.Errorf("%w: %d jobs pending", ErrFull, pending)
+	}
+
+	now := time.Now().UTC()
+	if at.IsZero() {
+		at = now
+	}
+
+	q.jobs[id] = &Job{
+		ID:         id,
+		Queue:      name,
+		Payload:    append([]byte(nil), payload...),
+		Status:     StatusQueued,
+		EnqueuedAt: now,
+		VisibleAt:  at.UTC(),
+		UpdatedAt:  now,
+	}
+
+	// a job that was not persisted is not queued, the caller may enqueue it again
+	if err := q.save(); err != nil {
+		delete(q.jobs, id)
+		return err
+	}
+
+	return nil
+}
+
+// Dequeue hands out the job of the named queue that has been visible the longest, including
+// running jobs whose visibility timed out.
+func (q *MemoryQueue) Dequeue(ctx context.Context, name string) (*Job, error) {
+	for {
+		q.mu.Lock()
+		now := time.Now().UTC()
+
+		var next *Job
+		var wake time.Time
+		for _, job := range q.jobs {
+			if job.Queue != name || (job.Status != StatusQueued && job.Status != StatusRunning) {
+				continue
+			}
+			if job.VisibleAt.After(now) {
+				if wake.IsZero() || job.VisibleAt.Before(wake) {
+					wake = job.VisibleAt
+				}
+				continue
+			}
+			if next == nil || job.VisibleAt.Before(next.VisibleAt) || (job.VisibleAt.Equal(next.VisibleAt) && job.EnqueuedAt.Before(next.EnqueuedAt)) {
+				next = job
+			}
+		}
+
+		if next != nil {
+			next.Status = StatusRunning
+			next.Attempts++
+			next.Receipt = uuid.NewString()
+			next.VisibleAt = now.Add(q.options.VisibilityTimeout)
+			next.UpdatedAt = now
+
+			job := *next
+			err := q.save()
+			q.mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			return &job, nil
+		}
+
+		changed := q.changed
+		q.mu.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !wake.IsZero() {
+			timer = time.NewTimer(time.Until(wake))
+			timeout = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil, ctx.Err()
+		case <-changed:
+		case <-timeout:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (q *MemoryQueue) Extend(id string, receipt string) error {
+	return q.transition(id, receipt, func(job *Job, now time.Time) {
+		job.VisibleAt = now.Add(q.options.VisibilityTimeout)
+	})
+}
+
+func (q *MemoryQueue) Complete(id string, receipt string) error {
+	return q.transition(id, receipt, func(job *Job, now time.Time) {
+		job.Status = StatusSucceeded
+		job.Receipt = ""
+		job.Error = ""
+	})
+}
+
+func (q *MemoryQueue) Fail(id string, receipt string, reason string) error {
+	return q.transition(id, receipt, func(job *Job, now time.Time) {
+		job.Status = StatusFailed
+		job.Receipt = ""
+		job.Error = reason
+	})
+}
+
+func (q *MemoryQueue) Requeue(id string, receipt string, at time.Time) error {
+	return q.transition(id, receipt, func(job *Job, now time.Time) {
+		job.Status = StatusQueued
+		job.Receipt = ""
+		job.VisibleAt = at.UTC()
+	})
+}
+
+// Revive does not count towards the capacity check of Enqueue, a dead letter already held its place.
+func (q *MemoryQueue) Revive(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	if job.Status != StatusFailed {
+		return fmt.Errorf("%w: job %s is %s", ErrInvalidTransition, id, job.Status)
+	}
+
+	now := time.Now().UTC()
+	job.Status = StatusQueued
+	job.Attempts = 0
+	job.VisibleAt = now
+	job.UpdatedAt = now
+
+	return q.save()
+}
+
+// transition applies the change to a running job held with the receipt.
+func (q *MemoryQueue) transition(id string, receipt string, change func(job *Job, now time.Time)) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	if job.Status != StatusRunning {
+		return fmt.Errorf("%w: job %s is %s", ErrInvalidTransition, id, job.Status)
+	}
+	if job.Receipt != receipt {
+		return fmt.Errorf("%w: %s", ErrStaleReceipt, id)
+	}
+
+	now := time.Now().UTC()
+	change(job, now)
+	job.UpdatedAt = now
+
+	return q.save()
+}
+
+func (q *MemoryQueue) Get(id string) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+
+	copied := *job
+	return &copied, nil
+}
+
+func (q *MemoryQueue) List(status string) ([]Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := []Job{}
+	for _, job := range q.sorted() {
+		if status == "" || job.Status == status {
+			jobs = append(jobs, job)
+		}
+	}
+
+	return jobs, nil
+}
+
+// sorted returns every job, oldest first.
+func (q *MemoryQueue) sorted() []Job {
+	jobs := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, *job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].EnqueuedAt.Before(jobs[j].EnqueuedAt)
+	})
+
+	return jobs
+}
+
+// save drops the oldest succeeded and failed jobs, wakes waiting workers and persists the jobs.
+func (q *MemoryQueue) save() error {
+	jobs := q.sorted()
+
+	succeeded, failed := 0, 0
+	for i := len(jobs) - 1; i >= 0; i-- {
+		switch jobs[i].Status {
+		case StatusSucceeded:
+			succeeded++
+			if succeeded > maxSucceeded {
+				delete(q.jobs, jobs[i].ID)
+			}
+		case StatusFailed:
+			failed++
+			if failed > maxFailed {
+				delete(q.jobs, jobs[i].ID)
+			}
+		}
+	}
+
+	close(q.changed)
+	q.changed = make(chan struct{})
+
+	if q.persist == nil {
+		return nil
+	}
+
+	return q.persist(q.sorted())
+}
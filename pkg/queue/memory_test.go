@@ -0,0 +1,297 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// dequeue takes the next job of the queue, failing the test if none is visible within a second.
+func dequeue(t *testing.T, q Queue, name string) *Job {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	job, err := q.Dequeue(ctx, name)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	return job
+}
+
+// expectEmpty fails the test if a job of the queue is visible.
+func expectEmpty(t *testing.T, q Queue, name string) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if job, err := q.Dequeue(ctx, name); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Dequeue() = %+v, %v, want no visible job", job, err)
+	}
+}
+
+func TestMemoryQueueDequeueOrder(t *testing.T) {
+	q := NewMemoryQueue(Options{})
+
+	for _, id := range []string{"job-1", "job-2"} {
+		if err := q.Enqueue("jobs", id, []byte(`{"id":"`+id+`"}`), time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Enqueue("other", "job-3", nil, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"job-1", "job-2"} {
+		job := dequeue(t, q, "jobs")
+		if job.ID != want || job.Status != StatusRunning || job.Attempts != 1 || job.Receipt == "" {
+			t.Errorf("Dequeue() = %+v, want %s running with a receipt", job, want)
+		}
+		if string(job.Payload) != `{"id":"`+want+`"}` {
+			t.Errorf("payload = %s", job.Payload)
+		}
+	}
+
+	// jobs of other queues are left for their own workers
+	expectEmpty(t, q, "jobs")
+}
+
+func TestMemoryQueueEnqueueDuplicate(t *testing.T) {
+	q := NewMemoryQueue(Options{})
+
+	if err := q.Enqueue("jobs", "job-1", nil, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue("jobs", "job-1", nil, time.Time{}); err == nil {
+		t.Error("Enqueue() error = nil, want the job to exist")
+	}
+}
+
+func TestMemoryQueueDelayedJob(t *testing.T) {
+	q := NewMemoryQueue(Options{})
+
+	if err := q.Enqueue("jobs", "job-1", nil, time.Now().Add(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	expectEmpty(t, q, "jobs")
+
+	// a waiting worker wakes when the job becomes visible
+	if job := dequeue(t, q, "jobs"); job.ID != "job-1" {
+		t.Errorf("Dequeue() = %s, want job-1", job.ID)
+	}
+}
+
+func TestMemoryQueueDequeueWaitsForEnqueue(t *testing.T) {
+	q := NewMemoryQueue(Options{})
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		q.Enqueue("jobs", "job-1", nil, time.Time{})
+	}()
+
+	if job := dequeue(t, q, "jobs"); job.ID != "job-1" {
+		t.Errorf("Dequeue() = %s, want job-1", job.ID)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := q.Dequeue(ctx, "jobs"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Dequeue() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestMemoryQueueVisibilityTimeout(t *testing.T) {
+	q := NewMemoryQueue(Options{VisibilityTimeout: 50 * time.Millisecond})
+
+	if err := q.Enqueue("jobs", "job-1", nil, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	first := dequeue(t, q, "jobs")
+	expectEmpty(t, q, "jobs")
+
+	// the worker stopped extending the job, it is handed to another worker with a new receipt
+	second := dequeue(t, q, "jobs")
+	if second.ID != first.ID || second.Attempts != 2 || second.Receipt == first.Receipt {
+		t.Fatalf("Dequeue() = %+v, want job-1 redelivered", second)
+	}
+
+	if err := q.Complete(first.ID, first.Receipt); !errors.Is(err, ErrStaleReceipt) {
+		t.Errorf("Complete() with the first receipt error = %v, want %v", err, ErrStaleReceipt)
+	}
+	if err := q.Complete(second.ID, second.Receipt); err != nil {
+		t.Errorf("Complete() error = %v", err)
+	}
+}
+
+func TestMemoryQueueExtend(t *testing.T) {
+	q := NewMemoryQueue(Options{VisibilityTimeout: 50 * time.Millisecond})
+
+	if err := q.Enqueue("jobs", "job-1", nil, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	job := dequeue(t, q, "jobs")
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(25 * time.Millisecond)
+		if err := q.Extend(job.ID, job.Receipt); err != nil {
+			t.Fatalf("Extend() error = %v", err)
+		}
+	}
+	expectEmpty(t, q, "jobs")
+}
+
+func TestMemoryQueueTransitions(t *testing.T) {
+	q := NewMemoryQueue(Options{})
+
+	for _, id := range []string{"job-1", "job-2", "job-3"} {
+		if err := q.Enqueue("jobs", id, nil, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	completed := dequeue(t, q, "jobs")
+	failed := dequeue(t, q, "jobs")
+	requeued := dequeue(t, q, "jobs")
+
+	if err := q.Complete(completed.ID, "other"); !errors.Is(err, ErrStaleReceipt) {
+		t.Errorf("Complete() with a mismatched receipt error = %v, want %v", err, ErrStaleReceipt)
+	}
+	if err := q.Complete(completed.ID, completed.Receipt); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Fail(failed.ID, failed.Receipt, "boom"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Requeue(requeued.ID, requeued.Receipt, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// finished jobs cannot move again
+	if err := q.Fail(completed.ID, completed.Receipt, "boom"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Fail() of a succeeded job error = %v, want %v", err, ErrInvalidTransition)
+	}
+	if err := q.Complete("job-4", ""); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Complete() of a missing job error = %v, want %v", err, ErrJobNotFound)
+	}
+
+	job, err := q.Get(failed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != StatusFailed || job.Error != "boom" || job.Receipt != "" {
+		t.Errorf("failed job = %+v", job)
+	}
+
+	if job := dequeue(t, q, "jobs"); job.ID != requeued.ID || job.Attempts != 2 {
+		t.Errorf("Dequeue() = %+v, want the requeued job", job)
+	}
+
+	for status, want := range map[string]int{"": 3, StatusSucceeded: 1, StatusFailed: 1, StatusRunning: 1, StatusQueued: 0} {
+		jobs, err := q.List(status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) != want {
+			t.Errorf("List(%q) = %d jobs, want %d", status, len(jobs), want)
+		}
+	}
+}
+
+func TestMemoryQueueCapacity(t *testing.T) {
+	q := NewMemoryQueue(Options{Capacity: 2})
+
+	for _, id := range []string{"job-1", "job-2"} {
+		if err := q.Enqueue("jobs", id, nil, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Enqueue("jobs", "job-3", nil, time.Time{}); !errors.Is(err, ErrFull) {
+		t.Fatalf("Enqueue() error = %v, want %v", err, ErrFull)
+	}
+
+	// running jobs count towards the capacity, finished ones do not
+	job := dequeue(t, q, "jobs")
+	if err := q.Enqueue("jobs", "job-3", nil, time.Time{}); !errors.Is(err, ErrFull) {
+		t.Fatalf("Enqueue() error = %v, want %v", err, ErrFull)
+	}
+	if err := q.Complete(job.ID, job.Receipt); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue("jobs", "job-3", nil, time.Time{}); err != nil {
+		t.Errorf("Enqueue() error = %v, want the job enqueued", err)
+	}
+}
+
+func TestMemoryQueueDropsOldestFinished(t *testing.T) {
+	q := NewMemoryQueue(Options{Capacity: maxSucceeded + 10})
+
+	for i := 0; i < maxSucceeded+5; i++ {
+		id := fmt.Sprintf("job-%04d", i)
+		if err := q.Enqueue("jobs", id, nil, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		job := dequeue(t, q, "jobs")
+		if i == 0 {
+			if err := q.Fail(job.ID, job.Receipt, "boom"); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := q.Complete(job.ID, job.Receipt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jobs, err := q.List(StatusSucceeded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != maxSucceeded || jobs[0].ID != "job-0005" {
+		t.Errorf("List() = %d jobs starting at %s, want %d starting at job-0005", len(jobs), jobs[0].ID, maxSucceeded)
+	}
+
+	// dead letters are kept apart from the succeeded jobs
+	if _, err := q.Get("job-0000"); err != nil {
+		t.Errorf("Get() of the oldest dead letter error = %v", err)
+	}
+}
+
+func TestMemoryQueueRevive(t *testing.T) {
+	q := NewMemoryQueue(Options{Capacity: 1})
+
+	if err := q.Enqueue("jobs", "job-1", nil, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	job := dequeue(t, q, "jobs")
+
+	if err := q.Revive(job.ID); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Revive() of a running job error = %v, want %v", err, ErrInvalidTransition)
+	}
+	if err := q.Fail(job.ID, job.Receipt, "boom"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the dead letter's place is taken by another job, reviving it does not check the capacity
+	if err := q.Enqueue("jobs", "job-2", nil, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Revive(job.ID); err != nil {
+		t.Fatalf("Revive() error = %v", err)
+	}
+	if err := q.Revive("job-3"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Revive() of a missing job error = %v, want %v", err, ErrJobNotFound)
+	}
+
+	revived, err := q.Get(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revived.Status != StatusQueued || revived.Attempts != 0 {
+		t.Errorf("revived job = %+v, want it queued with its attempts reset", revived)
+	}
+}
@@ -0,0 +1,91 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	// Job statuses, a job moves from queued to running when it is dequeued and from running
+	// to succeeded, failed or back to queued when it is requeued or its visibility times out.
+	// Failed jobs are dead letters, they are kept until revived.
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// DefaultCapacity is the number of queued and running jobs a queue holds before Enqueue fails.
+const DefaultCapacity = 1000
+
+// DefaultVisibilityTimeout is how long a dequeued job stays hidden from other workers before it
+// is handed out again, workers extend it while they run.
+const DefaultVisibilityTimeout = 30 * time.Minute
+
+// maxSucceeded is the number of succeeded jobs kept, the oldest are dropped first.
+const maxSucceeded = 1000
+
+// maxFailed is the number of dead letters kept, the oldest are dropped first.
+const maxFailed = 1000
+
+var (
+	ErrFull              = errors.New("queue is full")
+	ErrJobNotFound       = errors.New("job not found")
+	ErrInvalidTransition = errors.New("invalid job status transition")
+	// ErrStaleReceipt is returned when a job was handed to another worker after its visibility timed out.
+	ErrStaleReceipt = errors.New("stale job receipt")
+)
+
+// Job is a payload waiting for, or held by, a worker.
+type Job struct {
+	ID      string          `json:"id"`
+	Queue   string          `json:"queue"`
+	Payload json.RawMessage `json:"payload"`
+	Status  string          `json:"status"`
+	// Attempts counts the times the job was dequeued.
+	Attempts int `json:"attempts"`
+	// Receipt identifies the current delivery, it changes each time the job is dequeued.
+	Receipt    string    `json:"receipt,omitempty"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	// VisibleAt is when a queued job may be dequeued or when a running job's visibility times out.
+	VisibleAt time.Time `json:"visible_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type Options struct {
+	Capacity          int
+	VisibilityTimeout time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.Capacity <= 0 {
+		o.Capacity = DefaultCapacity
+	}
+	if o.VisibilityTimeout <= 0 {
+		o.VisibilityTimeout = DefaultVisibilityTimeout
+	}
+	return o
+}
+
+// Queue holds jobs for workers. Enqueue returns immediately, Dequeue blocks until a job of the
+// named queue is visible. The methods taking a receipt fail with ErrStaleReceipt once the job
+// has been handed to another worker.
+type Queue interface {
+	// Enqueue adds a job that becomes visible at the time, a zero time makes it visible now.
+	Enqueue(name string, id string, payload []byte, at time.Time) error
+	Dequeue(ctx context.Context, name string) (*Job, error)
+	// Extend pushes back the visibility timeout of a running job.
+	Extend(id string, receipt string) error
+	Complete(id string, receipt string) error
+	Fail(id string, receipt string, reason string) error
+	// Requeue puts a running job back in the queue, visible at the time.
+	Requeue(id string, receipt string, at time.Time) error
+	// Revive queues a failed job again with its attempts reset.
+	Revive(id string) error
+	Get(id string) (*Job, error)
+	// List returns the jobs with the status, or every job when it is empty, oldest first.
+	List(status string) ([]Job, error)
+}
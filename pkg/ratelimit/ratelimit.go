@@ -0,0 +1,171 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultMaxWait is the longest a request waits for a budget to recover before giving up
+// with an ErrRateLimited, so the job can be rescheduled instead of holding a worker.
+const DefaultMaxWait = time.Minute
+
+// Budget is the last known GitHub rate limit of a key, usually an installation.
+type Budget struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	// PausedUntil is set by a Retry-After header or an exhausted budget.
+	PausedUntil time.Time `json:"paused_until,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ErrRateLimited is returned when a key is paused for longer than the limiter waits.
+type ErrRateLimited struct {
+	Key   string
+	Until time.Time
+}
+
+func (e *ErrRateLimited) Error() string {
+	return fmt.Sprintf("rate limited for %s until %s", e.Key, e.Until.Format(time.RFC3339))
+}
+
+// Limiter tracks the budgets reported by GitHub per key and holds requests back while a key is paused.
+type Limiter struct {
+	maxWait time.Duration
+
+	mu      sync.Mutex
+	budgets map[string]*Budget
+}
+
+func NewLimiter(maxWait time.Duration) *Limiter {
+	if maxWait <= 0 {
+		maxWait = DefaultMaxWait
+	}
+	return &Limiter{
+		maxWait: maxWait,
+		budgets: make(map[string]*Budget),
+	}
+}
+
+// PausedUntil returns when the key may make requests again, or false when it is not paused.
+func (l *Limiter) PausedUntil(key string) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	budget, ok := l.budgets[key]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	until := budget.PausedUntil
+	if budget.Remaining == 0 && budget.Limit > 0 && budget.Reset.After(until) {
+		until = budget.Reset
+	}
+
+	if !until.After(time.Now()) {
+		return time.Time{}, false
+	}
+
+	return until, true
+}
+
+// Wait blocks while the key is paused, it returns an ErrRateLimited without waiting when the
+// pause is longer than the limiter's maximum wait.
+func (l *Limiter) Wait(ctx context.Context, key string) error {
+	until, paused := l.PausedUntil(key)
+	if !paused {
+		return nil
+	}
+
+	wait := time.Until(until)
+	if wait > l.maxWait {
+		return &ErrRateLimited{Key: key, Until: until}
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Update records the rate limit headers of a response.
+func (l *Limiter) Update(key string, resp *http.Response) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	budget, ok := l.budgets[key]
+	if !ok {
+		budget = &Budget{}
+		l.budgets[key] = budget
+	}
+	budget.UpdatedAt = now
+
+	if limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit")); err == nil {
+		budget.Limit = limit
+	}
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		budget.Remaining = remaining
+	}
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		budget.Reset = time.Unix(reset, 0)
+	}
+
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+
+	// secondary rate limits send Retry-After in seconds
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		budget.PausedUntil = now.Add(time.Duration(seconds) * time.Second)
+		return
+	}
+
+	if budget.Remaining == 0 && budget.Reset.After(now) {
+		budget.PausedUntil = budget.Reset
+	}
+}
+
+// Budgets returns a copy of the known budgets by key.
+func (l *Limiter) Budgets() map[string]Budget {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	budgets := make(map[string]Budget, len(l.budgets))
+	for key, budget := range l.budgets {
+		budgets[key] = *budget
+	}
+	return budgets
+}
+
+// Transport waits for the key's budget before each request and records the budget of each response.
+type Transport struct {
+	Base    http.RoundTripper
+	Limiter *Limiter
+	Key     string
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.Limiter.Wait(req.Context(), t.Key); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Limiter.Update(t.Key, resp)
+
+	return resp, nil
+}
@@ -0,0 +1,186 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func response(status int, headers map[string]string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: http.Header{}}
+	for key, value := range headers {
+		resp.Header.Set(key, value)
+	}
+	return resp
+}
+
+func TestLimiterUpdate(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	resetHeader := strconv.FormatInt(reset.Unix(), 10)
+
+	tests := []struct {
+		name       string
+		resp       *http.Response
+		wantBudget Budget
+		wantPaused bool
+		wantUntil  time.Time
+	}{
+		{
+			name:       "remaining budget",
+			resp:       response(http.StatusOK, map[string]string{"X-RateLimit-Limit": "5000", "X-RateLimit-Remaining": "4999", "X-RateLimit-Reset": resetHeader}),
+			wantBudget: Budget{Limit: 5000, Remaining: 4999, Reset: reset},
+		},
+		{
+			name:       "exhausted budget pauses until the reset",
+			resp:       response(http.StatusForbidden, map[string]string{"X-RateLimit-Limit": "5000", "X-RateLimit-Remaining": "0", "X-RateLimit-Reset": resetHeader}),
+			wantBudget: Budget{Limit: 5000, Remaining: 0, Reset: reset, PausedUntil: reset},
+			wantPaused: true,
+			wantUntil:  reset,
+		},
+		{
+			name:       "exhausted budget on a successful response pauses until the reset",
+			resp:       response(http.StatusOK, map[string]string{"X-RateLimit-Limit": "5000", "X-RateLimit-Remaining": "0", "X-RateLimit-Reset": resetHeader}),
+			wantBudget: Budget{Limit: 5000, Remaining: 0, Reset: reset},
+			wantPaused: true,
+			wantUntil:  reset,
+		},
+		{
+			name:       "malformed headers are ignored",
+			resp:       response(http.StatusOK, map[string]string{"X-RateLimit-Limit": "many", "X-RateLimit-Remaining": "", "X-RateLimit-Reset": "soon"}),
+			wantBudget: Budget{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewLimiter(time.Second)
+			limiter.Update("1", tt.resp)
+
+			budget := limiter.Budgets()["1"]
+			budget.UpdatedAt = time.Time{}
+			if !budget.Reset.Equal(tt.wantBudget.Reset) || !budget.PausedUntil.Equal(tt.wantBudget.PausedUntil) ||
+				budget.Limit != tt.wantBudget.Limit || budget.Remaining != tt.wantBudget.Remaining {
+				t.Errorf("budget = %+v, want %+v", budget, tt.wantBudget)
+			}
+
+			until, paused := limiter.PausedUntil("1")
+			if paused != tt.wantPaused || !until.Equal(tt.wantUntil) {
+				t.Errorf("PausedUntil() = %s, %t, want %s, %t", until, paused, tt.wantUntil, tt.wantPaused)
+			}
+		})
+	}
+}
+
+func TestLimiterRetryAfter(t *testing.T) {
+	limiter := NewLimiter(time.Second)
+
+	before := time.Now()
+	limiter.Update("1", response(http.StatusTooManyRequests, map[string]string{"Retry-After": "30"}))
+
+	until, paused := limiter.PausedUntil("1")
+	if !paused || until.Before(before.Add(30*time.Second)) || until.After(time.Now().Add(30*time.Second)) {
+		t.Errorf("PausedUntil() = %s, %t, want 30s from the response", until, paused)
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	t.Run("not paused", func(t *testing.T) {
+		limiter := NewLimiter(time.Second)
+		if err := limiter.Wait(context.Background(), "1"); err != nil {
+			t.Errorf("Wait() error = %v", err)
+		}
+	})
+
+	t.Run("waits until the reset", func(t *testing.T) {
+		limiter := NewLimiter(time.Minute)
+		limiter.Update("1", response(http.StatusForbidden, map[string]string{"Retry-After": "1"}))
+
+		start := time.Now()
+		if err := limiter.Wait(context.Background(), "1"); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+			t.Errorf("Wait() returned after %s, want it to wait for the pause", elapsed)
+		}
+	})
+
+	t.Run("longer than the maximum wait", func(t *testing.T) {
+		limiter := NewLimiter(time.Second)
+		limiter.Update("1", response(http.StatusForbidden, map[string]string{"Retry-After": "3600"}))
+
+		start := time.Now()
+		err := limiter.Wait(context.Background(), "1")
+
+		var rateLimited *ErrRateLimited
+		if !errors.As(err, &rateLimited) || rateLimited.Key != "1" {
+			t.Fatalf("Wait() error = %v, want an ErrRateLimited for the key", err)
+		}
+		if time.Since(start) > 100*time.Millisecond {
+			t.Errorf("Wait() waited, want it to return at once")
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		limiter := NewLimiter(time.Minute)
+		limiter.Update("1", response(http.StatusForbidden, map[string]string{"Retry-After": "30"}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := limiter.Wait(ctx, "1"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Wait() error = %v, want the context's error", err)
+		}
+	})
+}
+
+func TestLimiterBudgetsPerKey(t *testing.T) {
+	limiter := NewLimiter(time.Second)
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	limiter.Update("1", response(http.StatusForbidden, map[string]string{"X-RateLimit-Limit": "5000", "X-RateLimit-Remaining": "0", "X-RateLimit-Reset": reset}))
+	limiter.Update("2", response(http.StatusOK, map[string]string{"X-RateLimit-Limit": "5000", "X-RateLimit-Remaining": "10", "X-RateLimit-Reset": reset}))
+
+	if _, paused := limiter.PausedUntil("1"); !paused {
+		t.Error("installation 1 is not paused, want its exhausted budget to pause it")
+	}
+	if _, paused := limiter.PausedUntil("2"); paused {
+		t.Error("installation 2 is paused, want budgets kept per installation")
+	}
+
+	budgets := limiter.Budgets()
+	if len(budgets) != 2 || budgets["2"].Remaining != 10 {
+		t.Errorf("Budgets() = %+v, want both installations", budgets)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	limiter := NewLimiter(time.Second)
+	client := &http.Client{Transport: &Transport{Base: http.DefaultTransport, Limiter: limiter, Key: "1"}}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// the response paused the key, the next request is not sent
+	_, err = client.Get(server.URL)
+	var rateLimited *ErrRateLimited
+	if !errors.As(err, &rateLimited) {
+		t.Errorf("error = %v, want an ErrRateLimited", err)
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d, want 1", requests)
+	}
+}
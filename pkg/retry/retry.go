@@ -0,0 +1,91 @@
+package retry
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Defaults of a Policy's zero fields.
+const (
+	DefaultMaxAttempts = 5
+	DefaultBaseDelay   = 30 * time.Second
+	DefaultMaxDelay    = 30 * time.Minute
+)
+
+// Policy decides how often and how long after a failed attempt a job is tried again.
+type Policy struct {
+	// MaxAttempts includes the first attempt, 1 disables retries.
+	MaxAttempts int
+	// BaseDelay is the delay after the first attempt, it doubles with each attempt up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultBaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultMaxDelay
+	}
+	return p
+}
+
+// Next returns the delay before retrying after the attempt failed with the error, or false
+// when the error is permanent or the attempts are used up.
+func (p Policy) Next(attempt int, err error) (time.Duration, bool) {
+	p = p.withDefaults()
+
+	if err == nil || IsPermanent(err) || attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	return p.Backoff(attempt), true
+}
+
+// Backoff doubles the base delay for each attempt and keeps half of it, jittering the other
+// half so jobs that failed together do not retry together.
+func (p Policy) Backoff(attempt int) time.Duration {
+	p = p.withDefaults()
+
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// PermanentError marks an error that retrying cannot fix.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps the error so Next does not retry it.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
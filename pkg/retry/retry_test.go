@@ -0,0 +1,111 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPolicyNext(t *testing.T) {
+	policy := Policy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute}
+	transient := errors.New("connection reset by peer")
+
+	tests := []struct {
+		name    string
+		attempt int
+		err     error
+		want    bool
+	}{
+		{name: "first attempt", attempt: 1, err: transient, want: true},
+		{name: "second attempt", attempt: 2, err: transient, want: true},
+		{name: "attempts used up", attempt: 3, err: transient, want: false},
+		{name: "permanent", attempt: 1, err: fmt.Errorf("error getting repository: %w", Permanent(transient)), want: false},
+		{name: "no error", attempt: 1, err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := policy.Next(tt.attempt, tt.err)
+			if ok != tt.want {
+				t.Fatalf("Next(%d, %v) = %t, want %t", tt.attempt, tt.err, ok, tt.want)
+			}
+			if ok && (delay <= 0 || delay > policy.MaxDelay) {
+				t.Errorf("Next(%d, %v) delay = %s, want between 0 and %s", tt.attempt, tt.err, delay, policy.MaxDelay)
+			}
+		})
+	}
+}
+
+func TestPolicyDefaults(t *testing.T) {
+	var policy Policy
+	transient := errors.New("timeout")
+
+	if _, ok := policy.Next(DefaultMaxAttempts-1, transient); !ok {
+		t.Errorf("Next(%d) = false, want a retry", DefaultMaxAttempts-1)
+	}
+	if _, ok := policy.Next(DefaultMaxAttempts, transient); ok {
+		t.Errorf("Next(%d) = true, want the attempts used up", DefaultMaxAttempts)
+	}
+
+	if delay := policy.Backoff(1); delay < DefaultBaseDelay/2 || delay > DefaultBaseDelay {
+		t.Errorf("Backoff(1) = %s, want between %s and %s", delay, DefaultBaseDelay/2, DefaultBaseDelay)
+	}
+}
+
+func TestPolicyBackoff(t *testing.T) {
+	policy := Policy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		attempt int
+		delay   time.Duration
+	}{
+		{attempt: 1, delay: time.Second},
+		{attempt: 2, delay: 2 * time.Second},
+		{attempt: 3, delay: 4 * time.Second},
+		{attempt: 4, delay: 8 * time.Second},
+		{attempt: 5, delay: 10 * time.Second},
+		{attempt: 50, delay: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		// half of the delay is kept and the other half jittered
+		for i := 0; i < 100; i++ {
+			if got := policy.Backoff(tt.attempt); got < tt.delay/2 || got > tt.delay {
+				t.Fatalf("Backoff(%d) = %s, want between %s and %s", tt.attempt, got, tt.delay/2, tt.delay)
+			}
+		}
+	}
+}
+
+func TestPolicyBackoffJitter(t *testing.T) {
+	policy := Policy{BaseDelay: time.Minute}
+
+	delays := make(map[time.Duration]bool)
+	for i := 0; i < 20; i++ {
+		delays[policy.Backoff(1)] = true
+	}
+
+	if len(delays) < 2 {
+		t.Errorf("Backoff() returned %d distinct delays, want jobs that failed together spread out", len(delays))
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	if Permanent(nil) != nil {
+		t.Error("Permanent(nil) != nil")
+	}
+
+	cause := errors.New("not found")
+	err := fmt.Errorf("error getting repository: %w", Permanent(cause))
+
+	if !IsPermanent(err) {
+		t.Errorf("IsPermanent(%v) = false, want true", err)
+	}
+	if !errors.Is(err, cause) || err.Error() != "error getting repository: not found" {
+		t.Errorf("Permanent() does not wrap %v: %v", cause, err)
+	}
+	if IsPermanent(cause) {
+		t.Errorf("IsPermanent(%v) = true, want false", cause)
+	}
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+const (
+	// Run types
+	RunTypeCreated   = "created"
+	RunTypeScheduled = "scheduled"
+	RunTypeRelease   = "release"
+
+	// Run triggers
+	RunTriggerWebhook  = "webhook"
+	RunTriggerSchedule = "schedule"
+	RunTriggerManual   = "manual"
+	RunTriggerPush     = "push"
+	RunTriggerCatchUp  = "catch_up"
+
+	// Run statuses
+	RunStatusQueued    = "queued"
+	RunStatusRunning   = "running"
+	RunStatusSucceeded = "succeeded"
+	RunStatusSkipped   = "skipped"
+	RunStatusFailed    = "failed"
+)
+
+// Run is the record of a single execution of a generation job, Attempts counts the times it
+// was started, retries included. Since and Until bound the commits of a run catching up on a
+// missed scheduled generation, Commits counts the commits pushed in a push run's range.
+// GeneratedAt is the generation time of the run's post, written back to the configuration.
+type Run struct {
+	ID                        string     `json:"id"`
+	Type                      string     `json:"type"`
+	Trigger                   string     `json:"trigger"`
+	Status                    string     `json:"status"`
+	RepositoryConfigurationID int        `json:"repository_configuration_id"`
+	QueuedAt                  time.Time  `json:"queued_at"`
+	StartedAt                 *time.Time `json:"started_at,omitempty"`
+	EndedAt                   *time.Time `json:"ended_at,omitempty"`
+	CommitFrom                string     `json:"commit_from,omitempty"`
+	CommitTo                  string     `json:"commit_to,omitempty"`
+	Tag                       string     `json:"tag,omitempty"`
+	Since                     *time.Time `json:"since,omitempty"`
+	Until                     *time.Time `json:"until,omitempty"`
+	Commits                   int        `json:"commits,omitempty"`
+	Attempts                  int        `json:"attempts"`
+	TokensUsed                int        `json:"tokens_used"`
+	Error                     string     `json:"error,omitempty"`
+	GitBlogPostID             int        `json:"git_blog_post_id,omitempty"`
+	GeneratedAt               *time.Time `json:"generated_at,omitempty"`
+}
+
+// RunFilter narrows the runs returned by a store, zero values match everything.
+type RunFilter struct {
+	RepositoryConfigurationID int
+	Status                    string
+	Limit                     int
+}
+
+func (f RunFilter) Matches(run Run) bool {
+	if f.RepositoryConfigurationID != 0 && run.RepositoryConfigurationID != f.RepositoryConfigurationID {
+		return false
+	}
+	if f.Status != "" && run.Status != f.Status {
+		return false
+	}
+	return true
+}
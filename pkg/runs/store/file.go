@@ -0,0 +1,149 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/TonyDMorris/quick-function/pkg/atomicfile"
+	"github.com/TonyDMorris/quick-function/pkg/runs/models"
+)
+
+// maxRuns is the number of runs kept in the file, the oldest are dropped first.
+const maxRuns = 5000
+
+// FileStore keeps runs in memory and writes them to a JSON file on every change.
+// An empty path keeps the runs in memory only.
+type FileStore struct {
+	path string
+	mu   sync.RWMutex
+	runs map[string]models.Run
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		path: path,
+		runs: make(map[string]models.Run),
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	bytes, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading runs file: %w", err)
+	}
+
+	var runs []models.Run
+	if err := json.Unmarshal(bytes, &runs); err != nil {
+		return nil, fmt.Errorf("error unmarshalling runs file: %w", err)
+	}
+
+	for _, run := range runs {
+		s.runs[run.ID] = run
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) Create(run models.Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.runs[run.ID]; ok {
+		return fmt.Errorf("run already exists: %s", run.ID)
+	}
+
+	s.runs[run.ID] = run
+
+	return s.save()
+}
+
+func (s *FileStore) Update(run models.Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.runs[run.ID]; !ok {
+		return fmt.Errorf("%w: %s", ErrRunNotFound, run.ID)
+	}
+
+	s.runs[run.ID] = run
+
+	return s.save()
+}
+
+func (s *FileStore) Get(id string) (*models.Run, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	run, ok := s.runs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRunNotFound, id)
+	}
+
+	return &run, nil
+}
+
+func (s *FileStore) List(filter models.RunFilter) ([]models.Run, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	runs := []models.Run{}
+	for _, run := range s.sorted() {
+		if !filter.Matches(run) {
+			continue
+		}
+		runs = append(runs, run)
+		if filter.Limit > 0 && len(runs) == filter.Limit {
+			break
+		}
+	}
+
+	return runs, nil
+}
+
+// sorted returns every run, most recently queued first.
+func (s *FileStore) sorted() []models.Run {
+	runs := make([]models.Run, 0, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, run)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].QueuedAt.After(runs[j].QueuedAt)
+	})
+
+	return runs
+}
+
+func (s *FileStore) save() error {
+	runs := s.sorted()
+	if len(runs) > maxRuns {
+		for _, run := range runs[maxRuns:] {
+			delete(s.runs, run.ID)
+		}
+		runs = runs[:maxRuns]
+	}
+
+	if s.path == "" {
+		return nil
+	}
+
+	bytes, err := json.Marshal(runs)
+	if err != nil {
+		return fmt.Errorf("error marshalling runs: %w", err)
+	}
+
+	if err := atomicfile.Write(s.path, bytes); err != nil {
+		return fmt.Errorf("error writing runs file: %w", err)
+	}
+
+	return nil
+}
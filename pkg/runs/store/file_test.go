@@ -0,0 +1,99 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/runs/models"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2023, 11, 6, 9, 0, 0, 0, time.UTC)
+	runs := []models.Run{
+		{ID: "1", RepositoryConfigurationID: 1, Status: models.RunStatusSucceeded, QueuedAt: start},
+		{ID: "2", RepositoryConfigurationID: 2, Status: models.RunStatusFailed, QueuedAt: start.Add(time.Hour)},
+		{ID: "3", RepositoryConfigurationID: 1, Status: models.RunStatusRunning, QueuedAt: start.Add(2 * time.Hour)},
+	}
+	for _, run := range runs {
+		if err := s.Create(run); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+	if err := s.Create(runs[0]); err == nil {
+		t.Error("Create() of an existing run error = nil")
+	}
+
+	runs[2].Status = models.RunStatusSucceeded
+	if err := s.Update(runs[2]); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := s.Update(models.Run{ID: "missing"}); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("Update() of a missing run error = %v, want %v", err, ErrRunNotFound)
+	}
+
+	// the runs survive a restart
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := reloaded.Get("3")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if !reflect.DeepEqual(*run, runs[2]) {
+		t.Errorf("Get() = %+v, want %+v", *run, runs[2])
+	}
+	if _, err := reloaded.Get("missing"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("Get() of a missing run error = %v, want %v", err, ErrRunNotFound)
+	}
+
+	tests := []struct {
+		name   string
+		filter models.RunFilter
+		want   []string
+	}{
+		{name: "all, most recently queued first", filter: models.RunFilter{}, want: []string{"3", "2", "1"}},
+		{name: "configuration", filter: models.RunFilter{RepositoryConfigurationID: 1}, want: []string{"3", "1"}},
+		{name: "status", filter: models.RunFilter{Status: models.RunStatusFailed}, want: []string{"2"}},
+		{name: "limit", filter: models.RunFilter{Limit: 2}, want: []string{"3", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listed, err := reloaded.List(tt.filter)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			ids := []string{}
+			for _, run := range listed {
+				ids = append(ids, run.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("List() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileStoreInMemory(t *testing.T) {
+	s, err := NewFileStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Create(models.Run{ID: "1"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := s.Get("1"); err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+}
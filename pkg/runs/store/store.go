@@ -0,0 +1,18 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/TonyDMorris/quick-function/pkg/runs/models"
+)
+
+var ErrRunNotFound = errors.New("run not found")
+
+// Store persists the history of job runs.
+type Store interface {
+	Create(run models.Run) error
+	Update(run models.Run) error
+	Get(id string) (*models.Run, error)
+	// List returns the runs matching the filter, most recently queued first.
+	List(filter models.RunFilter) ([]models.Run, error)
+}
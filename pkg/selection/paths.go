@@ -0,0 +1,111 @@
+package selection
+
+import (
+	"path"
+	"strings"
+)
+
+// Matches reports whether the file is under one of the patterns. A pattern without glob
+// characters is a directory or file prefix such as services/api, one with them is matched
+// like path.Match where ** also matches across directories. No patterns match everything.
+func Matches(patterns []string, filePath string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		pattern = strings.Trim(strings.TrimSpace(pattern), "/")
+		if pattern == "" {
+			return true
+		}
+
+		if !isGlob(pattern) {
+			if filePath == pattern || strings.HasPrefix(filePath, pattern+"/") {
+				return true
+			}
+			continue
+		}
+
+		if matchGlob(strings.Split(pattern, "/"), strings.Split(filePath, "/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Filter keeps the files matching the patterns.
+func Filter(files []File, patterns []string) []File {
+	if len(patterns) == 0 {
+		return files
+	}
+
+	var matching []File
+	for _, file := range files {
+		if Matches(patterns, file.Path) {
+			matching = append(matching, file)
+		}
+	}
+	return matching
+}
+
+// LiteralPrefixes returns the directories the patterns are confined to, for APIs that filter
+// by a path such as listing commits. It returns nil when a pattern can match anywhere.
+func LiteralPrefixes(patterns []string) []string {
+	seen := make(map[string]bool)
+	var prefixes []string
+
+	for _, pattern := range patterns {
+		pattern = strings.Trim(strings.TrimSpace(pattern), "/")
+
+		var literal []string
+		for _, segment := range strings.Split(pattern, "/") {
+			if isGlob(segment) {
+				break
+			}
+			literal = append(literal, segment)
+		}
+
+		prefix := strings.Join(literal, "/")
+		if prefix == "" {
+			return nil
+		}
+		if !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	return prefixes
+}
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// matchGlob matches path segments, a ** segment matches any number of segments, a pattern
+// matching a directory also matches everything under it.
+func matchGlob(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchGlob(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	if ok, err := path.Match(pattern[0], segments[0]); err != nil || !ok {
+		return false
+	}
+
+	return matchGlob(pattern[1:], segments[1:])
+}
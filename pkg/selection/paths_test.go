@@ -0,0 +1,95 @@
+package selection
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{patterns: nil, path: "main.go", want: true},
+		{patterns: []string{"services/api"}, path: "services/api/main.go", want: true},
+		{patterns: []string{"services/api"}, path: "services/api", want: true},
+		{patterns: []string{"services/api"}, path: "services/apigateway/main.go", want: false},
+		{patterns: []string{"services/api/"}, path: "services/api/main.go", want: true},
+		{patterns: []string{"/"}, path: "main.go", want: true},
+		{patterns: []string{"services/*"}, path: "services/api/main.go", want: true},
+		{patterns: []string{"services/*/main.go"}, path: "services/api/main.go", want: true},
+		{patterns: []string{"services/*/main.go"}, path: "services/api/cmd/main.go", want: false},
+		{patterns: []string{"services/**/main.go"}, path: "services/api/cmd/main.go", want: true},
+		{patterns: []string{"services/**/main.go"}, path: "services/main.go", want: true},
+		{patterns: []string{"**/*.proto"}, path: "api/v1/service.proto", want: true},
+		{patterns: []string{"**/*.proto"}, path: "api/v1/service.go", want: false},
+		{patterns: []string{"web", "services/api"}, path: "services/api/main.go", want: true},
+		{patterns: []string{"web", "services/api"}, path: "docs/README.md", want: false},
+		{patterns: []string{"services/[a"}, path: "services/api/main.go", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := Matches(tt.patterns, tt.path); got != tt.want {
+			t.Errorf("Matches(%v, %s) = %t, want %t", tt.patterns, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "**", path: "a/b/c.go", want: true},
+		{pattern: "a/**", path: "a", want: true},
+		{pattern: "a/**/c.go", path: "a/c.go", want: true},
+		{pattern: "a/**/c.go", path: "a/b/d/c.go", want: true},
+		{pattern: "a/**/c.go", path: "b/c.go", want: false},
+		{pattern: "a/*", path: "a/b/c.go", want: true},
+		{pattern: "a/*/d.go", path: "a/b/c.go", want: false},
+		{pattern: "a/b/c.go/d", path: "a/b/c.go", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := matchGlob(strings.Split(tt.pattern, "/"), strings.Split(tt.path, "/")); got != tt.want {
+			t.Errorf("matchGlob(%s, %s) = %t, want %t", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	files := []File{{Path: "web/app.ts"}, {Path: "services/api/main.go"}, {Path: "README.md"}}
+
+	if got := Filter(files, nil); !reflect.DeepEqual(got, files) {
+		t.Errorf("Filter(nil) = %v, want %v", got, files)
+	}
+	if got, want := Filter(files, []string{"services/**/*.go"}), []File{{Path: "services/api/main.go"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Filter() = %v, want %v", got, want)
+	}
+	if got := Filter(files, []string{"cmd"}); len(got) != 0 {
+		t.Errorf("Filter() = %v, want none", got)
+	}
+}
+
+func TestLiteralPrefixes(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		want     []string
+	}{
+		{patterns: nil, want: nil},
+		{patterns: []string{"services/api/"}, want: []string{"services/api"}},
+		{patterns: []string{"services/api", "services/api/**"}, want: []string{"services/api"}},
+		{patterns: []string{"services/*/main.go", "web/src/**/*.ts"}, want: []string{"services", "web/src"}},
+		{patterns: []string{"services/api", "**/*.proto"}, want: nil},
+		{patterns: []string{"*.go"}, want: nil},
+	}
+
+	for _, tt := range tests {
+		if got := LiteralPrefixes(tt.patterns); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("LiteralPrefixes(%v) = %v, want %v", tt.patterns, got, tt.want)
+		}
+	}
+}
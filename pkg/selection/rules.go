@@ -0,0 +1,121 @@
+package selection
+
+import (
+	"path"
+	"strings"
+)
+
+var manifests = map[string]bool{
+	"go.mod":              true,
+	"package.json":        true,
+	"cargo.toml":          true,
+	"pyproject.toml":      true,
+	"setup.py":            true,
+	"setup.cfg":           true,
+	"requirements.txt":    true,
+	"pom.xml":             true,
+	"build.gradle":        true,
+	"build.gradle.kts":    true,
+	"gemfile":             true,
+	"composer.json":       true,
+	"mix.exs":             true,
+	"pubspec.yaml":        true,
+	"dockerfile":          true,
+	"docker-compose.yml":  true,
+	"docker-compose.yaml": true,
+	"makefile":            true,
+}
+
+var entryPoints = map[string]bool{
+	"main.go":     true,
+	"main.py":     true,
+	"__main__.py": true,
+	"app.py":      true,
+	"manage.py":   true,
+	"main.rs":     true,
+	"lib.rs":      true,
+	"index.js":    true,
+	"index.ts":    true,
+	"index.tsx":   true,
+	"app.js":      true,
+	"app.ts":      true,
+	"app.tsx":     true,
+	"server.js":   true,
+	"server.ts":   true,
+	"main.java":   true,
+	"program.cs":  true,
+	"main.c":      true,
+	"main.cpp":    true,
+}
+
+var sourceExtensions = map[string]bool{
+	".go": true, ".py": true, ".js": true, ".jsx": true, ".ts": true, ".tsx": true,
+	".rs": true, ".java": true, ".kt": true, ".scala": true, ".rb": true, ".php": true,
+	".c": true, ".h": true, ".cpp": true, ".cc": true, ".hpp": true, ".cs": true,
+	".swift": true, ".dart": true, ".ex": true, ".exs": true, ".vue": true, ".svelte": true,
+	".sql": true, ".sh": true, ".proto": true,
+}
+
+// vendoredDirectories are directory names whose contents were not written by the project, after linguist's vendor.yml.
+var vendoredDirectories = []string{
+	"vendor/", "node_modules/", "third_party/", "third-party/", "bower_components/",
+	".yarn/", "dist/", "build/", "out/", "target/", "coverage/", ".next/", ".nuxt/",
+	"__pycache__/", ".venv/", "venv/", ".git/", ".idea/", ".vscode/",
+}
+
+// generatedNames are lock files and other files written by tools, after linguist's generated.rb.
+var generatedNames = map[string]bool{
+	"go.sum":            true,
+	"package-lock.json": true,
+	"yarn.lock":         true,
+	"pnpm-lock.yaml":    true,
+	"cargo.lock":        true,
+	"poetry.lock":       true,
+	"pipfile.lock":      true,
+	"gemfile.lock":      true,
+	"composer.lock":     true,
+	"license":           true,
+	"license.md":        true,
+	"license.txt":       true,
+	".ds_store":         true,
+}
+
+var generatedSuffixes = []string{
+	".min.js", ".min.css", ".map", ".pb.go", ".pb.gw.go", "_generated.go", ".gen.go",
+	"_pb2.py", ".snap", ".d.ts", ".lock",
+}
+
+var binaryExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".ico": true, ".bmp": true,
+	".webp": true, ".svg": true, ".pdf": true, ".zip": true, ".gz": true, ".tgz": true,
+	".tar": true, ".rar": true, ".7z": true, ".jar": true, ".war": true, ".exe": true,
+	".dll": true, ".so": true, ".dylib": true, ".a": true, ".o": true, ".class": true,
+	".pyc": true, ".wasm": true, ".woff": true, ".woff2": true, ".ttf": true, ".otf": true,
+	".eot": true, ".mp3": true, ".mp4": true, ".mov": true, ".avi": true, ".wav": true,
+	".ogg": true, ".webm": true, ".psd": true, ".sqlite": true, ".db": true, ".bin": true,
+	".pem": true, ".key": true, ".p12": true,
+}
+
+// Excluded reports whether the file is vendored, generated or binary.
+func Excluded(filePath string) bool {
+	lowerPath := strings.ToLower(filePath)
+	name := path.Base(lowerPath)
+
+	for _, directory := range vendoredDirectories {
+		if strings.HasPrefix(lowerPath, directory) || strings.Contains(lowerPath, "/"+directory) {
+			return true
+		}
+	}
+
+	if generatedNames[name] || binaryExtensions[path.Ext(name)] {
+		return true
+	}
+
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
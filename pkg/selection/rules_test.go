@@ -0,0 +1,33 @@
+package selection
+
+import "testing"
+
+func TestExcluded(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "main.go", want: false},
+		{path: "docs/build.md", want: false},
+		{path: "pkg/builder/builder.go", want: false},
+		{path: "vendor/github.com/lib/lib.go", want: true},
+		{path: "web/node_modules/react/index.js", want: true},
+		{path: "web/dist/app.js", want: true},
+		{path: "go.sum", want: true},
+		{path: "web/package-lock.json", want: true},
+		{path: "LICENSE", want: true},
+		{path: "static/app.min.js", want: true},
+		{path: "api/service.pb.go", want: true},
+		{path: "types/index.d.ts", want: true},
+		{path: "assets/Logo.PNG", want: true},
+		{path: "certs/server.pem", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := Excluded(tt.path); got != tt.want {
+				t.Errorf("Excluded(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package selection
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// File is a candidate file from a repository tree, Changes is how many lines changed in it
+// when the selection is over a diff.
+type File struct {
+	Path    string
+	Size    int
+	Changes int
+}
+
+// String formats the file as {path}:{size}, the format constants.InterestedFiles describes.
+func (f File) String() string {
+	return fmt.Sprintf("%s:%d", f.Path, f.Size)
+}
+
+type Options struct {
+	// MaxFiles is the number of files selected.
+	MaxFiles int
+	// MaxFileSize excludes files larger than this many bytes.
+	MaxFileSize int
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MaxFiles:    10,
+		MaxFileSize: 100 * 1024,
+	}
+}
+
+// Rank drops excluded files and orders the rest from most to least useful for describing the project.
+func Rank(files []File, options Options) []File {
+	type scored struct {
+		file  File
+		score float64
+	}
+
+	var candidates []scored
+	for _, file := range files {
+		if Excluded(file.Path) {
+			continue
+		}
+		if options.MaxFileSize > 0 && file.Size > options.MaxFileSize {
+			continue
+		}
+		candidates = append(candidates, scored{file: file, score: Score(file)})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score == candidates[j].score {
+			return candidates[i].file.Path < candidates[j].file.Path
+		}
+		return candidates[i].score > candidates[j].score
+	})
+
+	ranked := make([]File, 0, len(candidates))
+	for _, candidate := range candidates {
+		ranked = append(ranked, candidate.file)
+	}
+
+	return ranked
+}
+
+func Top(files []File, n int) []File {
+	if n > 0 && len(files) > n {
+		return files[:n]
+	}
+	return files
+}
+
+func Paths(files []File) []string {
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	return paths
+}
+
+// Score rates how much a file tells a reader about the project. READMEs and manifests
+// come first, then entry points and source code, shallow files beat deep ones and
+// frequently changed files get a boost.
+func Score(file File) float64 {
+	name := strings.ToLower(path.Base(file.Path))
+	depth := strings.Count(file.Path, "/")
+
+	var score float64
+
+	switch {
+	case strings.HasPrefix(name, "readme"):
+		score += 100
+		if depth == 0 {
+			score += 50
+		}
+	case manifests[name]:
+		score += 80
+		if depth == 0 {
+			score += 20
+		}
+	case isEntryPoint(file.Path, name):
+		score += 60
+	}
+
+	if sourceExtensions[path.Ext(name)] {
+		score += 20
+	}
+
+	if isTest(file.Path, name) {
+		score -= 30
+	}
+
+	score -= float64(depth) * 5
+
+	if file.Changes > 0 {
+		score += math.Min(float64(file.Changes), 50)
+	}
+
+	// prefer files that fit in a prompt without heavy truncation
+	score -= math.Min(float64(file.Size)/(10*1024), 20)
+
+	return score
+}
+
+func isEntryPoint(filePath string, name string) bool {
+	if entryPoints[name] {
+		return true
+	}
+	return strings.HasPrefix(filePath, "cmd/") && name == "main.go"
+}
+
+func isTest(filePath string, name string) bool {
+	lowerPath := strings.ToLower(filePath)
+	switch {
+	case strings.HasSuffix(name, "_test.go"),
+		strings.Contains(name, ".test."),
+		strings.Contains(name, ".spec."),
+		strings.HasPrefix(name, "test_"),
+		strings.HasPrefix(lowerPath, "test/"),
+		strings.HasPrefix(lowerPath, "tests/"),
+		strings.Contains(lowerPath, "/test/"),
+		strings.Contains(lowerPath, "/tests/"),
+		strings.Contains(lowerPath, "__tests__/"):
+		return true
+	}
+	return false
+}
+
+// Validate parses a model's reply of one path per line and keeps the lines naming one of
+// the candidates, in the order given and without duplicates. Bullets, quotes and a trailing
+// :size are tolerated, anything else, including paths not in the tree, is dropped.
+func Validate(candidates []File, reply string) []File {
+	byPath := make(map[string]File, len(candidates))
+	for _, candidate := range candidates {
+		byPath[candidate.Path] = candidate
+	}
+
+	seen := make(map[string]bool)
+	var valid []File
+	for _, line := range strings.Split(reply, "\n") {
+		filePath := cleanLine(line)
+		file, ok := byPath[filePath]
+		if !ok || seen[filePath] {
+			continue
+		}
+		seen[filePath] = true
+		valid = append(valid, file)
+	}
+
+	return valid
+}
+
+func cleanLine(line string) string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimLeft(line, "-*• ")
+	if i := strings.Index(line, ". "); i > 0 {
+		if _, err := strconv.Atoi(line[:i]); err == nil {
+			line = line[i+2:]
+		}
+	}
+	line = strings.Trim(line, "`'\" ")
+	if i := strings.LastIndex(line, ":"); i > 0 {
+		if _, err := strconv.Atoi(line[i+1:]); err == nil {
+			line = line[:i]
+		}
+	}
+	return strings.TrimPrefix(line, "./")
+}
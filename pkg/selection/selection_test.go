@@ -0,0 +1,112 @@
+package selection
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRank(t *testing.T) {
+	files := []File{
+		{Path: "pkg/server/handlers_test.go", Size: 2000},
+		{Path: "pkg/server/handlers.go", Size: 2000},
+		{Path: "docs/README.md", Size: 1000},
+		{Path: "README.md", Size: 4000},
+		{Path: "go.mod", Size: 300},
+		{Path: "cmd/api/main.go", Size: 1500},
+		{Path: "vendor/github.com/lib/lib.go", Size: 100},
+		{Path: "assets/logo.png", Size: 100},
+		{Path: "data/fixtures.sql", Size: 500 * 1024},
+	}
+
+	tests := []struct {
+		name  string
+		files []File
+		want  []string
+	}{
+		{
+			name:  "readmes and manifests first, tests last, excluded and large files dropped",
+			files: files,
+			want:  []string{"README.md", "go.mod", "docs/README.md", "cmd/api/main.go", "pkg/server/handlers.go", "pkg/server/handlers_test.go"},
+		},
+		{
+			name: "frequently changed files are boosted",
+			files: []File{
+				{Path: "pkg/a/a.go", Size: 1000},
+				{Path: "pkg/b/b.go", Size: 1000, Changes: 40},
+			},
+			want: []string{"pkg/b/b.go", "pkg/a/a.go"},
+		},
+		{
+			name: "ties are ordered by path",
+			files: []File{
+				{Path: "z.go", Size: 10},
+				{Path: "a.go", Size: 10},
+			},
+			want: []string{"a.go", "z.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Paths(Rank(tt.files, DefaultOptions()))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Rank() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTop(t *testing.T) {
+	files := []File{{Path: "a"}, {Path: "b"}, {Path: "c"}}
+
+	if got := Paths(Top(files, 2)); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Top(2) = %v, want [a b]", got)
+	}
+	if got := Paths(Top(files, 0)); len(got) != 3 {
+		t.Errorf("Top(0) = %v, want every file", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	candidates := []File{
+		{Path: "README.md", Size: 100},
+		{Path: "cmd/api/main.go", Size: 200},
+		{Path: "pkg/server/handlers.go", Size: 300},
+	}
+
+	tests := []struct {
+		name  string
+		reply string
+		want  []File
+	}{
+		{
+			name:  "one path per line",
+			reply: "README.md\ncmd/api/main.go",
+			want:  []File{candidates[0], candidates[1]},
+		},
+		{
+			name:  "bullets, numbering, quotes and sizes are tolerated",
+			reply: "- `README.md`\n2. ./pkg/server/handlers.go:300\n* \"cmd/api/main.go\"",
+			want:  []File{candidates[0], candidates[2], candidates[1]},
+		},
+		{
+			name:  "paths outside the tree and duplicates are dropped",
+			reply: "Here are the files:\nREADME.md\nmain.go\nsecrets.env\nREADME.md",
+			want:  []File{candidates[0]},
+		},
+		{
+			name:  "empty reply",
+			reply: "",
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Validate(candidates, tt.reply)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
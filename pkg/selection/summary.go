@@ -0,0 +1,125 @@
+package selection
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Rollup stands in for the files under a directory when listing them would not fit a prompt.
+type Rollup struct {
+	Directory string
+	Files     int
+	Size      int
+}
+
+// String formats the rollup as {directory}/ ({files} files, {size} bytes).
+func (r Rollup) String() string {
+	return fmt.Sprintf("%s/ (%d files, %d bytes)", r.Directory, r.Files, r.Size)
+}
+
+// Summarise lists up to listed of the ranked files individually and rolls the rest up by
+// directory, starting with their own directories and moving up a level until the listing fits.
+// When even a single rollup does not fit the listed files are halved.
+func Summarise(ranked []File, listed int, fits func(lines []string) bool) ([]File, []Rollup) {
+	if listed <= 0 || listed > len(ranked) {
+		listed = len(ranked)
+	}
+
+	for {
+		files := ranked[:listed]
+		rest := ranked[listed:]
+
+		if len(rest) == 0 && fits(lines(files, nil)) {
+			return files, nil
+		}
+
+		for depth := maxDepth(rest); depth >= 0; depth-- {
+			rollups := rollUp(rest, depth)
+			if fits(lines(files, rollups)) {
+				return files, rollups
+			}
+		}
+
+		if listed == 0 {
+			return nil, nil
+		}
+		listed /= 2
+	}
+}
+
+func lines(files []File, rollups []Rollup) []string {
+	var out []string
+	for _, file := range files {
+		out = append(out, file.String())
+	}
+	for _, rollup := range rollups {
+		out = append(out, rollup.String())
+	}
+	return out
+}
+
+func maxDepth(files []File) int {
+	depth := 0
+	for _, file := range files {
+		if d := strings.Count(file.Path, "/"); d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
+
+// rollUp groups the files by their directory cut to depth segments, the root is ".".
+func rollUp(files []File, depth int) []Rollup {
+	byDirectory := make(map[string]*Rollup)
+	for _, file := range files {
+		directory := path.Dir(file.Path)
+		if directory != "." {
+			segments := strings.Split(directory, "/")
+			if len(segments) > depth {
+				segments = segments[:depth]
+			}
+			directory = strings.Join(segments, "/")
+			if directory == "" {
+				directory = "."
+			}
+		}
+
+		rollup, ok := byDirectory[directory]
+		if !ok {
+			rollup = &Rollup{Directory: directory}
+			byDirectory[directory] = rollup
+		}
+		rollup.Files++
+		rollup.Size += file.Size
+	}
+
+	rollups := make([]Rollup, 0, len(byDirectory))
+	for _, rollup := range byDirectory {
+		rollups = append(rollups, *rollup)
+	}
+
+	sort.Slice(rollups, func(i, j int) bool {
+		return rollups[i].Directory < rollups[j].Directory
+	})
+
+	return rollups
+}
+
+// MayContain reports whether files under the directory can match the patterns, so a walk can
+// skip directories that cannot.
+func MayContain(patterns []string, directory string) bool {
+	prefixes := LiteralPrefixes(patterns)
+	if len(prefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range prefixes {
+		if prefix == directory || strings.HasPrefix(prefix, directory+"/") || strings.HasPrefix(directory, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
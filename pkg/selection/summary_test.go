@@ -0,0 +1,138 @@
+package selection
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRollupString(t *testing.T) {
+	if got, want := (Rollup{Directory: "pkg/api", Files: 3, Size: 1200}).String(), "pkg/api/ (3 files, 1200 bytes)"; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
+
+func TestSummarise(t *testing.T) {
+	ranked := []File{
+		{Path: "main.go", Size: 100},
+		{Path: "README.md", Size: 50},
+		{Path: "pkg/api/handler.go", Size: 10},
+		{Path: "pkg/api/routes.go", Size: 20},
+		{Path: "pkg/store/file.go", Size: 30},
+		{Path: "docs/guide.md", Size: 40},
+		{Path: "LICENSE.txt", Size: 5},
+	}
+
+	fitsLines := func(max int) func(lines []string) bool {
+		return func(lines []string) bool {
+			return len(lines) <= max
+		}
+	}
+
+	tests := []struct {
+		name        string
+		listed      int
+		fits        func(lines []string) bool
+		wantFiles   int
+		wantRollups []Rollup
+	}{
+		{
+			name:      "everything fits",
+			listed:    0,
+			fits:      fitsLines(10),
+			wantFiles: 7,
+		},
+		{
+			name:      "rest rolled up by directory",
+			listed:    2,
+			fits:      fitsLines(10),
+			wantFiles: 2,
+			wantRollups: []Rollup{
+				{Directory: ".", Files: 1, Size: 5},
+				{Directory: "docs", Files: 1, Size: 40},
+				{Directory: "pkg/api", Files: 2, Size: 30},
+				{Directory: "pkg/store", Files: 1, Size: 30},
+			},
+		},
+		{
+			name:      "rollups move up a level",
+			listed:    2,
+			fits:      fitsLines(5),
+			wantFiles: 2,
+			wantRollups: []Rollup{
+				{Directory: ".", Files: 1, Size: 5},
+				{Directory: "docs", Files: 1, Size: 40},
+				{Directory: "pkg", Files: 3, Size: 60},
+			},
+		},
+		{
+			name:        "listed files halved",
+			listed:      4,
+			fits:        fitsLines(3),
+			wantFiles:   2,
+			wantRollups: []Rollup{{Directory: ".", Files: 5, Size: 105}},
+		},
+		{
+			name:      "nothing fits",
+			listed:    2,
+			fits:      fitsLines(0),
+			wantFiles: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, rollups := Summarise(ranked, tt.listed, tt.fits)
+
+			if !reflect.DeepEqual(files, ranked[:tt.wantFiles]) && !(tt.wantFiles == 0 && len(files) == 0) {
+				t.Errorf("files = %v, want %v", files, ranked[:tt.wantFiles])
+			}
+			if !reflect.DeepEqual(rollups, tt.wantRollups) {
+				t.Errorf("rollups = %v, want %v", rollups, tt.wantRollups)
+			}
+		})
+	}
+}
+
+func TestSummariseTokenBudget(t *testing.T) {
+	var ranked []File
+	for _, directory := range []string{"a", "b", "c"} {
+		for _, name := range []string{"one.go", "two.go", "three.go"} {
+			ranked = append(ranked, File{Path: directory + "/" + name, Size: 10})
+		}
+	}
+
+	files, rollups := Summarise(ranked, 3, func(lines []string) bool {
+		return len(strings.Join(lines, "\n")) <= 90
+	})
+
+	if len(files) != 3 || len(rollups) != 2 {
+		t.Fatalf("Summarise() = %v, %v, want the three listed files and rollups of b and c", files, rollups)
+	}
+	if want := []Rollup{{Directory: "b", Files: 3, Size: 30}, {Directory: "c", Files: 3, Size: 30}}; !reflect.DeepEqual(rollups, want) {
+		t.Errorf("rollups = %v, want %v", rollups, want)
+	}
+}
+
+func TestMayContain(t *testing.T) {
+	tests := []struct {
+		patterns  []string
+		directory string
+		want      bool
+	}{
+		{patterns: nil, directory: "web", want: true},
+		{patterns: []string{"services/api"}, directory: "services", want: true},
+		{patterns: []string{"services/api"}, directory: "services/api", want: true},
+		{patterns: []string{"services/api"}, directory: "services/api/cmd", want: true},
+		{patterns: []string{"services/api"}, directory: "services/apigateway", want: false},
+		{patterns: []string{"services/api"}, directory: "web", want: false},
+		{patterns: []string{"services/*/main.go"}, directory: "services/worker", want: true},
+		{patterns: []string{"**/*.proto"}, directory: "web", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := MayContain(tt.patterns, tt.directory); got != tt.want {
+			t.Errorf("MayContain(%v, %s) = %t, want %t", tt.patterns, tt.directory, got, tt.want)
+		}
+	}
+}
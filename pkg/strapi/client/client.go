@@ -1,9 +1,11 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/TonyDMorris/quick-function/pkg/strapi/models"
 	"github.com/hashicorp/go-retryablehttp"
@@ -12,6 +14,17 @@ import (
 const repositoryConfigurationPath = "%s/api/internal/repository-configurations/%d"
 const repositoryConfigurationsPath = "%s/api/internal/repository-configurations"
 const gitBlogPostsPath = "%s/api/git-blog-posts"
+const installationsSyncPath = "%s/api/internal/installations/sync"
+const installationPath = "%s/api/internal/installations/%s"
+
+// StatusError is returned when Strapi responds with an unexpected status code.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
 
 type Client struct {
 	apiKey         string
@@ -28,8 +41,11 @@ func NewClient(apiKey, baseURL string) *Client {
 	}
 }
 
-func (c *Client) GetRepositoryConfiguration(id int) (*models.RepositoryConfiguration, error) {
-	req, err := retryablehttp.NewRequest(http.MethodGet, fmt.Sprintf(repositoryConfigurationPath, c.baseURL, id), nil)
+// GetRepositoryConfiguration returns the repository configuration with the ID. Strapi answers
+// for a missing configuration with a 200 and {success:false}, which has no ID, so it is
+// returned as a 404 StatusError.
+func (c *Client) GetRepositoryConfiguration(ctx context.Context, id int) (*models.RepositoryConfiguration, error) {
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(repositoryConfigurationPath, c.baseURL, id), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -40,9 +56,10 @@ func (c *Client) GetRepositoryConfiguration(id int) (*models.RepositoryConfigura
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	var repositoryConfiguration models.RepositoryConfiguration
@@ -52,12 +69,16 @@ func (c *Client) GetRepositoryConfiguration(id int) (*models.RepositoryConfigura
 		return nil, err
 	}
 
+	if repositoryConfiguration.ID == 0 {
+		return nil, &StatusError{StatusCode: http.StatusNotFound}
+	}
+
 	return &repositoryConfiguration, nil
 
 }
 
-func (c *Client) GetRepositoryConfigurations() ([]models.RepositoryConfiguration, error) {
-	req, err := retryablehttp.NewRequest(http.MethodGet, fmt.Sprintf(repositoryConfigurationsPath, c.baseURL), nil)
+func (c *Client) GetRepositoryConfigurations(ctx context.Context) ([]models.RepositoryConfiguration, error) {
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(repositoryConfigurationsPath, c.baseURL), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -68,9 +89,10 @@ func (c *Client) GetRepositoryConfigurations() ([]models.RepositoryConfiguration
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	var repositoryConfigurations []models.RepositoryConfiguration
@@ -84,7 +106,7 @@ func (c *Client) GetRepositoryConfigurations() ([]models.RepositoryConfiguration
 
 }
 
-func (c *Client) UpdateRepositoryConfiguration(repoConfig models.RepositoryConfiguration) (*models.RepositoryConfiguration, error) {
+func (c *Client) UpdateRepositoryConfiguration(ctx context.Context, repoConfig models.RepositoryConfiguration) (*models.RepositoryConfiguration, error) {
 	carrier := models.Carrier{
 		Data: repoConfig,
 	}
@@ -92,7 +114,51 @@ func (c *Client) UpdateRepositoryConfiguration(repoConfig models.RepositoryConfi
 	if err != nil {
 		return nil, err
 	}
-	req, err := retryablehttp.NewRequest(http.MethodPut, fmt.Sprintf(repositoryConfigurationPath, c.baseURL, repoConfig.ID), body)
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(repositoryConfigurationPath, c.baseURL, repoConfig.ID), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.retryingClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	var repositoryConfiguration models.RepositoryConfiguration
+
+	err = json.NewDecoder(resp.Body).Decode(&repositoryConfiguration)
+	if err != nil {
+		return nil, err
+	}
+
+	if repositoryConfiguration.ID == 0 {
+		return nil, &StatusError{StatusCode: http.StatusNotFound}
+	}
+
+	return &repositoryConfiguration, nil
+
+}
+
+// UpdateRepositoryConfigurationGenerations sets the generation times of the repository
+// configuration, leaving the rest of it as it is in Strapi. A missing configuration is a 404
+// StatusError, as for GetRepositoryConfiguration.
+func (c *Client) UpdateRepositoryConfigurationGenerations(ctx context.Context, id int, generations models.RepositoryConfigurationGenerations) (*models.RepositoryConfiguration, error) {
+	carrier := models.Carrier{
+		Data: generations,
+	}
+	body, err := json.Marshal(carrier)
+	if err != nil {
+		return nil, err
+	}
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf(repositoryConfigurationPath, c.baseURL, id), body)
 	if err != nil {
 		return nil, err
 	}
@@ -104,9 +170,10 @@ func (c *Client) UpdateRepositoryConfiguration(repoConfig models.RepositoryConfi
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	var repositoryConfiguration models.RepositoryConfiguration
@@ -116,11 +183,15 @@ func (c *Client) UpdateRepositoryConfiguration(repoConfig models.RepositoryConfi
 		return nil, err
 	}
 
+	if repositoryConfiguration.ID == 0 {
+		return nil, &StatusError{StatusCode: http.StatusNotFound}
+	}
+
 	return &repositoryConfiguration, nil
 
 }
 
-func (c *Client) StandardCreateGitBlogPost(gitBlogPost models.GitBlogPost) (*models.GitBlogPost, error) {
+func (c *Client) StandardCreateGitBlogPost(ctx context.Context, gitBlogPost models.GitBlogPost) (*models.GitBlogPost, error) {
 	carrier := models.Carrier{
 		Data: gitBlogPost,
 	}
@@ -129,7 +200,7 @@ func (c *Client) StandardCreateGitBlogPost(gitBlogPost models.GitBlogPost) (*mod
 	if err != nil {
 		return nil, err
 	}
-	req, err := retryablehttp.NewRequest(http.MethodPost, fmt.Sprintf(gitBlogPostsPath, c.baseURL), body)
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf(gitBlogPostsPath, c.baseURL), body)
 	if err != nil {
 		return nil, err
 
@@ -139,9 +210,10 @@ func (c *Client) StandardCreateGitBlogPost(gitBlogPost models.GitBlogPost) (*mod
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	var responseCarrier models.Carrier
@@ -162,6 +234,64 @@ func (c *Client) StandardCreateGitBlogPost(gitBlogPost models.GitBlogPost) (*mod
 		return nil, err
 	}
 
+	gitBlogPost.ID = respGitBlogPost.ID
+
 	return &gitBlogPost, nil
 
 }
+
+func (c *Client) SyncInstallation(ctx context.Context, installationSync models.InstallationSync) (*models.Installation, error) {
+	body, err := json.Marshal(installationSync)
+	if err != nil {
+		return nil, err
+	}
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf(installationsSyncPath, c.baseURL), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.retryingClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	var installation models.Installation
+
+	err = json.NewDecoder(resp.Body).Decode(&installation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &installation, nil
+
+}
+
+func (c *Client) DeleteInstallation(ctx context.Context, installationID string) error {
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodDelete, fmt.Sprintf(installationPath, c.baseURL, url.PathEscape(installationID)), nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.retryingClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	return nil
+
+}
@@ -3,6 +3,7 @@ package models
 import "time"
 
 type GitBlogPost struct {
+	ID            int        `json:"id,omitempty"`
 	Title         string     `json:"title,omitempty"`
 	Description   string     `json:"description,omitempty"`
 	Body          string     `json:"body,omitempty"`
@@ -0,0 +1,9 @@
+package models
+
+// InstallationSync adds and removes repositories of an installation, creating the installation when it does not exist.
+type InstallationSync struct {
+	InstallationID      string       `json:"installation_id"`
+	Username            string       `json:"username,omitempty"`
+	RepositoriesAdded   []Repository `json:"repositories_added"`
+	RepositoriesRemoved []Repository `json:"repositories_removed"`
+}
@@ -2,14 +2,49 @@ package models
 
 import "time"
 
+// Triggers choose what starts an incremental generation, a cron schedule or pushes to its branch.
+// Push triggered configurations wait PushQuietMinutes after the last push, or until
+// PushCommitThreshold commits are pending when it is set, so a burst of pushes yields one post.
+const (
+	TriggerSchedule = "schedule"
+	TriggerPush     = "push"
+)
+
+// ReleaseNotes choose where the notes generated for a new release or tag go, a git blog post
+// or the body of the GitHub release. Release notes are off when it is empty.
+const (
+	ReleaseNotesPost    = "post"
+	ReleaseNotesRelease = "release"
+)
+
+// RepositoryConfiguration describes one digest of a repository. Branch defaults to the
+// repository's default branch and Paths, prefixes or globs, narrow it to part of a monorepo.
 type RepositoryConfiguration struct {
-	ID             int           `json:"id"`
-	LastGeneration *time.Time    `json:"last_generation"`
-	Private        bool          `json:"private"`
-	Cron           string        `json:"cron"`
-	NextGeneration *time.Time    `json:"next_generation"`
-	Repository     *Repository   `json:"repository"`
-	Installation   *Installation `json:"installation"`
+	ID                  int           `json:"id"`
+	LastGeneration      *time.Time    `json:"last_generation"`
+	Private             bool          `json:"private"`
+	Cron                string        `json:"cron"`
+	NextGeneration      *time.Time    `json:"next_generation"`
+	Model               string        `json:"model"`
+	Temperature         *float64      `json:"temperature"`
+	TopP                *float64      `json:"top_p"`
+	MaxTokens           int           `json:"max_tokens"`
+	TokenBudget         int           `json:"token_budget"`
+	Trigger             string        `json:"trigger"`
+	PushQuietMinutes    int           `json:"push_quiet_minutes"`
+	PushCommitThreshold int           `json:"push_commit_threshold"`
+	ReleaseNotes        string        `json:"release_notes"`
+	Branch              string        `json:"branch"`
+	Paths               []string      `json:"paths"`
+	Repository          *Repository   `json:"repository"`
+	Installation        *Installation `json:"installation"`
+}
+
+// RepositoryConfigurationGenerations updates only the generation times of a repository
+// configuration, the fields left nil are not sent so concurrent edits in Strapi are kept.
+type RepositoryConfigurationGenerations struct {
+	LastGeneration *time.Time `json:"last_generation,omitempty"`
+	NextGeneration *time.Time `json:"next_generation,omitempty"`
 }
 
 type Repository struct {
@@ -0,0 +1,173 @@
+package tokens
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+const Encoding = "cl100k_base"
+
+// markerReserve is kept free for the truncation marker.
+const markerReserve = 24
+
+// minKeptFraction stops a boundary search from throwing away most of what fits.
+const minKeptFraction = 0.6
+
+var (
+	encodingOnce sync.Once
+	encoding     *tiktoken.Tiktoken
+	encodingErr  error
+)
+
+func getEncoding() (*tiktoken.Tiktoken, error) {
+	encodingOnce.Do(func() {
+		encoding, encodingErr = tiktoken.GetEncoding(Encoding)
+		if encodingErr != nil {
+			encodingErr = fmt.Errorf("error getting tik token: %w", encodingErr)
+		}
+	})
+	return encoding, encodingErr
+}
+
+// Count returns the number of tokens in the text.
+func Count(text string) (int, error) {
+	tkm, err := getEncoding()
+	if err != nil {
+		return 0, err
+	}
+	return len(tkm.Encode(text, nil, nil)), nil
+}
+
+// Truncate shortens the text to at most budget tokens. It keeps the head of the text,
+// where imports and package docs live, prefers to cut at a blank line or top level
+// declaration and ends the text with a marker saying how much was dropped.
+// Text with no usable line breaks is cut on a token boundary.
+func Truncate(text string, budget int) (string, error) {
+	tkm, err := getEncoding()
+	if err != nil {
+		return "", err
+	}
+
+	textTokens := tkm.Encode(text, nil, nil)
+	if len(textTokens) <= budget {
+		return text, nil
+	}
+
+	available := budget - markerReserve
+	if available <= 0 {
+		return "", nil
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+
+	kept := 0
+	used := 0
+	for _, line := range lines {
+		lineTokens := len(tkm.Encode(line, nil, nil))
+		if used+lineTokens > available {
+			break
+		}
+		used += lineTokens
+		kept++
+	}
+
+	if kept == 0 {
+		head := decodeValid(tkm, textTokens[:available])
+		return head + fmt.Sprintf("\n[... truncated %d of %d tokens ...]\n", len(textTokens)-available, len(textTokens)), nil
+	}
+
+	if boundary := lastBoundary(lines, kept); boundary >= int(float64(kept)*minKeptFraction) {
+		kept = boundary
+	}
+
+	// per line counts can drift from the count of the joined text, drop lines until it fits
+	head := strings.Join(lines[:kept], "")
+	for kept > 1 && len(tkm.Encode(head, nil, nil)) > available {
+		kept--
+		head = strings.Join(lines[:kept], "")
+	}
+
+	if !strings.HasSuffix(head, "\n") {
+		head += "\n"
+	}
+
+	return head + fmt.Sprintf("[... truncated %d of %d lines ...]\n", len(lines)-kept, len(lines)), nil
+}
+
+// lastBoundary returns the number of lines to keep so the cut falls just before a blank
+// line or a line starting a top level block, or 0 when there is none.
+func lastBoundary(lines []string, kept int) int {
+	for i := kept; i > 0; i-- {
+		if i >= len(lines) {
+			continue
+		}
+		if isBoundary(lines[i]) {
+			return i
+		}
+	}
+	return 0
+}
+
+func isBoundary(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" {
+		return true
+	}
+
+	// a top level line that is not a continuation or closing of the previous block
+	if line[0] == ' ' || line[0] == '\t' {
+		return false
+	}
+
+	switch trimmed[0] {
+	case '}', ')', ']':
+		return false
+	}
+
+	return true
+}
+
+// decodeValid decodes the tokens and drops a trailing partial rune left by a token boundary.
+func decodeValid(tkm *tiktoken.Tiktoken, textTokens []int) string {
+	decoded := tkm.Decode(textTokens)
+	for len(decoded) > 0 && !utf8.ValidString(decoded) {
+		_, size := utf8.DecodeLastRuneInString(decoded)
+		decoded = decoded[:len(decoded)-size]
+	}
+	return decoded
+}
+
+// Allocate splits the budget between items by their token counts. Items smaller than
+// an even share keep their full size and the unused budget goes to the larger items.
+func Allocate(sizes map[string]int, budget int) map[string]int {
+	keys := make([]string, 0, len(sizes))
+	for key := range sizes {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if sizes[keys[i]] == sizes[keys[j]] {
+			return keys[i] < keys[j]
+		}
+		return sizes[keys[i]] < sizes[keys[j]]
+	})
+
+	allocations := make(map[string]int, len(sizes))
+	remaining := budget
+	for i, key := range keys {
+		share := remaining / (len(keys) - i)
+		allocation := sizes[key]
+		if allocation > share {
+			allocation = share
+		}
+		allocations[key] = allocation
+		remaining -= allocation
+	}
+
+	return allocations
+}
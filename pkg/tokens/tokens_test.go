@@ -0,0 +1,142 @@
+package tokens
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustCount(t *testing.T, text string) int {
+	t.Helper()
+	count, err := Count(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestTruncate(t *testing.T) {
+	var source strings.Builder
+	source.WriteString("package example\n\nimport \"fmt\"\n")
+	for i := 0; i < 40; i++ {
+		source.WriteString("\nfunc example() {\n\tfmt.Println(\"a line inside the function body\")\n\tfmt.Println(\"another line inside the body\")\n}\n")
+	}
+	code := source.String()
+	codeTokens := mustCount(t, code)
+
+	// a single line has no breaks to cut at and is cut on a token boundary
+	word := strings.Repeat("token ", 200)
+
+	tests := []struct {
+		name       string
+		text       string
+		budget     int
+		want       string
+		wantMarker string
+	}{
+		{name: "text within the budget is unchanged", text: code, budget: codeTokens, want: code},
+		{name: "budget only fits the marker", text: code, budget: markerReserve, want: ""},
+		{name: "cut on a line boundary", text: code, budget: 200, wantMarker: "lines ...]\n"},
+		{name: "cut on a token boundary", text: word, budget: 100, wantMarker: "tokens ...]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Truncate(tt.text, tt.budget)
+			if err != nil {
+				t.Fatalf("Truncate() error = %v", err)
+			}
+
+			if tt.wantMarker == "" {
+				if got != tt.want {
+					t.Errorf("Truncate() = %q, want %q", got, tt.want)
+				}
+				return
+			}
+
+			// the marker fits in the reserve so the result stays within the budget
+			if count := mustCount(t, got); count > tt.budget {
+				t.Errorf("Truncate() = %d tokens, want at most %d", count, tt.budget)
+			}
+			if !strings.HasSuffix(got, tt.wantMarker) {
+				t.Errorf("Truncate() = %q, want it to end with %q", got, tt.wantMarker)
+			}
+
+			head := got[:strings.LastIndex(got, "[...")]
+			if !strings.HasPrefix(tt.text, strings.TrimSuffix(head, "\n")) {
+				t.Errorf("Truncate() kept %q, want the head of the text", head)
+			}
+		})
+	}
+}
+
+func TestTruncatePrefersBoundaries(t *testing.T) {
+	text := "package example\n"
+	for i := 0; i < 20; i++ {
+		text += "\nfunc example() {\n" + strings.Repeat("\tcall(\"an argument\")\n", 6) + "}\n"
+	}
+
+	for _, budget := range []int{100, 150, 200, 250} {
+		got, err := Truncate(text, budget)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the cut falls after a closing brace rather than inside a function body
+		head := got[:strings.LastIndex(got, "[... truncated")]
+		if !strings.HasSuffix(strings.TrimRight(head, "\n"), "}") {
+			t.Errorf("Truncate(%d) kept %q, want the cut between functions", budget, head)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name   string
+		sizes  map[string]int
+		budget int
+		want   map[string]int
+	}{
+		{
+			name:   "everything fits",
+			sizes:  map[string]int{"a": 10, "b": 20},
+			budget: 100,
+			want:   map[string]int{"a": 10, "b": 20},
+		},
+		{
+			name:   "small items keep their size and leave the rest to large ones",
+			sizes:  map[string]int{"small": 10, "large": 100, "larger": 200},
+			budget: 150,
+			want:   map[string]int{"small": 10, "large": 70, "larger": 70},
+		},
+		{
+			name:   "even split between large items",
+			sizes:  map[string]int{"a": 100, "b": 100, "c": 100},
+			budget: 200,
+			want:   map[string]int{"a": 66, "b": 67, "c": 67},
+		},
+		{
+			name:   "no items",
+			sizes:  map[string]int{},
+			budget: 100,
+			want:   map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Allocate(tt.sizes, tt.budget)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Allocate() = %v, want %v", got, tt.want)
+			}
+
+			total := 0
+			for _, allocation := range got {
+				total += allocation
+			}
+			if total > tt.budget {
+				t.Errorf("Allocate() total = %d, want at most %d", total, tt.budget)
+			}
+		})
+	}
+}
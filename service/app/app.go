@@ -1,157 +1,436 @@
 package app
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	tokenService "github.com/TonyDMorris/quick-function/pkg/github_token_service/client"
 	gpt "github.com/TonyDMorris/quick-function/pkg/gpt/client"
+	"github.com/TonyDMorris/quick-function/pkg/lease"
 	"github.com/TonyDMorris/quick-function/pkg/logging"
+	"github.com/TonyDMorris/quick-function/pkg/normalise"
+	"github.com/TonyDMorris/quick-function/pkg/queue"
+	"github.com/TonyDMorris/quick-function/pkg/ratelimit"
+	"github.com/TonyDMorris/quick-function/pkg/retry"
+	runModels "github.com/TonyDMorris/quick-function/pkg/runs/models"
+	runStore "github.com/TonyDMorris/quick-function/pkg/runs/store"
+	"github.com/TonyDMorris/quick-function/pkg/selection"
 	strapi "github.com/TonyDMorris/quick-function/pkg/strapi/client"
 	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
 	"github.com/gin-gonic/gin"
 	"github.com/go-co-op/gocron"
 	"go.uber.org/zap/zapcore"
-	"golang.org/x/sync/errgroup"
 
 	"github.com/google/go-github/v56/github"
 )
 
+// rerankCandidates is the number of locally ranked files offered to the model for reranking.
+const rerankCandidates = 50
+
+// recentCommits is the number of commits whose changes rank the files of a full generation.
+const recentCommits = 50
+
+// StrapiSignatureHeader carries the hex HMAC-SHA256 of a Strapi webhook body, prefixed with sha256=.
+const StrapiSignatureHeader = "X-Strapi-Signature-256"
+
+// StrapiWebhookConfig authenticates the webhooks Strapi sends for repository configurations.
+type StrapiWebhookConfig struct {
+	// Secret must match the value of Header, Strapi sends it through its webhook headers.
+	Secret string
+	// Header defaults to X-Strapi-Webhook-Secret.
+	Header string
+	// SigningSecret, when set, requires an HMAC of the body in StrapiSignatureHeader.
+	SigningSecret string
+	// Tolerance is how far the webhook's createdAt may be from now, it defaults to five minutes.
+	Tolerance time.Duration
+}
+
+// Content sources, where the contents of selected files are read from.
+const (
+	ContentSourceBlobs   = "blobs"
+	ContentSourceArchive = "archive"
+)
+
 type Config struct {
-	Port int
+	Port      int
+	Normalise normalise.Options
+	Selection selection.Options
+	// RerankFiles lets the model reorder the locally ranked files.
+	RerankFiles bool
+	// GitHubWebhookSecret verifies the X-Hub-Signature-256 header of GitHub webhooks.
+	GitHubWebhookSecret string
+	StrapiWebhook       StrapiWebhookConfig
+	// RateLimitMaxWait is how long a request waits for an installation's rate limit before its job is requeued.
+	RateLimitMaxWait time.Duration
+	// ContentSource is ContentSourceBlobs, the default, or ContentSourceArchive.
+	ContentSource string
+	// Retry decides when failed jobs are tried again before they are dead-lettered.
+	Retry retry.Policy
+	// JobTimeout cancels a job that runs longer, it defaults to DefaultJobTimeout.
+	JobTimeout time.Duration
+	// ShutdownTimeout is how long in-flight jobs may finish after a shutdown signal before they
+	// are cancelled and requeued, it defaults to DefaultShutdownTimeout.
+	ShutdownTimeout time.Duration
+	// ReplicaID identifies this replica as the holder of leases, it defaults to the hostname.
+	ReplicaID string
+	// LeaderLeaseTTL is how long the leader keeps its lease without renewing it, it is renewed
+	// every third of the TTL.
+	LeaderLeaseTTL time.Duration
+	// CatchUp is the policy for generations missed while the service was down, CatchUpOnce,
+	// the default, CatchUpAll or CatchUpSkip.
+	CatchUp string
+	// ScheduleSyncInterval is how often the schedules are reloaded from Strapi, picking up the
+	// changes webhooks delivered to other replicas made. It defaults to DefaultScheduleSyncInterval.
+	ScheduleSyncInterval time.Duration
+}
+
+// Validate reports the settings the app cannot run with, so a typo fails at startup instead of
+// falling back to a default.
+func (c Config) Validate() error {
+	switch c.ContentSource {
+	case "", ContentSourceBlobs, ContentSourceArchive:
+	default:
+		return fmt.Errorf("unknown content source: %s, expected %s or %s", c.ContentSource, ContentSourceBlobs, ContentSourceArchive)
+	}
+	switch c.CatchUp {
+	case "", CatchUpOnce, CatchUpAll, CatchUpSkip:
+	default:
+		return fmt.Errorf("unknown catch-up policy: %s, expected %s, %s or %s", c.CatchUp, CatchUpOnce, CatchUpAll, CatchUpSkip)
+	}
+
+	return nil
 }
 
 type App struct {
-	server        *gin.Engine
-	githubClient  *github.Client
-	chatGptClient *gpt.ChatClient
-	strapiClient  *strapi.Client
-	cron          *gocron.Scheduler
-	jobs          map[string]*gocron.Job
-	port          int
-	WorkerPool    *WorkerPool
+	server              *gin.Engine
+	githubClient        *github.Client
+	installationTokens  *tokenService.InstallationTokenCache
+	rateLimits          *ratelimit.Limiter
+	contentSourceKind   string
+	chatGptClient       gpt.ChatClientInterface
+	strapiClient        *strapi.Client
+	scheduler           *Scheduler
+	runStore            runStore.Store
+	normaliser          *normalise.Normaliser
+	selectionOptions    selection.Options
+	rerankFiles         bool
+	githubWebhookSecret string
+	strapiWebhook       StrapiWebhookConfig
+	strapiDeliveries    *deliveries
+	port                int
+	jobQueue            queue.Queue
+	locks               lease.Locker
+	replicaID           string
+	leader              *lease.Elector
+	catchUpPolicy       string
+	scheduleSync        time.Duration
+	schedulesMu         sync.Mutex
+	retryPolicy         retry.Policy
+	jobTimeout          time.Duration
+	shutdownTimeout     time.Duration
+	workers             sync.WaitGroup
+}
+
+// Queue names, full generations and the incremental and release jobs each have their own workers.
+const (
+	queueCreated   = "created"
+	queueScheduled = "scheduled"
+)
+
+// workersPerQueue is the number of jobs of each queue run at once.
+const workersPerQueue = 10
+
+// Defaults of the Config timeouts.
+const (
+	DefaultJobTimeout           = 30 * time.Minute
+	DefaultShutdownTimeout      = 2 * time.Minute
+	DefaultScheduleSyncInterval = 5 * time.Minute
+)
+
+// leaderLeaseKey is the lease held by the replica whose scheduler runs the scheduled jobs.
+const leaderLeaseKey = "leader"
+
+// callbackTimeout bounds the Strapi requests of scheduler and push callbacks, which have no caller to cancel them.
+const callbackTimeout = time.Minute
+
+// QueuedJob is the payload of a queued repository configuration, RunID identifies its run record
+// and the queue job, Type picks the handler.
+type QueuedJob struct {
+	RunID                   string
+	Type                    string
+	RepositoryConfiguration strapiModels.RepositoryConfiguration
 }
 
-type WorkerPool struct {
-	RepostioryConfigurationCreated   chan strapiModels.RepositoryConfiguration
-	RepositoryConfigurationScheduled chan strapiModels.RepositoryConfiguration
+// startWorkerPool starts the workers of each queue. They stop dequeueing when dequeueCtx is
+// done, the jobs they run are cancelled when jobsCtx is.
+func (a *App) startWorkerPool(dequeueCtx context.Context, jobsCtx context.Context) {
+	for _, name := range []string{queueCreated, queueScheduled} {
+		// each loop holds the wait group so it cannot drop to zero while a job is being dequeued
+		a.workers.Add(1)
+		go func(name string) {
+			defer a.workers.Done()
+			a.work(dequeueCtx, jobsCtx, name)
+		}(name)
+	}
 }
 
-func (a *App) startWorkerPool() {
+// work dequeues the jobs of the named queue, running up to workersPerQueue of them at once.
+func (a *App) work(dequeueCtx context.Context, jobsCtx context.Context, name string) {
+	slots := make(chan struct{}, workersPerQueue)
 
-	go func() {
-		group := errgroup.Group{}
-		group.SetLimit(10)
-		for repoCreateJob := range a.WorkerPool.RepostioryConfigurationCreated {
-			repoCreateJob := repoCreateJob
-			group.Go(func() error {
-				err := a.HandleRepositoryConfigurationCreatedJob(repoCreateJob)
-				if err != nil {
-					logging.Logger.Error("error handling repository configuration created job", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
-				}
-				return nil
-			})
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-dequeueCtx.Done():
+			return
 		}
-	}()
-	go func() {
-		group := errgroup.Group{}
-		group.SetLimit(10)
-		for repoCreateJob := range a.WorkerPool.RepositoryConfigurationScheduled {
-			repoCreateJob := repoCreateJob
-			group.Go(func() error {
-				err := a.HandleRepositoryConfigurationScheduledJob(repoCreateJob)
-				if err != nil {
-					logging.Logger.Error("error handling repository configuration created job", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
-				}
-				return nil
-			})
+
+		job, err := a.jobQueue.Dequeue(dequeueCtx, name)
+		if err != nil {
+			<-slots
+			if dequeueCtx.Err() != nil {
+				return
+			}
+			logging.Logger.Error(fmt.Sprintf("error dequeueing %s job", name), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+			time.Sleep(time.Second)
+			continue
+		}
+
+		a.workers.Add(1)
+		go func() {
+			defer a.workers.Done()
+			defer func() { <-slots }()
+			a.processJob(jobsCtx, *job)
+		}()
+	}
+}
+
+// processJob runs a dequeued job and moves it to its next status, the job's visibility is
+// extended while it runs so no other worker picks it up.
+func (a *App) processJob(ctx context.Context, job queue.Job) {
+	var queuedJob QueuedJob
+	if err := json.Unmarshal(job.Payload, &queuedJob); err != nil {
+		logging.Logger.Error(fmt.Sprintf("error unmarshalling job %s", job.ID), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+		if err := a.jobQueue.Fail(job.ID, job.Receipt, err.Error()); err != nil {
+			logging.Logger.Error(fmt.Sprintf("error failing job %s", job.ID), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
 		}
-	}()
+		return
+	}
+
+	var handler jobHandler
+	switch queuedJob.Type {
+	case runModels.RunTypeCreated:
+		handler = a.HandleRepositoryConfigurationCreatedJob
+	case runModels.RunTypeRelease:
+		handler = a.HandleReleaseJob
+	default:
+		handler = a.HandleRepositoryConfigurationScheduledJob
+	}
+
+	done := make(chan struct{})
+	go a.extendVisibility(job, done)
+
+	jobCtx, cancel := context.WithTimeout(ctx, a.jobTimeout)
+	requeueAt, jobErr := a.runJob(jobCtx, queuedJob, handler)
+	cancel()
+	close(done)
+
+	var err error
+	switch {
+	case !requeueAt.IsZero():
+		err = a.jobQueue.Requeue(job.ID, job.Receipt, requeueAt)
+	case jobErr != nil:
+		logging.Logger.Error(fmt.Sprintf("error handling repository configuration %s job", queuedJob.Type), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: jobErr})
+		err = a.jobQueue.Fail(job.ID, job.Receipt, jobErr.Error())
+	default:
+		err = a.jobQueue.Complete(job.ID, job.Receipt)
+	}
+	if err != nil {
+		logging.Logger.Error(fmt.Sprintf("error updating job %s", job.ID), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+	}
+}
 
+// extendVisibility extends the job's visibility halfway through each timeout until done is closed.
+func (a *App) extendVisibility(job queue.Job, done chan struct{}) {
+	interval := time.Until(job.VisibleAt) / 2
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := a.jobQueue.Extend(job.ID, job.Receipt); err != nil {
+				logging.Logger.Error(fmt.Sprintf("error extending job %s", job.ID), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+				return
+			}
+		}
+	}
 }
 
-func (a *App) loadSchedules() error {
-	repositoryConfigurations, err := a.strapiClient.GetRepositoryConfigurations()
+// loadSchedules brings the schedules in line with the repository configurations in Strapi.
+// New configurations are scheduled and caught up on, a changed cron replaces its job and
+// configurations deleted, switched to pushes or left without a cron are unscheduled. Strapi
+// sends each webhook to one replica, so besides at startup the schedules are reloaded when a
+// replica is elected leader and every schedule sync interval. A replica just elected also
+// catches up on the configurations it already scheduled, their generations may have elapsed
+// while no replica led.
+func (a *App) loadSchedules(ctx context.Context, elected bool) error {
+	a.schedulesMu.Lock()
+	defer a.schedulesMu.Unlock()
+
+	repositoryConfigurations, err := a.strapiClient.GetRepositoryConfigurations(ctx)
 	if err != nil {
 		return fmt.Errorf("error getting repository configurations: %w", err)
 	}
 
+	scheduled := make(map[int]bool, len(repositoryConfigurations))
+
 	for _, repositoryConfiguration := range repositoryConfigurations {
 
-		if repositoryConfiguration.Cron == "" || repositoryConfiguration.NextGeneration == nil {
+		if repositoryConfiguration.Cron == "" || repositoryConfiguration.Trigger == strapiModels.TriggerPush {
+			continue
+		}
+		scheduled[repositoryConfiguration.ID] = true
+
+		// a configuration already scheduled only needs a new job for a new cron
+		if a.scheduler.Scheduled(repositoryConfiguration.ID) {
+			if elected {
+				if err := a.catchUpScheduled(ctx, repositoryConfiguration.ID); err != nil {
+					logging.Logger.Error(fmt.Sprintf("error catching up repository configuration: %d", repositoryConfiguration.ID), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+				}
+			}
+
+			_, err := a.scheduler.Reschedule(ctx, repositoryConfiguration)
+			if errors.Is(err, ErrInvalidSchedule) {
+				logging.Logger.Error(fmt.Sprintf("keeping the schedule of repository configuration: %d", repositoryConfiguration.ID), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("error rescheduling repository configuration: %w", err)
+			}
 			continue
 		}
+
 		logging.Logger.Info(fmt.Sprintf("scheduling job for repository configuration: %d", repositoryConfiguration.ID))
-		fullRepositoryConfiguration, err := a.strapiClient.GetRepositoryConfiguration(repositoryConfiguration.ID)
+		fullRepositoryConfiguration, err := a.strapiClient.GetRepositoryConfiguration(ctx, repositoryConfiguration.ID)
 		if err != nil {
 			return fmt.Errorf("error getting repository configuration: %w", err)
 		}
 
-		scheduleStrings := strings.Split(repositoryConfiguration.Cron, " ")
-		numberString, interval := scheduleStrings[0], scheduleStrings[1]
-		number, err := strconv.Atoi(numberString)
+		// the generations missed while the service was down are found before scheduling moves NextGeneration on
+		var missed []time.Time
+		if schedule, err := ParseSchedule(fullRepositoryConfiguration.Cron); err == nil && fullRepositoryConfiguration.NextGeneration != nil {
+			missed = schedule.Elapsed(*fullRepositoryConfiguration.NextGeneration, time.Now())
+		}
+
+		_, err = a.scheduler.Schedule(ctx, *fullRepositoryConfiguration)
+		if errors.Is(err, ErrInvalidSchedule) {
+			logging.Logger.Error(fmt.Sprintf("skipping repository configuration: %d", fullRepositoryConfiguration.ID), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+			continue
+		}
 		if err != nil {
-			return fmt.Errorf("error converting string to number: %w", err)
+			return fmt.Errorf("error scheduling repository configuration: %w", err)
 		}
-		switch interval {
-		case "days":
-			job, err := a.cron.
-				Every(int(number)).
-				Day().
-				Tag(fmt.Sprint(fullRepositoryConfiguration.ID)).
-				StartAt(*fullRepositoryConfiguration.NextGeneration).
-				Do(func() {
-					a.WorkerPool.RepositoryConfigurationScheduled <- *fullRepositoryConfiguration
-				})
-			if err != nil {
-				return fmt.Errorf("error scheduling job: %w", err)
-			}
-			a.jobs[fmt.Sprint(fullRepositoryConfiguration.ID)] = job
-			nextRun := job.NextRun()
-			repositoryConfiguration.NextGeneration = &nextRun
-			_, err = a.strapiClient.UpdateRepositoryConfiguration(repositoryConfiguration)
-			if err != nil {
-				return fmt.Errorf("error updating repository configuration: %w", err)
-			}
 
-		case "weeks":
-			job, err := a.cron.
-				Every(int(number)).
-				Week().
-				Tag(fmt.Sprint(fullRepositoryConfiguration.ID)).
-				StartAt(*fullRepositoryConfiguration.NextGeneration).
-				Do(func() {
-					a.WorkerPool.RepositoryConfigurationScheduled <- *fullRepositoryConfiguration
-				})
-			if err != nil {
-				return fmt.Errorf("error scheduling job: %w", err)
-			}
-			a.jobs[fmt.Sprint(fullRepositoryConfiguration.ID)] = job
-			nextRun := job.NextRun()
-			repositoryConfiguration.NextGeneration = &nextRun
-			_, err = a.strapiClient.UpdateRepositoryConfiguration(repositoryConfiguration)
-			if err != nil {
-				return fmt.Errorf("error updating repository configuration: %w", err)
-			}
+		if err := a.catchUp(ctx, *fullRepositoryConfiguration, missed); err != nil {
+			logging.Logger.Error(fmt.Sprintf("error catching up repository configuration: %d", fullRepositoryConfiguration.ID), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+		}
 
-		default:
-			return fmt.Errorf("invalid interval: %s", interval)
+	}
 
+	for _, id := range a.scheduler.IDs() {
+		if scheduled[id] {
+			continue
+		}
+		logging.Logger.Info(fmt.Sprintf("unscheduling repository configuration: %d, it is no longer scheduled in strapi", id))
+		if err := a.scheduler.Unschedule(id); err != nil {
+			return fmt.Errorf("error unscheduling repository configuration: %w", err)
 		}
-
 	}
 
 	return nil
 }
 
+// syncSchedules reloads the schedules from Strapi, logging rather than returning the error as
+// it has no caller to return it to.
+func (a *App) syncSchedules(elected bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), callbackTimeout)
+	defer cancel()
+
+	if err := a.loadSchedules(ctx, elected); err != nil {
+		logging.Logger.Error("error syncing schedules", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+	}
+}
+
+// enqueueScheduledRepositoryConfiguration fetches the latest configuration so each run diffs from
+// the last generation. Once the run is queued the next generation is persisted, a generation
+// that could not be queued is caught up on after a restart.
+func (a *App) enqueueScheduledRepositoryConfiguration(id int) {
+	firedAt := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), callbackTimeout)
+	defer cancel()
+
+	repositoryConfiguration, err := a.strapiClient.GetRepositoryConfiguration(ctx, id)
+	var statusErr *strapi.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		logging.Logger.Info(fmt.Sprintf("unscheduling deleted repository configuration: %d", id))
+		if err := a.scheduler.Unschedule(id); err != nil {
+			logging.Logger.Error(fmt.Sprintf("error unscheduling repository configuration: %d", id), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+		}
+		return
+	}
+	if err != nil {
+		logging.Logger.Error(fmt.Sprintf("error getting repository configuration for scheduled job: %d", id), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+		return
+	}
+
+	// a webhook handled by another replica may have changed the schedule since the last sync,
+	// the job only runs on the schedule the configuration still has
+	if repositoryConfiguration.Cron == "" || repositoryConfiguration.Trigger == strapiModels.TriggerPush {
+		logging.Logger.Info(fmt.Sprintf("repository configuration: %d is no longer scheduled, unscheduling instead of generating", id))
+		if err := a.scheduler.Unschedule(id); err != nil {
+			logging.Logger.Error(fmt.Sprintf("error unscheduling repository configuration: %d", id), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+		}
+		return
+	}
+	if cron, _ := a.scheduler.Cron(id); repositoryConfiguration.Cron != cron {
+		logging.Logger.Info(fmt.Sprintf("schedule of repository configuration: %d changed, rescheduling instead of generating", id))
+		repositoryConfiguration.ID = id
+		if _, err := a.scheduler.Reschedule(ctx, *repositoryConfiguration); err != nil {
+			logging.Logger.Error(fmt.Sprintf("error rescheduling repository configuration: %d", id), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+		}
+		return
+	}
+
+	if _, err := a.enqueueJob(runModels.RunTypeScheduled, runModels.RunTriggerSchedule, *repositoryConfiguration); err != nil {
+		logging.Logger.Error(fmt.Sprintf("error enqueueing scheduled job: %d", id), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+		return
+	}
+
+	if err := a.scheduler.Advance(ctx, id, firedAt); err != nil {
+		logging.Logger.Error(fmt.Sprintf("error updating next generation of scheduled job: %d", id), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+	}
+}
+
 func (a *App) HandleGetJobs(c *gin.Context) {
 	var resp []map[string]interface{}
 
-	for _, job := range a.jobs {
+	for _, job := range a.scheduler.Jobs() {
 		resp = append(resp, map[string]interface{}{
 			"next_run": job.NextRun(),
 			"tags":     job.Tags(),
@@ -162,20 +441,77 @@ func (a *App) HandleGetJobs(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
-func NewApi(c Config, githubClient *github.Client, gptClient *gpt.ChatClient, strapiClient *strapi.Client) *App {
-	return &App{
+func NewApi(c Config, githubClient *github.Client, gptClient gpt.ChatClientInterface, strapiClient *strapi.Client, runs runStore.Store, jobs queue.Queue, locks lease.Locker) *App {
+	a := &App{
 		server: gin.Default(),
 
-		githubClient:  githubClient,
-		chatGptClient: gptClient,
-		strapiClient:  strapiClient,
-		port:          c.Port,
-		cron:          gocron.NewScheduler(time.UTC),
-		jobs:          make(map[string]*gocron.Job),
-		WorkerPool: &WorkerPool{
-			RepostioryConfigurationCreated: make(chan strapiModels.RepositoryConfiguration),
-		},
+		githubClient:        githubClient,
+		rateLimits:          ratelimit.NewLimiter(c.RateLimitMaxWait),
+		contentSourceKind:   c.ContentSource,
+		chatGptClient:       gptClient,
+		strapiClient:        strapiClient,
+		runStore:            runs,
+		normaliser:          normalise.NewNormaliser(c.Normalise),
+		selectionOptions:    c.Selection,
+		rerankFiles:         c.RerankFiles,
+		githubWebhookSecret: c.GitHubWebhookSecret,
+		strapiWebhook:       c.StrapiWebhook,
+		port:                c.Port,
+		jobQueue:            jobs,
+		locks:               locks,
+		replicaID:           c.ReplicaID,
+		catchUpPolicy:       c.CatchUp,
+		scheduleSync:        c.ScheduleSyncInterval,
+		retryPolicy:         c.Retry,
+		jobTimeout:          c.JobTimeout,
+		shutdownTimeout:     c.ShutdownTimeout,
+	}
+	if a.locks == nil {
+		a.locks = lease.NewMemoryLocker()
+	}
+	if a.replicaID == "" {
+		a.replicaID, _ = os.Hostname()
+	}
+	if a.catchUpPolicy == "" {
+		a.catchUpPolicy = CatchUpOnce
+	}
+	if a.jobTimeout <= 0 {
+		a.jobTimeout = DefaultJobTimeout
+	}
+	if a.shutdownTimeout <= 0 {
+		a.shutdownTimeout = DefaultShutdownTimeout
+	}
+	if a.scheduleSync <= 0 {
+		a.scheduleSync = DefaultScheduleSyncInterval
 	}
+	if a.strapiWebhook.Secret == "" {
+		logging.Logger.Warn("strapi webhook secret is not configured, repository configuration webhooks are rejected with 503 until it is set")
+	}
+	if a.strapiWebhook.Header == "" {
+		a.strapiWebhook.Header = "X-Strapi-Webhook-Secret"
+	}
+	if a.strapiWebhook.Tolerance == 0 {
+		a.strapiWebhook.Tolerance = 5 * time.Minute
+	}
+	a.strapiDeliveries = newDeliveries(a.locks, a.strapiWebhook.Tolerance)
+	if a.selectionOptions == (selection.Options{}) {
+		a.selectionOptions = selection.DefaultOptions()
+	}
+
+	a.installationTokens = tokenService.NewInstallationTokenCache(githubClient, a.rateLimits)
+	// every replica keeps the schedules and renews the leader lease while it runs, only the
+	// leader runs them and another replica takes over once it stops renewing
+	a.leader = &lease.Elector{
+		Locker: a.locks,
+		Key:    leaderLeaseKey,
+		Holder: a.replicaID,
+		TTL:    c.LeaderLeaseTTL,
+	}
+	cron := gocron.NewScheduler(time.UTC)
+	cron.WithDistributedElector(a.leader)
+	a.scheduler = NewScheduler(cron, strapiClient, a.enqueueScheduledRepositoryConfiguration)
+
+	return a
 }
 
 var num = 1
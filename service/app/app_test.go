@@ -0,0 +1,388 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gpt "github.com/TonyDMorris/quick-function/pkg/gpt/client"
+	"github.com/TonyDMorris/quick-function/pkg/lease"
+	"github.com/TonyDMorris/quick-function/pkg/queue"
+	runStore "github.com/TonyDMorris/quick-function/pkg/runs/store"
+	strapi "github.com/TonyDMorris/quick-function/pkg/strapi/client"
+	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-github/v56/github"
+)
+
+const (
+	testWebhookSecret = "test-secret"
+	testOwner         = "octocat"
+	testRepo          = "hello-world"
+	testBranch        = "main"
+	testHeadSHA       = "head"
+)
+
+// newTestApp builds an App calling the fake GitHub and Strapi servers, chatting through the
+// fake provider and keeping its runs in memory.
+func newTestApp(t *testing.T, githubAPI *fakeGitHub, strapiAPI *fakeStrapi) (*App, *gpt.FakeChatClient) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	githubServer := httptest.NewServer(githubAPI)
+	t.Cleanup(githubServer.Close)
+	strapiServer := httptest.NewServer(strapiAPI)
+	t.Cleanup(strapiServer.Close)
+
+	githubClient := github.NewClient(nil)
+	baseURL, err := url.Parse(githubServer.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	githubClient.BaseURL = baseURL
+	githubClient.UploadURL = baseURL
+
+	runs, err := runStore.NewFileStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chatClient := gpt.NewFakeChatClient()
+
+	a := NewApi(Config{GitHubWebhookSecret: testWebhookSecret}, githubClient, chatClient, strapi.NewClient("test", strapiServer.URL), runs, queue.NewMemoryQueue(queue.Options{}), lease.NewMemoryLocker())
+
+	return a, chatClient
+}
+
+// testRepositoryConfiguration is a configuration of the fake GitHub's repository.
+func testRepositoryConfiguration(id int) strapiModels.RepositoryConfiguration {
+	return strapiModels.RepositoryConfiguration{
+		ID: id,
+		Repository: &strapiModels.Repository{
+			ID:           1,
+			Name:         testRepo,
+			FullName:     testOwner + "/" + testRepo,
+			RepositoryID: "1296269",
+		},
+		Installation: &strapiModels.Installation{
+			ID:             1,
+			InstallationID: "1",
+			Username:       testOwner,
+		},
+	}
+}
+
+// fakeGitHub serves the GitHub API calls of the jobs for a single repository whose default
+// branch holds the files at testHeadSHA, as does every other commit. Blobs are addressed by
+// "blob-" and their path.
+type fakeGitHub struct {
+	files map[string]string
+	// commits and tags are listed newest first, a page at a time.
+	commits    []*github.RepositoryCommit
+	tags       []*github.RepositoryTag
+	comparison *github.CommitsComparison
+	// commitFiles lists the files each commit touched, commits listed by path are filtered by it.
+	commitFiles map[string][]string
+	// readOnly refuses tokens asking for write permissions, as for an app installed without them.
+	readOnly bool
+
+	mu          sync.Mutex
+	compared    []string
+	pullLookups []string
+}
+
+func (g *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	repoPath := "/repos/" + testOwner + "/" + testRepo
+
+	switch path := r.URL.Path; {
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/app/installations/") && strings.HasSuffix(path, "/access_tokens"):
+		var options github.InstallationTokenOptions
+		if err := json.NewDecoder(r.Body).Decode(&options); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if g.readOnly && options.Permissions.GetContents() == "write" {
+			writeJSON(w, http.StatusUnprocessableEntity, github.ErrorResponse{Message: "The permissions requested are not granted to this installation."})
+			return
+		}
+		writeJSON(w, http.StatusCreated, github.InstallationToken{
+			Token:     github.String("installation-token"),
+			ExpiresAt: &github.Timestamp{Time: time.Now().Add(time.Hour)},
+		})
+	case path == repoPath:
+		writeJSON(w, http.StatusOK, github.Repository{DefaultBranch: github.String(testBranch)})
+	case path == repoPath+"/branches/"+testBranch:
+		writeJSON(w, http.StatusOK, github.Branch{Name: github.String(testBranch), Commit: &github.RepositoryCommit{SHA: github.String(testHeadSHA)}})
+	case strings.HasPrefix(path, repoPath+"/git/trees/"):
+		writeJSON(w, http.StatusOK, g.tree())
+	case strings.HasPrefix(path, repoPath+"/git/blobs/blob-"):
+		content, ok := g.files[strings.TrimPrefix(path, repoPath+"/git/blobs/blob-")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	case path == repoPath+"/commits":
+		writePage(w, r, g.commitsTouching(r.URL.Query().Get("path")))
+	case strings.HasPrefix(path, repoPath+"/commits/") && strings.HasSuffix(path, "/pulls"):
+		g.mu.Lock()
+		g.pullLookups = append(g.pullLookups, strings.TrimSuffix(strings.TrimPrefix(path, repoPath+"/commits/"), "/pulls"))
+		g.mu.Unlock()
+		writeJSON(w, http.StatusOK, []*github.PullRequest{})
+	case path == repoPath+"/tags":
+		writePage(w, r, g.tags)
+	case strings.HasPrefix(path, repoPath+"/compare/") && g.comparison != nil:
+		g.mu.Lock()
+		g.compared = append(g.compared, strings.TrimPrefix(path, repoPath+"/compare/"))
+		g.mu.Unlock()
+		writeJSON(w, http.StatusOK, g.comparison)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// commitsTouching returns the commits touching a file under the path, every commit when it is empty.
+func (g *fakeGitHub) commitsTouching(path string) []*github.RepositoryCommit {
+	if path == "" || g.commitFiles == nil {
+		return g.commits
+	}
+
+	var commits []*github.RepositoryCommit
+	for _, commit := range g.commits {
+		for _, file := range g.commitFiles[commit.GetSHA()] {
+			if file == path || strings.HasPrefix(file, path+"/") {
+				commits = append(commits, commit)
+				break
+			}
+		}
+	}
+	return commits
+}
+
+func (g *fakeGitHub) tree() github.Tree {
+	var paths []string
+	for path := range g.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	tree := github.Tree{SHA: github.String(testHeadSHA), Truncated: github.Bool(false)}
+	for _, path := range paths {
+		tree.Entries = append(tree.Entries, &github.TreeEntry{
+			Path: github.String(path),
+			Type: github.String("blob"),
+			SHA:  github.String("blob-" + path),
+			Size: github.Int(len(g.files[path])),
+		})
+	}
+
+	return tree
+}
+
+// writePage writes the page of the items the request asks for, linking the next page as GitHub does.
+func writePage[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 {
+		perPage = 30
+	}
+
+	start := (page - 1) * perPage
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+
+	if end < len(items) {
+		next := *r.URL
+		query := next.Query()
+		query.Set("page", strconv.Itoa(page+1))
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s%s>; rel="next"`, r.Host, next.String()))
+	}
+
+	writeJSON(w, http.StatusOK, items[start:end])
+}
+
+// Compared returns the base...head ranges the jobs compared.
+func (g *fakeGitHub) Compared() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([]string(nil), g.compared...)
+}
+
+// PullLookups returns the commits the jobs looked up merged pull requests for.
+func (g *fakeGitHub) PullLookups() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([]string(nil), g.pullLookups...)
+}
+
+// fakeStrapi serves the Strapi API from the configurations and records what the app writes.
+type fakeStrapi struct {
+	mu             sync.Mutex
+	configurations []strapiModels.RepositoryConfiguration
+	posts          []strapiModels.GitBlogPost
+	updates        map[int][]map[string]interface{}
+	syncs          []strapiModels.InstallationSync
+	deleted        []string
+	// failUpdates is the number of configuration updates answered with a request timeout
+	failUpdates int
+}
+
+func newFakeStrapi(configurations ...strapiModels.RepositoryConfiguration) *fakeStrapi {
+	return &fakeStrapi{
+		configurations: configurations,
+		updates:        make(map[int][]map[string]interface{}),
+	}
+}
+
+func (s *fakeStrapi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	const configurationsPath = "/api/internal/repository-configurations"
+	const installationsPath = "/api/internal/installations/"
+
+	switch path := r.URL.Path; {
+	case path == configurationsPath && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.configurations)
+	case strings.HasPrefix(path, configurationsPath+"/"):
+		id, err := strconv.Atoi(strings.TrimPrefix(path, configurationsPath+"/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Method == http.MethodPut && s.failUpdates > 0 {
+			s.failUpdates--
+			http.Error(w, "request timeout", http.StatusRequestTimeout)
+			return
+		}
+		if r.Method == http.MethodPut {
+			var carrier struct {
+				Data map[string]interface{} `json:"data"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&carrier); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			s.updates[id] = append(s.updates[id], carrier.Data)
+		}
+
+		for _, configuration := range s.configurations {
+			if configuration.ID == id {
+				writeJSON(w, http.StatusOK, configuration)
+				return
+			}
+		}
+		// the CMS answered for a missing configuration with a 200, as deployments before it
+		// answered with a 404 still do
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": false, "message": "Repository configuration not found"})
+	case path == "/api/git-blog-posts" && r.Method == http.MethodPost:
+		var carrier struct {
+			Data strapiModels.GitBlogPost `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&carrier); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		carrier.Data.ID = len(s.posts) + 1
+		s.posts = append(s.posts, carrier.Data)
+		writeJSON(w, http.StatusOK, carrier)
+	case path == installationsPath+"sync" && r.Method == http.MethodPost:
+		var installationSync strapiModels.InstallationSync
+		if err := json.NewDecoder(r.Body).Decode(&installationSync); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.syncs = append(s.syncs, installationSync)
+		writeJSON(w, http.StatusOK, strapiModels.Installation{InstallationID: installationSync.InstallationID, Username: installationSync.Username})
+	case strings.HasPrefix(path, installationsPath) && r.Method == http.MethodDelete:
+		s.deleted = append(s.deleted, strings.TrimPrefix(path, installationsPath))
+		writeJSON(w, http.StatusOK, struct{}{})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// SetConfigurations replaces the configurations, as edits made in Strapi do.
+func (s *fakeStrapi) SetConfigurations(configurations ...strapiModels.RepositoryConfiguration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.configurations = configurations
+}
+
+func (s *fakeStrapi) Posts() []strapiModels.GitBlogPost {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]strapiModels.GitBlogPost(nil), s.posts...)
+}
+
+func (s *fakeStrapi) Updates(id int) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]map[string]interface{}(nil), s.updates[id]...)
+}
+
+func (s *fakeStrapi) Syncs() []strapiModels.InstallationSync {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]strapiModels.InstallationSync(nil), s.syncs...)
+}
+
+func (s *fakeStrapi) Deleted() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.deleted...)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, contentSource := range []string{"", ContentSourceBlobs, ContentSourceArchive} {
+		if err := (Config{ContentSource: contentSource}).Validate(); err != nil {
+			t.Errorf("content source %q: %v", contentSource, err)
+		}
+	}
+
+	if err := (Config{ContentSource: "blob"}).Validate(); err == nil {
+		t.Error("expected an unknown content source to be rejected")
+	}
+
+	for _, catchUp := range []string{"", CatchUpOnce, CatchUpAll, CatchUpSkip} {
+		if err := (Config{CatchUp: catchUp}).Validate(); err != nil {
+			t.Errorf("catch-up policy %q: %v", catchUp, err)
+		}
+	}
+
+	if err := (Config{CatchUp: "every"}).Validate(); err == nil {
+		t.Error("expected an unknown catch-up policy to be rejected")
+	}
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/logging"
+	runModels "github.com/TonyDMorris/quick-function/pkg/runs/models"
+	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+)
+
+// Catch-up policies, what happens to scheduled generations that elapsed while the service was down.
+const (
+	// CatchUpOnce runs a single generation covering everything since the last one, the default.
+	CatchUpOnce = "once"
+	// CatchUpAll runs a generation for each missed window.
+	CatchUpAll = "all"
+	// CatchUpSkip leaves the missed commits to the next scheduled generation.
+	CatchUpSkip = "skip"
+)
+
+// maxCatchUpRuns bounds the runs queued for one configuration under CatchUpAll, the earliest
+// missed windows are merged into the first run.
+const maxCatchUpRuns = 10
+
+// catchUp queues runs for the generations of the repository configuration that elapsed while
+// the service was down, according to the catch-up policy. Only the leader catches up, another
+// replica would duplicate its runs.
+func (a *App) catchUp(ctx context.Context, repositoryConfiguration strapiModels.RepositoryConfiguration, missed []time.Time) error {
+	if len(missed) == 0 || a.catchUpPolicy == CatchUpSkip {
+		return nil
+	}
+
+	if err := a.leader.IsLeader(ctx); err != nil {
+		logging.Logger.Info(fmt.Sprintf("not catching up repository configuration: %d, another replica leads", repositoryConfiguration.ID))
+		return nil
+	}
+
+	logging.Logger.Info(fmt.Sprintf("repository configuration: %d missed %d generations since %s, catching up with policy %s", repositoryConfiguration.ID, len(missed), missed[0].Format(time.RFC3339), a.catchUpPolicy))
+
+	// without a last generation there is no window to start from, a single run posts the full repository
+	if a.catchUpPolicy != CatchUpAll || repositoryConfiguration.LastGeneration == nil {
+		_, err := a.enqueueJob(runModels.RunTypeScheduled, runModels.RunTriggerCatchUp, repositoryConfiguration)
+		return err
+	}
+
+	if len(missed) > maxCatchUpRuns {
+		missed = missed[len(missed)-maxCatchUpRuns:]
+	}
+
+	since := *repositoryConfiguration.LastGeneration
+	for _, until := range missed {
+		if !until.After(since) {
+			continue
+		}
+
+		windowSince, windowUntil := since, until
+		_, err := a.enqueueRun(runModels.Run{
+			Type:    runModels.RunTypeScheduled,
+			Trigger: runModels.RunTriggerCatchUp,
+			Since:   &windowSince,
+			Until:   &windowUntil,
+		}, repositoryConfiguration)
+		if err != nil {
+			return err
+		}
+
+		since = until
+	}
+
+	return nil
+}
+
+// catchUpScheduled catches up on the generations of a scheduled repository configuration that
+// elapsed before its next generation was moved on, such as while a leader handed over, and
+// persists the generation following them as the next one.
+func (a *App) catchUpScheduled(ctx context.Context, id int) error {
+	repositoryConfiguration, err := a.strapiClient.GetRepositoryConfiguration(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error getting repository configuration: %w", err)
+	}
+
+	schedule, err := ParseSchedule(repositoryConfiguration.Cron)
+	if err != nil || repositoryConfiguration.NextGeneration == nil {
+		return nil
+	}
+
+	missed := schedule.Elapsed(*repositoryConfiguration.NextGeneration, time.Now())
+	if len(missed) == 0 {
+		return nil
+	}
+
+	if err := a.catchUp(ctx, *repositoryConfiguration, missed); err != nil {
+		return err
+	}
+
+	return a.scheduler.Advance(ctx, id, missed[len(missed)-1])
+}
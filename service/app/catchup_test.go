@@ -0,0 +1,100 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	runModels "github.com/TonyDMorris/quick-function/pkg/runs/models"
+	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+)
+
+func TestCatchUp(t *testing.T) {
+	lastGeneration := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+
+	var missed []time.Time
+	for i := 1; i <= 12; i++ {
+		missed = append(missed, lastGeneration.AddDate(0, 0, i))
+	}
+
+	tests := []struct {
+		name           string
+		policy         string
+		lastGeneration *time.Time
+		missed         []time.Time
+		wantRuns       int
+		wantWindows    bool
+	}{
+		{name: "nothing missed", policy: CatchUpAll, lastGeneration: &lastGeneration},
+		{name: "skip", policy: CatchUpSkip, lastGeneration: &lastGeneration, missed: missed},
+		{name: "once", policy: CatchUpOnce, lastGeneration: &lastGeneration, missed: missed, wantRuns: 1},
+		{name: "all", policy: CatchUpAll, lastGeneration: &lastGeneration, missed: missed[:3], wantRuns: 3, wantWindows: true},
+		{name: "all bounded", policy: CatchUpAll, lastGeneration: &lastGeneration, missed: missed, wantRuns: maxCatchUpRuns, wantWindows: true},
+		{name: "all without a last generation", policy: CatchUpAll, missed: missed, wantRuns: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, runs, _ := newDeadLetterTestApp(t, 1)
+			a.catchUpPolicy = tt.policy
+
+			configuration := strapiModels.RepositoryConfiguration{ID: 1, Cron: "1 days", LastGeneration: tt.lastGeneration}
+			if err := a.catchUp(context.Background(), configuration, tt.missed); err != nil {
+				t.Fatalf("catchUp() error = %v", err)
+			}
+
+			queued, err := runs.List(runModels.RunFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(queued) != tt.wantRuns {
+				t.Fatalf("runs = %d, want %d", len(queued), tt.wantRuns)
+			}
+
+			// windows follow on from each other and end at the missed generations
+			windows := make(map[time.Time]time.Time)
+			for _, run := range queued {
+				if run.Trigger != runModels.RunTriggerCatchUp || run.Type != runModels.RunTypeScheduled {
+					t.Errorf("run = %+v, want a scheduled catch-up run", run)
+				}
+				if (run.Since != nil) != tt.wantWindows || (run.Until != nil) != tt.wantWindows {
+					t.Errorf("run window = %v..%v, want windows %t", run.Since, run.Until, tt.wantWindows)
+				}
+				if run.Since != nil && run.Until != nil {
+					windows[*run.Since] = *run.Until
+				}
+			}
+			if !tt.wantWindows {
+				return
+			}
+
+			// when bounded the earliest missed windows are merged into the first run
+			since := lastGeneration
+			for _, until := range tt.missed[len(tt.missed)-tt.wantRuns:] {
+				if windows[since] != until {
+					t.Errorf("window from %s ends at %s, want %s", since, windows[since], until)
+				}
+				since = until
+			}
+		})
+	}
+}
+
+func TestCatchUpFollower(t *testing.T) {
+	a, runs, _ := newDeadLetterTestApp(t, 1)
+
+	// another replica leads, it catches up instead
+	if err := a.locks.Acquire(context.Background(), leaderLeaseKey, "other-replica", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	lastGeneration := time.Now().AddDate(0, 0, -3).UTC()
+	configuration := strapiModels.RepositoryConfiguration{ID: 1, Cron: "1 days", LastGeneration: &lastGeneration}
+	if err := a.catchUp(context.Background(), configuration, []time.Time{lastGeneration.AddDate(0, 0, 1)}); err != nil {
+		t.Fatalf("catchUp() error = %v", err)
+	}
+
+	if queued, err := runs.List(runModels.RunFilter{}); err != nil || len(queued) != 0 {
+		t.Errorf("runs = %d, %v, want none on a follower", len(queued), err)
+	}
+}
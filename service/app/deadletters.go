@@ -0,0 +1,161 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+
+	gpt "github.com/TonyDMorris/quick-function/pkg/gpt/client"
+	"github.com/TonyDMorris/quick-function/pkg/queue"
+	"github.com/TonyDMorris/quick-function/pkg/retry"
+	runModels "github.com/TonyDMorris/quick-function/pkg/runs/models"
+	runStore "github.com/TonyDMorris/quick-function/pkg/runs/store"
+	strapi "github.com/TonyDMorris/quick-function/pkg/strapi/client"
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-github/v56/github"
+)
+
+var (
+	// ErrNoFiles is returned when a repository has no files to generate from.
+	ErrNoFiles = errors.New("no files found")
+	// ErrNoInstallation is returned when a configuration has no installation or repository.
+	ErrNoInstallation = errors.New("installation or repository is nil")
+	// ErrNoInterestedFiles is returned when none of the files of a repository are worth reading.
+	ErrNoInterestedFiles = errors.New("no interested files found")
+	// ErrNoContents is returned when none of the files read have any contents.
+	ErrNoContents = errors.New("no contents found")
+	// ErrNoContentsWrite is returned when the GitHub App is refused a token to edit releases.
+	ErrNoContentsWrite = errors.New("the GitHub App lacks contents:write, grant it to write release notes to releases")
+)
+
+// classify marks the errors that retrying a job cannot fix as permanent: a repository without
+// files worth reading, a configuration without an installation, an invalid schedule, an app
+// without the permissions a release needs and client errors from GitHub, the LLM provider or
+// Strapi such as a missing repository, a revoked installation or a prompt the model refuses.
+// Anything else, timeouts, rate limits and server errors, is retried.
+func classify(err error) error {
+	if err == nil || retry.IsPermanent(err) {
+		return err
+	}
+
+	for _, permanent := range []error{ErrNoFiles, ErrNoInstallation, ErrNoInterestedFiles, ErrNoContents, ErrNoContentsWrite, ErrInvalidSchedule} {
+		if errors.Is(err, permanent) {
+			return retry.Permanent(err)
+		}
+	}
+
+	var githubErr *github.ErrorResponse
+	if errors.As(err, &githubErr) && githubErr.Response != nil && isClientError(githubErr.Response.StatusCode) {
+		return retry.Permanent(err)
+	}
+
+	var gptErr *gpt.StatusError
+	if errors.As(err, &gptErr) && isClientError(gptErr.StatusCode) {
+		return retry.Permanent(err)
+	}
+
+	var strapiErr *strapi.StatusError
+	if errors.As(err, &strapiErr) && isClientError(strapiErr.StatusCode) {
+		return retry.Permanent(err)
+	}
+
+	return err
+}
+
+// isClientError reports whether the status means the request itself is wrong, request
+// timeouts and rate limits are worth retrying.
+func isClientError(statusCode int) bool {
+	return statusCode >= 400 && statusCode < 500 &&
+		statusCode != http.StatusRequestTimeout && statusCode != http.StatusTooManyRequests
+}
+
+// HandleGetDeadLetters lists the jobs that failed permanently or ran out of retries.
+func (a *App) HandleGetDeadLetters(c *gin.Context) {
+	jobs, err := a.jobQueue.List(queue.StatusFailed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+func (a *App) HandleGetDeadLetter(c *gin.Context) {
+	job, err := a.jobQueue.Get(c.Param("id"))
+	if errors.Is(err, queue.ErrJobNotFound) || (err == nil && job.Status != queue.StatusFailed) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "dead letter not found: " + c.Param("id"),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// HandleRequeueDeadLetter queues a dead-lettered job again and resets its run, its attempts
+// start over.
+func (a *App) HandleRequeueDeadLetter(c *gin.Context) {
+	id := c.Param("id")
+
+	// the job ID is the ID of its run, which is loaded before the job is revived so a job is
+	// never queued again without its run
+	run, err := a.runStore.Get(id)
+	if errors.Is(err, runStore.ErrRunNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	err = a.jobQueue.Revive(id)
+	if errors.Is(err, queue.ErrJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, queue.ErrInvalidTransition) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	run.Status = runModels.RunStatusQueued
+	run.Attempts = 0
+	run.StartedAt = nil
+	run.EndedAt = nil
+	run.Error = ""
+
+	if err := a.runStore.Update(*run); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"run_id": run.ID,
+		"status": run.Status,
+		"url":    "/runs/" + run.ID,
+	})
+}
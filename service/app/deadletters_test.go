@@ -0,0 +1,280 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gpt "github.com/TonyDMorris/quick-function/pkg/gpt/client"
+	gptModels "github.com/TonyDMorris/quick-function/pkg/gpt/models"
+	"github.com/TonyDMorris/quick-function/pkg/lease"
+	"github.com/TonyDMorris/quick-function/pkg/queue"
+	"github.com/TonyDMorris/quick-function/pkg/retry"
+	runModels "github.com/TonyDMorris/quick-function/pkg/runs/models"
+	runStore "github.com/TonyDMorris/quick-function/pkg/runs/store"
+	strapi "github.com/TonyDMorris/quick-function/pkg/strapi/client"
+	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-github/v56/github"
+)
+
+func TestClassify(t *testing.T) {
+	githubError := func(statusCode int) error {
+		return &github.ErrorResponse{Response: &http.Response{StatusCode: statusCode, Request: &http.Request{}}}
+	}
+
+	tests := []struct {
+		name      string
+		err       error
+		permanent bool
+	}{
+		{name: "no files", err: fmt.Errorf("error generating: %w", ErrNoFiles), permanent: true},
+		{name: "no installation", err: ErrNoInstallation, permanent: true},
+		{name: "no interested files", err: ErrNoInterestedFiles, permanent: true},
+		{name: "no contents", err: fmt.Errorf("error getting contents: %w", ErrNoContents), permanent: true},
+		{name: "invalid schedule", err: fmt.Errorf("%w: every day", ErrInvalidSchedule), permanent: true},
+		{name: "already permanent", err: retry.Permanent(errors.New("bad input")), permanent: true},
+		{name: "github not found", err: fmt.Errorf("error getting repository: %w", githubError(http.StatusNotFound)), permanent: true},
+		{name: "github forbidden", err: githubError(http.StatusForbidden), permanent: true},
+		{name: "github rate limit", err: githubError(http.StatusTooManyRequests)},
+		{name: "github server error", err: githubError(http.StatusBadGateway)},
+		{name: "provider bad request", err: fmt.Errorf("error chatting: %w", &gpt.StatusError{StatusCode: http.StatusBadRequest}), permanent: true},
+		{name: "provider unauthorised", err: &gpt.StatusError{StatusCode: http.StatusUnauthorized}, permanent: true},
+		{name: "provider rate limit", err: &gpt.StatusError{StatusCode: http.StatusTooManyRequests}},
+		{name: "provider server error", err: &gpt.StatusError{StatusCode: http.StatusBadGateway}},
+		{name: "strapi not found", err: &strapi.StatusError{StatusCode: http.StatusNotFound}, permanent: true},
+		{name: "strapi timeout", err: &strapi.StatusError{StatusCode: http.StatusRequestTimeout}},
+		{name: "strapi server error", err: &strapi.StatusError{StatusCode: http.StatusServiceUnavailable}},
+		{name: "network", err: errors.New("connection reset by peer")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retry.IsPermanent(classify(tt.err)); got != tt.permanent {
+				t.Errorf("classify(%v) permanent = %t, want %t", tt.err, got, tt.permanent)
+			}
+		})
+	}
+
+	if classify(nil) != nil {
+		t.Error("classify(nil) != nil")
+	}
+}
+
+func TestClassifyProviderClientErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"maximum context length exceeded"}}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	chatClient := gpt.NewOpenAICompatibleChatClient(gpt.ProviderConfig{BaseURL: server.URL})
+
+	_, err := chatClient.Chat(context.Background(), []gptModels.Message{{Role: gptModels.RoleUser, Content: "hello"}}, gptModels.CompletionOptions{})
+	if !retry.IsPermanent(classify(fmt.Errorf("error chatting: %w", err))) {
+		t.Errorf("classify(%v) is not permanent, a rejected prompt is rejected again", err)
+	}
+}
+
+// newDeadLetterTestApp returns an App retrying failed jobs up to the attempts, without delay
+// beyond a millisecond.
+func newDeadLetterTestApp(t *testing.T, maxAttempts int) (*App, runStore.Store, queue.Queue) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	runs, err := runStore.NewFileStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := queue.NewMemoryQueue(queue.Options{})
+
+	a := NewApi(Config{Retry: retry.Policy{MaxAttempts: maxAttempts, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}}, github.NewClient(nil), nil, nil, runs, jobs, lease.NewMemoryLocker())
+	a.setupRoutes()
+
+	return a, runs, jobs
+}
+
+func TestRunJobRetries(t *testing.T) {
+	a, runs, _ := newDeadLetterTestApp(t, 3)
+
+	run, err := a.enqueueJob(runModels.RunTypeScheduled, runModels.RunTriggerManual, strapiModels.RepositoryConfiguration{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queuedJob := QueuedJob{RunID: run.ID, Type: run.Type, RepositoryConfiguration: strapiModels.RepositoryConfiguration{ID: 1}}
+
+	calls := 0
+	failing := func(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) error {
+		calls++
+		return errors.New("connection reset by peer")
+	}
+
+	// the first attempts are requeued with the run back in the queue
+	for attempt := 1; attempt < 3; attempt++ {
+		retryAt, err := a.runJob(context.Background(), queuedJob, failing)
+		if err != nil || retryAt.IsZero() {
+			t.Fatalf("attempt %d: runJob() = %s, %v, want a retry", attempt, retryAt, err)
+		}
+
+		got, err := runs.Get(run.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != runModels.RunStatusQueued || got.Attempts != attempt || got.Error == "" || got.StartedAt != nil {
+			t.Errorf("attempt %d: run = %+v, want it queued with the error", attempt, got)
+		}
+	}
+
+	// the last attempt fails the run and the job is dead-lettered
+	retryAt, err := a.runJob(context.Background(), queuedJob, failing)
+	if err == nil || !retryAt.IsZero() {
+		t.Fatalf("last attempt: runJob() = %s, %v, want the error", retryAt, err)
+	}
+
+	got, err := runs.Get(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != runModels.RunStatusFailed || got.Attempts != 3 || got.EndedAt == nil {
+		t.Errorf("run = %+v, want it failed after 3 attempts", got)
+	}
+	if calls != 3 {
+		t.Errorf("handler calls = %d, want 3", calls)
+	}
+}
+
+func TestRunJobPermanentError(t *testing.T) {
+	a, runs, _ := newDeadLetterTestApp(t, 3)
+
+	run, err := a.enqueueJob(runModels.RunTypeCreated, runModels.RunTriggerManual, strapiModels.RepositoryConfiguration{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retryAt, err := a.runJob(context.Background(), QueuedJob{RunID: run.ID, Type: run.Type}, func(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) error {
+		return ErrNoFiles
+	})
+	if !errors.Is(err, ErrNoFiles) || !retryAt.IsZero() {
+		t.Fatalf("runJob() = %s, %v, want %v without a retry", retryAt, err, ErrNoFiles)
+	}
+
+	got, err := runs.Get(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != runModels.RunStatusFailed || got.Attempts != 1 {
+		t.Errorf("run = %+v, want it failed on the first attempt", got)
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	a, runs, jobs := newDeadLetterTestApp(t, 1)
+
+	run, err := a.enqueueJob(runModels.RunTypeScheduled, runModels.RunTriggerManual, strapiModels.RepositoryConfiguration{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := a.enqueueJob(runModels.RunTypeScheduled, runModels.RunTriggerManual, strapiModels.RepositoryConfiguration{ID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	job, err := jobs.Dequeue(ctx, queueScheduled)
+	if err != nil || job.ID != run.ID {
+		t.Fatalf("Dequeue() = %+v, %v, want run %s", job, err, run.ID)
+	}
+	if _, err := a.runJob(context.Background(), QueuedJob{RunID: run.ID, Type: run.Type}, func(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) error {
+		return errors.New("provider unavailable")
+	}); err == nil {
+		t.Fatal("runJob() error = nil")
+	}
+	if err := jobs.Fail(job.ID, job.Receipt, "provider unavailable"); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		a.server.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		return recorder
+	}
+
+	recorder := serve(http.MethodGet, "/dead-letters")
+	var deadLetters []queue.Job
+	if err := json.Unmarshal(recorder.Body.Bytes(), &deadLetters); err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].ID != run.ID || deadLetters[0].Error != "provider unavailable" {
+		t.Fatalf("dead letters = %+v, want run %s", deadLetters, run.ID)
+	}
+
+	for path, want := range map[string]int{
+		"/dead-letters/" + run.ID:   http.StatusOK,
+		"/dead-letters/" + other.ID: http.StatusNotFound,
+		"/dead-letters/missing":     http.StatusNotFound,
+	} {
+		if recorder := serve(http.MethodGet, path); recorder.Code != want {
+			t.Errorf("GET %s status = %d, want %d", path, recorder.Code, want)
+		}
+	}
+
+	for path, want := range map[string]int{
+		"/dead-letters/" + other.ID + "/requeue": http.StatusConflict,
+		"/dead-letters/missing/requeue":          http.StatusNotFound,
+	} {
+		if recorder := serve(http.MethodPost, path); recorder.Code != want {
+			t.Errorf("POST %s status = %d, want %d", path, recorder.Code, want)
+		}
+	}
+
+	if recorder := serve(http.MethodPost, "/dead-letters/"+run.ID+"/requeue"); recorder.Code != http.StatusAccepted {
+		t.Fatalf("requeue status = %d, want %d: %s", recorder.Code, http.StatusAccepted, recorder.Body.String())
+	}
+
+	// the run starts over
+	got, err := runs.Get(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != runModels.RunStatusQueued || got.Attempts != 0 || got.Error != "" || got.EndedAt != nil {
+		t.Errorf("run = %+v, want it queued again", got)
+	}
+	if job, err := jobs.Get(run.ID); err != nil || job.Status != queue.StatusQueued {
+		t.Errorf("job = %+v, %v, want it queued again", job, err)
+	}
+}
+
+func TestRequeueDeadLetterWithoutRun(t *testing.T) {
+	a, _, jobs := newDeadLetterTestApp(t, 1)
+
+	// a dead letter whose run record is gone
+	if err := jobs.Enqueue(queueScheduled, "orphan", []byte("{}"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	job, err := jobs.Dequeue(ctx, queueScheduled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jobs.Fail(job.ID, job.Receipt, "provider unavailable"); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	a.server.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/dead-letters/orphan/requeue", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("requeue status = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+
+	// the job stays dead rather than running without its run
+	if job, err := jobs.Get("orphan"); err != nil || job.Status != queue.StatusFailed {
+		t.Errorf("job = %+v, %v, want it still failed", job, err)
+	}
+}
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/lease"
+	"github.com/google/uuid"
+)
+
+// deliveries remembers the webhooks seen within the replay window so a retried delivery
+// is acknowledged without being handled twice. The keys are leased from the locker, replicas
+// sharing it see each other's deliveries.
+type deliveries struct {
+	locks lease.Locker
+	ttl   time.Duration
+}
+
+func newDeliveries(locks lease.Locker, ttl time.Duration) *deliveries {
+	return &deliveries{
+		locks: locks,
+		ttl:   ttl,
+	}
+}
+
+// Claim records the key of a webhook created at createdAt and reports whether it was new,
+// along with the holder to release it with. A claimed key is held until the webhook falls
+// out of the replay window or is released.
+func (d *deliveries) Claim(ctx context.Context, key string, createdAt time.Time, now time.Time) (string, bool, error) {
+	holder := uuid.NewString()
+
+	// a webhook is accepted while createdAt is within the window, only then can it be replayed
+	ttl := d.ttl - now.Sub(createdAt)
+	if ttl <= 0 {
+		return holder, true, nil
+	}
+
+	err := d.locks.Acquire(ctx, "delivery:"+key, holder, ttl)
+	if errors.Is(err, lease.ErrHeld) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return holder, true, nil
+}
+
+// Release forgets the key so a delivery that failed can be retried.
+func (d *deliveries) Release(ctx context.Context, key string, holder string) error {
+	return d.locks.Release(ctx, "delivery:"+key, holder)
+}
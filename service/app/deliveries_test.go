@@ -0,0 +1,71 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/lease"
+)
+
+func TestDeliveries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	d := newDeliveries(lease.NewMemoryLocker(), 5*time.Minute)
+
+	if _, claimed, err := d.Claim(ctx, "a", now, now); err != nil || !claimed {
+		t.Fatalf("Claim() = %t, %v, want a new key claimed", claimed, err)
+	}
+	if _, claimed, _ := d.Claim(ctx, "a", now, now.Add(time.Minute)); claimed {
+		t.Error("Claim() = true, want a replay within the window rejected")
+	}
+
+	// a failed delivery is released so its retry is handled
+	holder, claimed, _ := d.Claim(ctx, "b", now, now)
+	if !claimed {
+		t.Fatal("Claim() = false, want another key claimed")
+	}
+	if err := d.Release(ctx, "b", holder); err != nil {
+		t.Fatal(err)
+	}
+	if _, claimed, _ := d.Claim(ctx, "b", now, now); !claimed {
+		t.Error("Claim() = false, want a released key claimed again")
+	}
+}
+
+func TestDeliveriesExpireWithTheReplayWindow(t *testing.T) {
+	ctx := context.Background()
+	d := newDeliveries(lease.NewMemoryLocker(), 200*time.Millisecond)
+
+	// created most of the window ago, the key is only held for the rest of it
+	createdAt := time.Now().Add(-150 * time.Millisecond)
+	if _, claimed, _ := d.Claim(ctx, "a", createdAt, time.Now()); !claimed {
+		t.Fatal("Claim() = false, want a new key claimed")
+	}
+	if _, claimed, _ := d.Claim(ctx, "a", createdAt, time.Now()); claimed {
+		t.Error("Claim() = true, want a replay within the window rejected")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, claimed, _ := d.Claim(ctx, "a", createdAt, time.Now()); !claimed {
+		t.Error("Claim() = false, want the key released once the webhook left the window")
+	}
+}
+
+func TestDeliveriesSharedBetweenReplicas(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "leases.json")
+	first := newDeliveries(lease.NewFileLocker(path), 5*time.Minute)
+	second := newDeliveries(lease.NewFileLocker(path), 5*time.Minute)
+
+	now := time.Now()
+	if _, claimed, err := first.Claim(ctx, "a", now, now); err != nil || !claimed {
+		t.Fatalf("Claim() = %t, %v, want a new key claimed", claimed, err)
+	}
+
+	// the retry lands on the other replica
+	if _, claimed, err := second.Claim(ctx, "a", now, now); err != nil || claimed {
+		t.Errorf("Claim() on another replica = %t, %v, want the replay rejected", claimed, err)
+	}
+}
@@ -0,0 +1,194 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/TonyDMorris/quick-function/pkg/logging"
+	"github.com/TonyDMorris/quick-function/pkg/strapi/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-github/v56/github"
+	"go.uber.org/zap/zapcore"
+)
+
+const signatureHeader = "X-Hub-Signature-256"
+
+// HandleGitHubWebhook receives the GitHub App's webhooks and keeps the installations and
+// repositories in Strapi in step with what the app can access.
+func (a *App) HandleGitHubWebhook(c *gin.Context) {
+	if a.githubWebhookSecret == "" {
+		c.JSON(503, gin.H{
+			"error": "github webhook secret is not configured",
+		})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	signature := c.GetHeader(signatureHeader)
+	if signature == "" {
+		c.JSON(401, gin.H{
+			"error": "missing " + signatureHeader + " header",
+		})
+		return
+	}
+
+	if err := github.ValidateSignature(signature, body, []byte(a.githubWebhookSecret)); err != nil {
+		logging.Logger.Error("invalid github webhook signature", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+		c.JSON(401, gin.H{
+			"error": "invalid signature",
+		})
+		return
+	}
+
+	event, err := github.ParseWebHook(github.WebHookType(c.Request), body)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	switch event := event.(type) {
+	case *github.InstallationEvent:
+		err = a.handleInstallationEvent(ctx, event)
+	case *github.InstallationRepositoriesEvent:
+		err = a.handleInstallationRepositoriesEvent(ctx, event)
+	case *github.PushEvent:
+		err = a.handlePushEvent(ctx, event)
+	case *github.ReleaseEvent:
+		err = a.handleReleaseEvent(ctx, event)
+	case *github.CreateEvent:
+		err = a.handleCreateEvent(ctx, event)
+	default:
+		c.JSON(204, gin.H{
+			"success": "true", "message": "ignored",
+		})
+		return
+	}
+
+	if err != nil {
+		logging.Logger.Error(fmt.Sprintf("Error handling github webhook %s with error :%q", github.WebHookType(c.Request), err))
+		c.JSON(500, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success": "true", "message": "ok",
+	})
+}
+
+func (a *App) handleInstallationEvent(ctx context.Context, event *github.InstallationEvent) error {
+	installationID := strconv.FormatInt(event.GetInstallation().GetID(), 10)
+
+	switch event.GetAction() {
+	case "created", "unsuspend", "new_permissions_accepted":
+		_, err := a.strapiClient.SyncInstallation(ctx, models.InstallationSync{
+			InstallationID:    installationID,
+			Username:          event.GetInstallation().GetAccount().GetLogin(),
+			RepositoriesAdded: repositoriesFromEvent(event.Repositories),
+		})
+		if err != nil {
+			return fmt.Errorf("error syncing installation: %w", err)
+		}
+
+		return nil
+
+	case "deleted":
+		if err := a.unscheduleInstallation(ctx, installationID, nil); err != nil {
+			return err
+		}
+
+		if err := a.strapiClient.DeleteInstallation(ctx, installationID); err != nil {
+			return fmt.Errorf("error deleting installation: %w", err)
+		}
+
+		return nil
+
+	case "suspend":
+		return a.unscheduleInstallation(ctx, installationID, nil)
+
+	default:
+		return nil
+	}
+}
+
+func (a *App) handleInstallationRepositoriesEvent(ctx context.Context, event *github.InstallationRepositoriesEvent) error {
+	installationID := strconv.FormatInt(event.GetInstallation().GetID(), 10)
+
+	removed := repositoriesFromEvent(event.RepositoriesRemoved)
+
+	_, err := a.strapiClient.SyncInstallation(ctx, models.InstallationSync{
+		InstallationID:      installationID,
+		Username:            event.GetInstallation().GetAccount().GetLogin(),
+		RepositoriesAdded:   repositoriesFromEvent(event.RepositoriesAdded),
+		RepositoriesRemoved: removed,
+	})
+	if err != nil {
+		return fmt.Errorf("error syncing installation repositories: %w", err)
+	}
+
+	if len(removed) == 0 {
+		return nil
+	}
+
+	repositoryIDs := make(map[string]bool, len(removed))
+	for _, repository := range removed {
+		repositoryIDs[repository.RepositoryID] = true
+	}
+
+	return a.unscheduleInstallation(ctx, installationID, repositoryIDs)
+}
+
+// unscheduleInstallation removes the jobs of the installation's repository configurations,
+// limited to the given GitHub repository IDs when repositoryIDs is not nil.
+func (a *App) unscheduleInstallation(ctx context.Context, installationID string, repositoryIDs map[string]bool) error {
+	repositoryConfigurations, err := a.strapiClient.GetRepositoryConfigurations(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting repository configurations: %w", err)
+	}
+
+	for _, repositoryConfiguration := range repositoryConfigurations {
+		if repositoryConfiguration.Installation == nil || repositoryConfiguration.Installation.InstallationID != installationID {
+			continue
+		}
+		if repositoryIDs != nil && (repositoryConfiguration.Repository == nil || !repositoryIDs[repositoryConfiguration.Repository.RepositoryID]) {
+			continue
+		}
+
+		logging.Logger.Info(fmt.Sprintf("unscheduling repository configuration: %d", repositoryConfiguration.ID))
+		if err := a.cancelPendingPushes(ctx, repositoryConfiguration.ID); err != nil {
+			return fmt.Errorf("error cancelling pending pushes: %w", err)
+		}
+		if err := a.scheduler.Unschedule(repositoryConfiguration.ID); err != nil {
+			return fmt.Errorf("error unscheduling repository configuration: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func repositoriesFromEvent(repositories []*github.Repository) []models.Repository {
+	converted := make([]models.Repository, 0, len(repositories))
+	for _, repository := range repositories {
+		converted = append(converted, models.Repository{
+			Name:         repository.GetName(),
+			FullName:     repository.GetFullName(),
+			Private:      repository.GetPrivate(),
+			RepositoryID: strconv.FormatInt(repository.GetID(), 10),
+		})
+	}
+	return converted
+}
@@ -0,0 +1,271 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+)
+
+// exampleData holds webhooks GitHub delivered to the app, recorded as they were sent.
+const exampleData = "../../example_data"
+
+const exampleInstallationID = "44167954"
+
+// postGitHubWebhook signs the body with the secret and posts it through the app's router.
+func postGitHubWebhook(t *testing.T, a *App, event string, body []byte, secret string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	req := httptest.NewRequest(http.MethodPost, "/github/webhook", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", "delivery-"+event)
+	req.Header.Set(signatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	recorder := httptest.NewRecorder()
+	a.server.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func readExample(t *testing.T, name string) []byte {
+	t.Helper()
+
+	body, err := os.ReadFile(filepath.Join(exampleData, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// exampleConfiguration configures a repository of the example installation on a schedule.
+func exampleConfiguration(id int, repositoryID string) strapiModels.RepositoryConfiguration {
+	return strapiModels.RepositoryConfiguration{
+		ID:           id,
+		Cron:         "0 9 * * 1",
+		Repository:   &strapiModels.Repository{RepositoryID: repositoryID},
+		Installation: &strapiModels.Installation{InstallationID: exampleInstallationID, Username: "TonyDMorris"},
+	}
+}
+
+func TestHandleGitHubWebhookReplaysExampleData(t *testing.T) {
+	tests := []struct {
+		file  string
+		event string
+		// added and removed are the repository names synced to Strapi, nil leaves them unchecked.
+		added   []string
+		removed []string
+		deleted bool
+		// unscheduled are the configurations whose schedules the webhook removes.
+		unscheduled []int
+	}{
+		{
+			file:    "mix_owned_non_owned_private_public.json",
+			event:   "installation",
+			added:   []string{"AIdentification", "avalanche-smart-contract-quickstart", "fully-remote-blog"},
+			removed: []string{},
+		},
+		{
+			file:    "added.json",
+			event:   "installation_repositories",
+			added:   []string{"AIdentification", "Authentication-test"},
+			removed: []string{},
+		},
+		{
+			file:        "from_all_to_limited.json",
+			event:       "installation_repositories",
+			added:       []string{},
+			unscheduled: []int{1, 2},
+		},
+		{
+			file:    "from_limited_to_all.json",
+			event:   "installation_repositories",
+			removed: []string{},
+		},
+		{
+			file:        "uninstall.json",
+			event:       "installation",
+			deleted:     true,
+			unscheduled: []int{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			strapiAPI := newFakeStrapi(
+				exampleConfiguration(1, "718219828"),                           // quick-function
+				exampleConfiguration(2, "178613296"),                           // bio
+				exampleConfiguration(3, "627861133"),                           // AIdentification
+				strapiModels.RepositoryConfiguration{ID: 4, Cron: "0 9 * * 1"}, // another installation
+			)
+			a, _ := newTestApp(t, &fakeGitHub{}, strapiAPI)
+			a.setupRoutes()
+
+			for _, configuration := range strapiAPI.configurations {
+				if _, err := a.scheduler.Schedule(context.Background(), configuration); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			recorder := postGitHubWebhook(t, a, tt.event, readExample(t, tt.file), testWebhookSecret)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body.String())
+			}
+
+			syncs := strapiAPI.Syncs()
+			if tt.deleted {
+				if len(syncs) != 0 {
+					t.Errorf("syncs = %d, want none", len(syncs))
+				}
+				if deleted := strapiAPI.Deleted(); !reflect.DeepEqual(deleted, []string{exampleInstallationID}) {
+					t.Errorf("deleted installations = %v, want [%s]", deleted, exampleInstallationID)
+				}
+			} else {
+				if len(syncs) != 1 {
+					t.Fatalf("syncs = %d, want 1", len(syncs))
+				}
+				sync := syncs[0]
+				if sync.InstallationID != exampleInstallationID || sync.Username != "TonyDMorris" {
+					t.Errorf("sync = %s by %s, want %s by TonyDMorris", sync.InstallationID, sync.Username, exampleInstallationID)
+				}
+				if tt.added != nil {
+					if added := repositoryNames(sync.RepositoriesAdded); !reflect.DeepEqual(added, tt.added) {
+						t.Errorf("repositories added = %v, want %v", added, tt.added)
+					}
+				}
+				if tt.removed != nil {
+					if removed := repositoryNames(sync.RepositoriesRemoved); !reflect.DeepEqual(removed, tt.removed) {
+						t.Errorf("repositories removed = %v, want %v", removed, tt.removed)
+					}
+				}
+			}
+
+			unscheduled := map[int]bool{}
+			for _, id := range tt.unscheduled {
+				unscheduled[id] = true
+			}
+			for _, configuration := range strapiAPI.configurations {
+				if scheduled := a.scheduler.Scheduled(configuration.ID); scheduled == unscheduled[configuration.ID] {
+					t.Errorf("configuration %d scheduled = %t, want %t", configuration.ID, scheduled, !unscheduled[configuration.ID])
+				}
+			}
+		})
+	}
+}
+
+func TestHandleGitHubWebhookSyncsRepositoryDetails(t *testing.T) {
+	strapiAPI := newFakeStrapi()
+	a, _ := newTestApp(t, &fakeGitHub{}, strapiAPI)
+	a.setupRoutes()
+
+	recorder := postGitHubWebhook(t, a, "installation_repositories", readExample(t, "added.json"), testWebhookSecret)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body.String())
+	}
+
+	syncs := strapiAPI.Syncs()
+	if len(syncs) != 1 {
+		t.Fatalf("syncs = %d, want 1", len(syncs))
+	}
+
+	want := strapiModels.Repository{
+		Name:         "AIdentification",
+		FullName:     "TonyDMorris/AIdentification",
+		Private:      true,
+		RepositoryID: "627861133",
+	}
+	for _, repository := range syncs[0].RepositoriesAdded {
+		if repository.Name == want.Name {
+			if !reflect.DeepEqual(repository, want) {
+				t.Errorf("repository = %+v, want %+v", repository, want)
+			}
+			return
+		}
+	}
+	t.Errorf("repository %s was not synced", want.Name)
+}
+
+func TestHandleGitHubWebhookRejectsInvalidSignatures(t *testing.T) {
+	strapiAPI := newFakeStrapi()
+	a, _ := newTestApp(t, &fakeGitHub{}, strapiAPI)
+	a.setupRoutes()
+
+	recorder := postGitHubWebhook(t, a, "installation", readExample(t, "uninstall.json"), "wrong-secret")
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+	if deleted := strapiAPI.Deleted(); len(deleted) != 0 {
+		t.Errorf("deleted installations = %v, want none", deleted)
+	}
+}
+
+func TestHandleGitHubWebhookSignature(t *testing.T) {
+	body := []byte(`{"zen": "Keep it logically awesome."}`)
+
+	tests := []struct {
+		name          string
+		configured    string
+		signedWith    string
+		withSignature bool
+		status        int
+	}{
+		{name: "secret not configured", configured: "", signedWith: "secret", withSignature: true, status: http.StatusServiceUnavailable},
+		{name: "missing signature", configured: "secret", withSignature: false, status: http.StatusUnauthorized},
+		{name: "wrong secret", configured: "secret", signedWith: "other", withSignature: true, status: http.StatusUnauthorized},
+		{name: "valid signature on an ignored event", configured: "secret", signedWith: "secret", withSignature: true, status: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newTestApp(t, &fakeGitHub{}, newFakeStrapi())
+			a.githubWebhookSecret = tt.configured
+			a.setupRoutes()
+
+			var recorder *httptest.ResponseRecorder
+			if tt.withSignature {
+				recorder = postGitHubWebhook(t, a, "ping", body, tt.signedWith)
+			} else {
+				req := httptest.NewRequest(http.MethodPost, "/github/webhook", bytes.NewReader(body))
+				req.Header.Set("X-GitHub-Event", "ping")
+				recorder = httptest.NewRecorder()
+				a.server.ServeHTTP(recorder, req)
+			}
+
+			if recorder.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleGitHubWebhookIgnoresOtherEvents(t *testing.T) {
+	a, _ := newTestApp(t, &fakeGitHub{}, newFakeStrapi())
+	a.setupRoutes()
+
+	recorder := postGitHubWebhook(t, a, "star", []byte(`{"action":"created"}`), testWebhookSecret)
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusNoContent)
+	}
+}
+
+func repositoryNames(repositories []strapiModels.Repository) []string {
+	names := []string{}
+	for _, repository := range repositories {
+		names = append(names, repository.Name)
+	}
+	sort.Strings(names)
+	return names
+}
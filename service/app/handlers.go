@@ -1,32 +1,104 @@
 package app
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strconv"
+	"io"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/TonyDMorris/quick-function/pkg/logging"
+	"github.com/TonyDMorris/quick-function/pkg/queue"
+	runModels "github.com/TonyDMorris/quick-function/pkg/runs/models"
 	"github.com/TonyDMorris/quick-function/pkg/strapi/models"
 	"github.com/gin-gonic/gin"
 )
 
 func (a *App) HandleStrapiWebhook(c *gin.Context) {
 
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if status, err := a.verifyStrapiWebhook(c.Request.Header, body); err != nil {
+		logging.Logger.Error(fmt.Sprintf("Rejected strapi webhook with error : %q", err))
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	var webhook models.StrapiWebhookPayload
 
-	if err := c.BindJSON(&webhook); err != nil {
+	if err := json.Unmarshal(body, &webhook); err != nil {
 		logging.Logger.Error(fmt.Sprintf("Error handling repository configuration with error : %q", err))
-		c.JSON(500, gin.H{
+		c.JSON(400, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
 
+	now := time.Now()
+	if webhook.CreatedAt.IsZero() || now.Sub(webhook.CreatedAt).Abs() > a.strapiWebhook.Tolerance {
+		c.JSON(400, gin.H{
+			"error": "webhook createdAt is outside the tolerance window",
+		})
+		return
+	}
+
+	key, err := strapiDeliveryKey(webhook)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	holder, claimed, err := a.strapiDeliveries.Claim(c.Request.Context(), key, webhook.CreatedAt, now)
+	if err != nil {
+		logging.Logger.Error(fmt.Sprintf("Error claiming strapi webhook delivery with error : %q", err))
+		c.JSON(503, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !claimed {
+		c.JSON(200, gin.H{
+			"success": "true", "message": "duplicate delivery",
+		})
+		return
+	}
+
 	switch webhook.Model {
 	case "repository-configuration":
-		if err := a.handleRepositoryConfiguration(webhook); err != nil {
+		if err := a.handleRepositoryConfiguration(c.Request.Context(), webhook); err != nil {
+			if err := a.strapiDeliveries.Release(context.Background(), key, holder); err != nil {
+				logging.Logger.Error(fmt.Sprintf("Error releasing strapi webhook delivery with error : %q", err))
+			}
 			logging.Logger.Error(fmt.Sprintf("Error handling repository configuration with error :%q", err))
+			if errors.Is(err, ErrInvalidSchedule) {
+				c.JSON(400, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			if errors.Is(err, queue.ErrFull) {
+				c.JSON(503, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
 			c.JSON(500, gin.H{
 				"error": err.Error(),
 			})
@@ -37,6 +109,7 @@ func (a *App) HandleStrapiWebhook(c *gin.Context) {
 		c.JSON(204, gin.H{
 			"success": "true", "message": "ok",
 		})
+		return
 	}
 
 	c.JSON(200, gin.H{
@@ -44,82 +117,142 @@ func (a *App) HandleStrapiWebhook(c *gin.Context) {
 	})
 }
 
-func (a *App) handleRepositoryConfiguration(webhook models.StrapiWebhookPayload) error {
+// verifyStrapiWebhook checks the shared secret Strapi sends in its webhook headers and,
+// when a signing secret is configured, the HMAC of the body. It returns the status to
+// reply with when the webhook is rejected.
+func (a *App) verifyStrapiWebhook(header http.Header, body []byte) (int, error) {
+	if a.strapiWebhook.Secret == "" {
+		return 503, errors.New("strapi webhook secret is not configured")
+	}
+
+	secret := strings.TrimPrefix(header.Get(a.strapiWebhook.Header), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(a.strapiWebhook.Secret)) != 1 {
+		return 401, errors.New("invalid webhook secret")
+	}
+
+	if a.strapiWebhook.SigningSecret == "" {
+		return 0, nil
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(header.Get(StrapiSignatureHeader), "sha256="))
+	if err != nil || len(signature) == 0 {
+		return 401, errors.New("missing or malformed " + StrapiSignatureHeader + " header")
+	}
+
+	mac := hmac.New(sha256.New, []byte(a.strapiWebhook.SigningSecret))
+	mac.Write(body)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return 401, errors.New("invalid webhook signature")
+	}
+
+	return 0, nil
+}
+
+// strapiDeliveryKey identifies a webhook delivery, a retry of the same event for the same entry has the same key.
+func strapiDeliveryKey(webhook models.StrapiWebhookPayload) (string, error) {
+	var entry struct {
+		ID int `json:"id"`
+	}
+
+	bytes, err := json.Marshal(webhook.Entry)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling entry: %w", err)
+	}
+	if err := json.Unmarshal(bytes, &entry); err != nil {
+		return "", fmt.Errorf("error unmarshalling entry: %w", err)
+	}
+
+	return fmt.Sprintf("%s:%s:%d:%d", webhook.Model, webhook.Event, entry.ID, webhook.CreatedAt.UnixNano()), nil
+}
+
+func (a *App) handleRepositoryConfiguration(ctx context.Context, webhook models.StrapiWebhookPayload) error {
 
 	switch webhook.Event {
 	case "entry.create":
-		bytes, err := json.Marshal(webhook.Entry)
+		repositoryConfiguration, err := repositoryConfigurationFromEntry(webhook.Entry)
 		if err != nil {
-			return fmt.Errorf("error marshalling entry: %w", err)
+			return err
 		}
 
-		var repositoryConfiguration models.RepositoryConfiguration
+		pushTriggered := repositoryConfiguration.Trigger == models.TriggerPush
 
-		if err = json.Unmarshal(bytes, &repositoryConfiguration); err != nil {
-			return fmt.Errorf("error unmarshalling entry: %w", err)
+		if !pushTriggered {
+			if _, err := ParseSchedule(repositoryConfiguration.Cron); err != nil {
+				return err
+			}
 		}
 
-		fullRepositoryConfiguration, err := a.strapiClient.GetRepositoryConfiguration(repositoryConfiguration.ID)
+		fullRepositoryConfiguration, err := a.strapiClient.GetRepositoryConfiguration(ctx, repositoryConfiguration.ID)
 		if err != nil {
 			return fmt.Errorf("error getting repository configuration: %w", err)
 		}
 
-		scheduleStrings := strings.Split(repositoryConfiguration.Cron, " ")
-		if len(scheduleStrings) != 2 {
-			return fmt.Errorf("error reading cron '%s'", fullRepositoryConfiguration.Cron)
+		if a.scheduler.Scheduled(fullRepositoryConfiguration.ID) {
+			logging.Logger.Info(fmt.Sprintf("repository configuration already scheduled: %d", fullRepositoryConfiguration.ID))
+			return nil
 		}
-		numberString, interval := scheduleStrings[0], scheduleStrings[1]
-		number, err := strconv.Atoi(numberString)
-		if err != nil {
-			return fmt.Errorf("error converting string to number: %w", err)
-		}
-		switch interval {
-		case "days":
-			job, err := a.cron.
-				Every(int(number)).
-				Day().
-				Tag(fmt.Sprint(fullRepositoryConfiguration.ID)).
-				WaitForSchedule().
-				Do(func() {
-					a.WorkerPool.RepostioryConfigurationCreated <- *fullRepositoryConfiguration
-				})
-			if err != nil {
-				return fmt.Errorf("error scheduling job: %w", err)
-			}
-			a.jobs[fmt.Sprint(fullRepositoryConfiguration.ID)] = job
-			nextRun := job.NextRun()
-			fullRepositoryConfiguration.NextGeneration = &nextRun
-			_, err = a.strapiClient.UpdateRepositoryConfiguration(*fullRepositoryConfiguration)
-			if err != nil {
-				return fmt.Errorf("error updating repository configuration: %w", err)
+
+		// push triggered configurations generate when commits land instead of on a schedule
+		if !pushTriggered {
+			fullRepositoryConfiguration.NextGeneration = nil
+			if _, err := a.scheduler.Schedule(ctx, *fullRepositoryConfiguration); err != nil {
+				return fmt.Errorf("error scheduling repository configuration: %w", err)
 			}
+		}
 
-		case "weeks":
-			job, err := a.cron.
-				Every(int(number)).
-				Week().
-				Tag(fmt.Sprint(fullRepositoryConfiguration.ID)).
-				WaitForSchedule().
-				Do(func() {
-					a.WorkerPool.RepostioryConfigurationCreated <- *fullRepositoryConfiguration
-				})
-			if err != nil {
-				return fmt.Errorf("error scheduling job: %w", err)
+		if _, err := a.enqueueJob(runModels.RunTypeCreated, runModels.RunTriggerWebhook, *fullRepositoryConfiguration); err != nil {
+			return fmt.Errorf("error enqueueing repository configuration: %w", err)
+		}
+
+		return nil
+
+	case "entry.update":
+		repositoryConfiguration, err := repositoryConfigurationFromEntry(webhook.Entry)
+		if err != nil {
+			return err
+		}
+
+		if repositoryConfiguration.Cron != "" && repositoryConfiguration.Trigger != models.TriggerPush {
+			if _, err := ParseSchedule(repositoryConfiguration.Cron); err != nil {
+				return err
 			}
-			a.jobs[fmt.Sprint(fullRepositoryConfiguration.ID)] = job
-			nextRun := job.NextRun()
-			fullRepositoryConfiguration.NextGeneration = &nextRun
-			_, err = a.strapiClient.UpdateRepositoryConfiguration(*fullRepositoryConfiguration)
-			if err != nil {
-				return fmt.Errorf("error updating repository configuration: %w", err)
+		}
+
+		fullRepositoryConfiguration, err := a.strapiClient.GetRepositoryConfiguration(ctx, repositoryConfiguration.ID)
+		if err != nil {
+			return fmt.Errorf("error getting repository configuration: %w", err)
+		}
+
+		if fullRepositoryConfiguration.Trigger == models.TriggerPush {
+			if err := a.scheduler.Unschedule(fullRepositoryConfiguration.ID); err != nil {
+				return fmt.Errorf("error unscheduling repository configuration: %w", err)
 			}
+			return nil
+		}
+
+		if err := a.cancelPendingPushes(ctx, fullRepositoryConfiguration.ID); err != nil {
+			return fmt.Errorf("error cancelling pending pushes: %w", err)
+		}
+
+		if _, err := a.scheduler.Reschedule(ctx, *fullRepositoryConfiguration); err != nil {
+			return fmt.Errorf("error rescheduling repository configuration: %w", err)
+		}
+
+		return nil
 
-		default:
-			return fmt.Errorf("invalid interval: %s", interval)
+	case "entry.delete":
+		repositoryConfiguration, err := repositoryConfigurationFromEntry(webhook.Entry)
+		if err != nil {
+			return err
+		}
 
+		if err := a.cancelPendingPushes(ctx, repositoryConfiguration.ID); err != nil {
+			return fmt.Errorf("error cancelling pending pushes: %w", err)
 		}
 
-		a.WorkerPool.RepostioryConfigurationCreated <- *fullRepositoryConfiguration
+		if err := a.scheduler.Unschedule(repositoryConfiguration.ID); err != nil {
+			return fmt.Errorf("error unscheduling repository configuration: %w", err)
+		}
 
 		return nil
 
@@ -128,3 +261,18 @@ func (a *App) handleRepositoryConfiguration(webhook models.StrapiWebhookPayload)
 	}
 
 }
+
+func repositoryConfigurationFromEntry(entry interface{}) (*models.RepositoryConfiguration, error) {
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling entry: %w", err)
+	}
+
+	var repositoryConfiguration models.RepositoryConfiguration
+
+	if err = json.Unmarshal(bytes, &repositoryConfiguration); err != nil {
+		return nil, fmt.Errorf("error unmarshalling entry: %w", err)
+	}
+
+	return &repositoryConfiguration, nil
+}
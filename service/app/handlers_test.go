@@ -0,0 +1,250 @@
+package app
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/lease"
+	"github.com/TonyDMorris/quick-function/pkg/queue"
+	runStore "github.com/TonyDMorris/quick-function/pkg/runs/store"
+	strapi "github.com/TonyDMorris/quick-function/pkg/strapi/client"
+	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-github/v56/github"
+)
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyStrapiWebhook(t *testing.T) {
+	body := []byte(`{"event": "entry.create"}`)
+
+	tests := []struct {
+		name    string
+		config  StrapiWebhookConfig
+		headers map[string]string
+		status  int
+	}{
+		{
+			name:    "secret not configured",
+			config:  StrapiWebhookConfig{},
+			headers: map[string]string{"X-Strapi-Webhook-Secret": "secret"},
+			status:  http.StatusServiceUnavailable,
+		},
+		{
+			name:    "missing secret",
+			config:  StrapiWebhookConfig{Secret: "secret"},
+			headers: map[string]string{},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "wrong secret",
+			config:  StrapiWebhookConfig{Secret: "secret"},
+			headers: map[string]string{"X-Strapi-Webhook-Secret": "other"},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "secret",
+			config:  StrapiWebhookConfig{Secret: "secret"},
+			headers: map[string]string{"X-Strapi-Webhook-Secret": "secret"},
+		},
+		{
+			name:    "bearer secret in a custom header",
+			config:  StrapiWebhookConfig{Secret: "secret", Header: "Authorization"},
+			headers: map[string]string{"Authorization": "Bearer secret"},
+		},
+		{
+			name:    "missing signature",
+			config:  StrapiWebhookConfig{Secret: "secret", SigningSecret: "signing"},
+			headers: map[string]string{"X-Strapi-Webhook-Secret": "secret"},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "bad signature",
+			config:  StrapiWebhookConfig{Secret: "secret", SigningSecret: "signing"},
+			headers: map[string]string{"X-Strapi-Webhook-Secret": "secret", StrapiSignatureHeader: sign("other", body)},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "signature",
+			config:  StrapiWebhookConfig{Secret: "secret", SigningSecret: "signing"},
+			headers: map[string]string{"X-Strapi-Webhook-Secret": "secret", StrapiSignatureHeader: sign("signing", body)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewApi(Config{StrapiWebhook: tt.config}, github.NewClient(nil), nil, nil, nil, nil, nil)
+
+			header := http.Header{}
+			for key, value := range tt.headers {
+				header.Set(key, value)
+			}
+
+			status, err := a.verifyStrapiWebhook(header, body)
+			if status != tt.status {
+				t.Errorf("verifyStrapiWebhook() status = %d, want %d", status, tt.status)
+			}
+			if (err != nil) != (tt.status != 0) {
+				t.Errorf("verifyStrapiWebhook() error = %v, want an error only when rejected", err)
+			}
+		})
+	}
+}
+
+func TestHandleStrapiWebhookReplayWindow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	runs, err := runStore.NewFileStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewApi(Config{StrapiWebhook: StrapiWebhookConfig{Secret: "secret"}}, github.NewClient(nil), nil, strapi.NewClient("test", "http://127.0.0.1:0"), runs, queue.NewMemoryQueue(queue.Options{}), lease.NewMemoryLocker())
+	a.setupRoutes()
+
+	post := func(webhook strapiModels.StrapiWebhookPayload) *httptest.ResponseRecorder {
+		body, err := json.Marshal(webhook)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/repository-configuration", bytes.NewReader(body))
+		req.Header.Set("X-Strapi-Webhook-Secret", "secret")
+
+		recorder := httptest.NewRecorder()
+		a.server.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// webhooks for other models are acknowledged without being handled
+	webhook := strapiModels.StrapiWebhookPayload{
+		Event:     "entry.create",
+		Model:     "git-blog-post",
+		CreatedAt: time.Now(),
+		Entry:     map[string]interface{}{"id": 1},
+	}
+
+	if recorder := post(webhook); recorder.Code != http.StatusNoContent {
+		t.Errorf("first delivery status = %d, want %d", recorder.Code, http.StatusNoContent)
+	}
+
+	recorder := post(webhook)
+	if recorder.Code != http.StatusOK || !bytes.Contains(recorder.Body.Bytes(), []byte("duplicate delivery")) {
+		t.Errorf("replayed delivery = %d %s, want it acknowledged as a duplicate", recorder.Code, recorder.Body.String())
+	}
+
+	webhook.CreatedAt = time.Now().Add(-10 * time.Minute)
+	if recorder := post(webhook); recorder.Code != http.StatusBadRequest {
+		t.Errorf("stale delivery status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+
+	webhook.CreatedAt = time.Time{}
+	if recorder := post(webhook); recorder.Code != http.StatusBadRequest {
+		t.Errorf("delivery without createdAt status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleStrapiWebhookRejections(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	webhook := strapiModels.StrapiWebhookPayload{
+		Event:     "entry.create",
+		Model:     "git-blog-post",
+		CreatedAt: time.Now(),
+		Entry:     map[string]interface{}{"id": 1},
+	}
+	body, err := json.Marshal(webhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  StrapiWebhookConfig
+		headers map[string]string
+		status  int
+	}{
+		{name: "secret not configured", headers: map[string]string{"X-Strapi-Webhook-Secret": "secret"}, status: http.StatusServiceUnavailable},
+		{name: "wrong secret", config: StrapiWebhookConfig{Secret: "secret"}, headers: map[string]string{"X-Strapi-Webhook-Secret": "other"}, status: http.StatusUnauthorized},
+		{
+			name:    "bad signature",
+			config:  StrapiWebhookConfig{Secret: "secret", SigningSecret: "signing"},
+			headers: map[string]string{"X-Strapi-Webhook-Secret": "secret", StrapiSignatureHeader: sign("other", body)},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "signed",
+			config:  StrapiWebhookConfig{Secret: "secret", SigningSecret: "signing"},
+			headers: map[string]string{"X-Strapi-Webhook-Secret": "secret", StrapiSignatureHeader: sign("signing", body)},
+			status:  http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewApi(Config{StrapiWebhook: tt.config}, github.NewClient(nil), nil, nil, nil, queue.NewMemoryQueue(queue.Options{}), lease.NewMemoryLocker())
+			a.setupRoutes()
+
+			req := httptest.NewRequest(http.MethodPost, "/repository-configuration", bytes.NewReader(body))
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			recorder := httptest.NewRecorder()
+			a.server.ServeHTTP(recorder, req)
+			if recorder.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleStrapiWebhookReplayedToAnotherReplica(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// two replicas behind a load balancer share their leases
+	locksPath := filepath.Join(t.TempDir(), "leases.json")
+	var replicas []*App
+	for i := 0; i < 2; i++ {
+		a := NewApi(Config{StrapiWebhook: StrapiWebhookConfig{Secret: "secret"}}, github.NewClient(nil), nil, nil, nil, queue.NewMemoryQueue(queue.Options{}), lease.NewFileLocker(locksPath))
+		a.setupRoutes()
+		replicas = append(replicas, a)
+	}
+
+	body, err := json.Marshal(strapiModels.StrapiWebhookPayload{
+		Event:     "entry.create",
+		Model:     "git-blog-post",
+		CreatedAt: time.Now(),
+		Entry:     map[string]interface{}{"id": 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var recorders []*httptest.ResponseRecorder
+	for _, a := range replicas {
+		req := httptest.NewRequest(http.MethodPost, "/repository-configuration", bytes.NewReader(body))
+		req.Header.Set("X-Strapi-Webhook-Secret", "secret")
+		recorder := httptest.NewRecorder()
+		a.server.ServeHTTP(recorder, req)
+		recorders = append(recorders, recorder)
+	}
+
+	if recorders[0].Code != http.StatusNoContent {
+		t.Errorf("first delivery status = %d, want %d", recorders[0].Code, http.StatusNoContent)
+	}
+	if recorders[1].Code != http.StatusOK || !bytes.Contains(recorders[1].Body.Bytes(), []byte("duplicate delivery")) {
+		t.Errorf("replay on the other replica = %d %s, want it acknowledged as a duplicate", recorders[1].Code, recorders[1].Body.String())
+	}
+}
@@ -3,106 +3,135 @@ package app
 import (
 	"context"
 	"fmt"
-	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/TonyDMorris/quick-function/constants"
+	"github.com/TonyDMorris/quick-function/pkg/contents"
+	tokenService "github.com/TonyDMorris/quick-function/pkg/github_token_service/client"
 	gpt "github.com/TonyDMorris/quick-function/pkg/gpt/client"
 	gptModels "github.com/TonyDMorris/quick-function/pkg/gpt/models"
 	"github.com/TonyDMorris/quick-function/pkg/logging"
+	runModels "github.com/TonyDMorris/quick-function/pkg/runs/models"
+	"github.com/TonyDMorris/quick-function/pkg/selection"
 	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+	"github.com/TonyDMorris/quick-function/pkg/tokens"
 	"github.com/google/go-github/v56/github"
-	"github.com/pkoukk/tiktoken-go"
 	"go.uber.org/zap/zapcore"
 )
 
-func (a *App) HandleRepositoryConfigurationCreatedJob(job strapiModels.RepositoryConfiguration) error {
+func (a *App) HandleRepositoryConfigurationCreatedJob(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) (err error) {
 
+	// a panicking job fails its run instead of counting as succeeded
 	defer func() {
-		if err := recover(); err != nil {
-			logging.Logger.Error("panic in HandleRepositoryConfigurationCreatedJob", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err}, zapcore.Field{Key: "job", Type: zapcore.Int64Type, Interface: job.ID})
+		if recovered := recover(); recovered != nil {
+			logging.Logger.Error(fmt.Sprintf("panic in HandleRepositoryConfigurationCreatedJob: %q with job ID : %d", recovered, job.ID))
+			err = fmt.Errorf("panic in HandleRepositoryConfigurationCreatedJob: %v", recovered)
 		}
 	}()
 
-	ctx := context.Background()
+	// an earlier attempt already posted, only the generation update it failed on is retried
+	if run.GitBlogPostID != 0 {
+		return a.updateGenerations(ctx, job, run)
+	}
 
 	installation := job.Installation
 	repo := job.Repository
 
 	if installation == nil || repo == nil {
-		return fmt.Errorf("installation or repository is nil")
+		return ErrNoInstallation
 	}
 
 	installationID := installation.InstallationID
 
-	userClient, err := a.getUserClientFromInstallation(ctx, installationID)
+	userClient, err := a.getUserClientFromInstallation(installationID, repo.Name, readPermissions)
 	if err != nil {
 		return fmt.Errorf("error getting user client from installation: %w", err)
 	}
 
-	repoinfo, _, err := userClient.Repositories.Get(ctx, installation.Username, repo.Name)
+	branchName, err := branchName(ctx, userClient, installation.Username, repo.Name, job)
+	if err != nil {
+		return err
+	}
+
+	generatedAt := time.Now().UTC()
+
+	// pin the commit so the tree and the contents read from it agree
+	branch, _, err := userClient.Repositories.GetBranch(ctx, installation.Username, repo.Name, branchName, 1)
 	if err != nil {
-		return fmt.Errorf("error getting repository info: %w", err)
+		return fmt.Errorf("error getting branch: %w", err)
 	}
 
-	defaultBranch := repoinfo.GetDefaultBranch()
+	headSHA := branch.GetCommit().GetSHA()
+	run.CommitTo = headSHA
 
-	tree, _, err := userClient.Git.GetTree(ctx, installation.Username, repo.Name, defaultBranch, true)
+	treeEntries, err := getTreeEntries(ctx, userClient, installation.Username, repo.Name, headSHA, job.Paths)
 	if err != nil {
-		return fmt.Errorf("error getting tree: %w", err)
+		return err
 	}
 
-	var files []string
+	// there is no diff to describe, the lines changed by the recent commits stand in for it
+	// so the ranking still favours the files being worked on
+	changes := recentChanges(ctx, userClient, installation.Username, repo.Name, headSHA)
+
+	var files []selection.File
 
-	for _, entry := range tree.Entries {
-		if entry.GetSize() != 0 {
-			files = append(files, entry.GetPath())
+	for _, entry := range treeEntries {
+		if entry.GetType() == "blob" && entry.GetSize() != 0 && selection.Matches(job.Paths, entry.GetPath()) {
+			files = append(files, selection.File{Path: entry.GetPath(), Size: entry.GetSize(), Changes: changes[entry.GetPath()]})
 		}
 	}
 
 	if len(files) == 0 {
-		return fmt.Errorf("no files found")
+		return ErrNoFiles
 	}
 
-	interestedFiles, err := a.getInterestedFiles(repo.Name, files)
+	interestedFiles, err := a.getInterestedFiles(ctx, job, repo.Name, files, run)
 
 	if err != nil {
 		return fmt.Errorf("error getting interested files: %w", err)
 	}
 
 	if len(interestedFiles) == 0 {
-		return fmt.Errorf("no interested files found")
+		return ErrNoInterestedFiles
 	}
-	contents, err := a.getContents(ctx, userClient, installation.Username, repo.Name, interestedFiles)
+	source := a.contentSource(userClient, installation.Username, repo.Name, headSHA, contents.BlobSHAs(treeEntries))
+
+	fileContents, err := a.getContents(ctx, source, interestedFiles)
 	if err != nil {
 		return fmt.Errorf("error getting contents: %w", err)
 	}
 
-	tokensPerContent := gpt.MaxTokens / len(contents)
-
-	var trimmedContents = make(map[string]string)
+	// an outline of the tree gets an eighth of the budget, however the files were picked, the
+	// contents whatever is left
+	tokenBudget := a.contentBudget(job)
 
-	for path, content := range contents {
-		trimmedContent, err := a.trimContent(content, tokensPerContent)
-		if err != nil {
-			return fmt.Errorf("error trimming content: %w", err)
-		}
-
-		trimmedContents[path] = trimmedContent
+	outline := strings.Join(summariseTree(selection.Rank(files, a.selectionOptions), tokenBudget/8), "\n")
+	outlineTokens, err := tokens.Count(outline)
+	if err != nil {
+		return fmt.Errorf("error counting outline tokens: %w", err)
+	}
 
+	trimmedContents, _, err := a.trimContents(fileContents, tokenBudget-outlineTokens)
+	if err != nil {
+		return fmt.Errorf("error trimming contents: %w", err)
 	}
 
 	var contentsToSend []string
 
-	for path, content := range trimmedContents {
+	for _, path := range interestedFiles {
+		content, ok := trimmedContents[path]
+		if !ok {
+			continue
+		}
 		contentsToSend = append(contentsToSend, fmt.Sprintf("%s\n%s", path, content))
 	}
 
 	contentsToSendString := strings.Join(contentsToSend, "\n")
 
-	contentMessage := fmt.Sprintf(constants.ContentMessage, contentsToSendString)
+	contentMessage := fmt.Sprintf(constants.ContentMessage, contentsToSendString, outline)
 
 	contentMessagePrompts := []gptModels.Message{
 		{
@@ -111,12 +140,14 @@ func (a *App) HandleRepositoryConfigurationCreatedJob(job strapiModels.Repositor
 		},
 	}
 
-	resp, err := a.chatGptClient.Chat(contentMessagePrompts)
+	resp, err := a.chatGptClient.Chat(ctx, contentMessagePrompts, completionOptions(job))
 
 	if err != nil {
 		return fmt.Errorf("error chatting with gpt: %w", err)
 	}
 
+	run.TokensUsed += resp.Usage.TotalTokens
+
 	var content string
 
 	for _, choice := range resp.Choices {
@@ -132,194 +163,644 @@ func (a *App) HandleRepositoryConfigurationCreatedJob(job strapiModels.Repositor
 		OwnerUsername: installation.Username,
 	}
 
-	_, err = a.strapiClient.StandardCreateGitBlogPost(gitBlogPost)
+	createdGitBlogPost, err := a.strapiClient.StandardCreateGitBlogPost(ctx, gitBlogPost)
 	if err != nil {
 		return fmt.Errorf("error creating git blog post: %w", err)
 	}
 
-	// trim content
+	a.recordPost(run, createdGitBlogPost.ID, generatedAt)
 
-	return nil
+	return a.updateGenerations(ctx, job, run)
 
 }
 
-func (a *App) HandleRepositoryConfigurationScheduledJob(job strapiModels.RepositoryConfiguration) error {
-	logging.Logger.Info(fmt.Sprintf("handling scheduled job for repository configuration: %d, with last generation time: %s", job.ID, job.LastGeneration.Format(time.RFC3339)))
+func (a *App) HandleRepositoryConfigurationScheduledJob(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) (err error) {
+	// a run queued with a commit range, such as a push, diffs that range instead of the commits since the last generation
+	hasRange := run.CommitFrom != "" && run.CommitTo != ""
+
+	// an earlier attempt already posted, only the generation update it failed on is retried
+	if run.GitBlogPostID != 0 {
+		return a.updateGenerations(ctx, job, run)
+	}
 
+	// a run catching up on a missed window diffs that window, the rest diff since the last generation
+	since := job.LastGeneration
+	if run.Since != nil {
+		since = run.Since
+	}
+
+	if since == nil && !hasRange {
+		logging.Logger.Info(fmt.Sprintf("no last generation time for repository configuration: %d, generating full post", job.ID))
+		return a.HandleRepositoryConfigurationCreatedJob(ctx, job, run)
+	}
+
+	if hasRange {
+		logging.Logger.Info(fmt.Sprintf("handling scheduled job for repository configuration: %d, from %s to %s", job.ID, run.CommitFrom, run.CommitTo))
+	} else {
+		logging.Logger.Info(fmt.Sprintf("handling scheduled job for repository configuration: %d, with last generation time: %s", job.ID, since.Format(time.RFC3339)))
+	}
+
+	// a panicking job fails its run instead of counting as succeeded
 	defer func() {
-		if err := recover(); err != nil {
-			logging.Logger.Error(fmt.Sprintf("panic in HandleRepositoryConfigurationScheduledJob: %q with job ID : %d", err, job.ID))
+		if recovered := recover(); recovered != nil {
+			logging.Logger.Error(fmt.Sprintf("panic in HandleRepositoryConfigurationScheduledJob: %q with job ID : %d", recovered, job.ID))
+			err = fmt.Errorf("panic in HandleRepositoryConfigurationScheduledJob: %v", recovered)
 		}
 	}()
 
-	ctx := context.Background()
-
 	installation := job.Installation
 	repo := job.Repository
 
 	if installation == nil || repo == nil {
-		return fmt.Errorf("installation or repository is nil")
+		return ErrNoInstallation
 	}
 
 	installationID := installation.InstallationID
 
-	userClient, err := a.getUserClientFromInstallation(ctx, installationID)
+	userClient, err := a.getUserClientFromInstallation(installationID, repo.Name, readPermissions)
 	if err != nil {
 		return fmt.Errorf("error getting user client from installation: %w", err)
 	}
 
-	repoinfo, _, err := userClient.Repositories.Get(ctx, installation.Username, repo.Name)
-	if err != nil {
-		return fmt.Errorf("error getting repository info: %w", err)
+	generatedAt := time.Now().UTC()
+	if run.Until != nil {
+		generatedAt = *run.Until
 	}
 
-	defaultBranch := repoinfo.GetDefaultBranch()
+	// the commits touching the configuration's paths, listed newest first
+	var pathCommits []*github.RepositoryCommit
 
-	tree, _, err := userClient.Git.GetTree(ctx, installation.Username, repo.Name, defaultBranch, true)
+	if !hasRange {
+		branchName, err := branchName(ctx, userClient, installation.Username, repo.Name, job)
+		if err != nil {
+			return err
+		}
+
+		// get commits between last generation and now
+		commitRefs, err := listCommits(ctx, userClient, installation.Username, repo.Name, job.Paths, github.CommitsListOptions{
+			SHA:   branchName,
+			Since: *since,
+			Until: generatedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("error getting commits: %w", err)
+		}
+
+		if len(commitRefs) == 0 {
+			logging.Logger.Info(fmt.Sprintf("no commits found since last generation: %s, for job ID : %d", since.String(), job.ID))
+			run.Status = runModels.RunStatusSkipped
+			return nil
+		}
+
+		// commits are listed newest first, diff from the parent of the oldest commit to the newest
+		oldestCommit := commitRefs[len(commitRefs)-1]
+
+		run.CommitFrom = oldestCommit.GetSHA()
+		if len(oldestCommit.Parents) > 0 {
+			run.CommitFrom = oldestCommit.Parents[0].GetSHA()
+		}
+		run.CommitTo = commitRefs[0].GetSHA()
+		pathCommits = commitRefs
+	}
+
+	diff, _, err := userClient.Repositories.CompareCommits(ctx, installation.Username, repo.Name, run.CommitFrom, run.CommitTo, nil)
 	if err != nil {
-		return fmt.Errorf("error getting tree: %w", err)
+		return fmt.Errorf("error getting diff: %w", err)
 	}
 
-	var files []string
+	// the comparison lists the commits oldest first
+	commits := diff.Commits
+	if len(commits) == 0 {
+		logging.Logger.Info(fmt.Sprintf("no commits found from %s to %s, for job ID : %d", run.CommitFrom, run.CommitTo, job.ID))
+		run.Status = runModels.RunStatusSkipped
+		return nil
+	}
 
-	for _, entry := range tree.Entries {
-		if entry.GetSize() != 0 {
-			files = append(files, entry.GetPath())
+	oldestCommit := commits[0]
+	headCommit := commits[len(commits)-1]
+
+	// the comparison holds every commit in the range, those outside the configuration's paths
+	// say nothing about the changes described
+	if len(job.Paths) > 0 {
+		if hasRange {
+			pathCommits, err = listCommits(ctx, userClient, installation.Username, repo.Name, job.Paths, github.CommitsListOptions{
+				SHA:   run.CommitTo,
+				Since: oldestCommit.GetCommit().GetCommitter().GetDate().Time,
+			})
+			if err != nil {
+				return fmt.Errorf("error getting commits: %w", err)
+			}
 		}
+		commits = onlyCommits(commits, pathCommits)
+	}
+
+	// get all commit messages in the order they were made
+	var commitMessages []string
 
+	for _, commit := range commits {
+		commitMessages = append(commitMessages, commit.GetCommit().GetMessage())
 	}
 
-	if len(files) == 0 {
+	commitMessage := strings.Join(commitMessages, "\n")
 
-		return fmt.Errorf("no files found")
+	// get patches and names of changed files
+	patches, filesChanged := a.getChangedFiles(diff.Files, job.Paths)
 
+	if len(patches) == 0 && len(filesChanged) == 0 {
+		logging.Logger.Info(fmt.Sprintf("no files changed from %s to %s, for job ID : %d", run.CommitFrom, run.CommitTo, job.ID))
+		run.Status = runModels.RunStatusSkipped
+		return nil
 	}
 
-	// get commit hashes from latest and last generation
-	commitRefs, _, err := userClient.Repositories.ListCommits(ctx, installation.Username, repo.Name, &github.CommitsListOptions{
-		SHA:   defaultBranch,
-		Since: *job.LastGeneration,
-	})
+	logging.Logger.Info(fmt.Sprintf("files changed: %s, for job ID : %d", strings.Join(selection.Paths(filesChanged), "\n"), job.ID))
+
+	logging.Logger.Info(fmt.Sprintf("commit messages: %s, for job ID : %d", commitMessage, job.ID))
+
+	// the comparison carries no sizes, take them from the tree at the newest commit so files
+	// over the size limit are left out of the ranking as they are for a first generation
+	treeEntries, err := getTreeEntries(ctx, userClient, installation.Username, repo.Name, headCommit.GetSHA(), job.Paths)
+	if _, ok := rateLimitedUntil(err); ok {
+		return err
+	}
 	if err != nil {
-		return fmt.Errorf("error getting commits: %w", err)
+		logging.Logger.Warn(fmt.Sprintf("error getting tree, ranking changed files without their sizes for job ID : %d", job.ID), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
 	}
+	filesChanged = withSizes(filesChanged, treeEntries)
 
-	// get contents since last generation
+	// get contents of changed files at the newest commit, removed files have no contents
+	// read the most relevant of the changed files, ranked with the most changed first among equals
+	filesToRead := selection.Paths(selection.Top(selection.Rank(filesChanged, a.selectionOptions), a.selectionOptions.MaxFiles))
 
-	if len(commitRefs) < 2 {
-		logging.Logger.Info(fmt.Sprintf("no commits found since last generation: %s, for job ID : %d", job.LastGeneration.String(), job.ID))
-		return nil
+	blobSHAs := make(map[string]string, len(diff.Files))
+	for _, file := range diff.Files {
+		blobSHAs[file.GetFilename()] = file.GetSHA()
 	}
 
-	// get diff between commits
+	source := a.contentSource(userClient, installation.Username, repo.Name, headCommit.GetSHA(), blobSHAs)
 
-	diff, _, err := userClient.Repositories.CompareCommits(ctx, installation.Username, repo.Name, commitRefs[0].GetSHA(), commitRefs[len(commitRefs)-1].GetSHA(), nil)
+	fileContents, err := a.getContents(ctx, source, filesToRead)
+	if _, ok := rateLimitedUntil(err); ok {
+		return fmt.Errorf("error getting contents: %w", err)
+	}
 	if err != nil {
-		return fmt.Errorf("error getting diff: %w", err)
+		logging.Logger.Warn(fmt.Sprintf("no contents found for changed files, sending patches only for job ID : %d", job.ID), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+		fileContents = map[string]string{}
 	}
 
-	// get interested files from diff
+	pullRequests := a.mergedPullRequests(ctx, userClient, installation.Username, repo.Name, commits)
+
+	// pull requests and commit messages get a quarter of the budget each, patches half of the
+	// rest and the contents whatever is left
+	tokenBudget := a.contentBudget(job)
+
+	pullRequestDigest, pullRequestTokens, err := a.pullRequestDigest(pullRequests, tokenBudget/4)
+	if err != nil {
+		return fmt.Errorf("error trimming pull requests: %w", err)
+	}
+
+	commitText, err := tokens.Truncate(commitMessage, tokenBudget/4)
+	if err != nil {
+		return fmt.Errorf("error trimming commit messages: %w", err)
+	}
+
+	commitTokens, err := tokens.Count(commitText)
+	if err != nil {
+		return fmt.Errorf("error counting commit message tokens: %w", err)
+	}
+
+	tokenBudget -= pullRequestTokens + commitTokens
+	patchBudget := tokenBudget
+	if len(fileContents) > 0 {
+		patchBudget = tokenBudget / 2
+	}
+
+	trimmedPatches, patchTokens, err := a.trimContents(patches, patchBudget)
+	if err != nil {
+		return fmt.Errorf("error trimming patches: %w", err)
+	}
+
+	trimmedContents, _, err := a.trimContents(fileContents, tokenBudget-patchTokens)
+	if err != nil {
+		return fmt.Errorf("error trimming contents: %w", err)
+	}
+
+	var patchesToSend []string
+	var contentsToSend []string
 
 	for _, file := range diff.Files {
-		files = append(files, file.GetFilename())
+		if patch, ok := trimmedPatches[file.GetFilename()]; ok {
+			patchesToSend = append(patchesToSend, fmt.Sprintf("%s\n%s", file.GetFilename(), patch))
+		}
 	}
-	// get all commit messages
-	var commitMessages []string
-	var filesChanged []string
 
-	for _, commitRef := range commitRefs {
-		commit := commitRef.GetCommit()
-		commitMessages = append(commitMessages, commit.GetMessage())
+	for _, path := range filesToRead {
+		if content, ok := trimmedContents[path]; ok {
+			contentsToSend = append(contentsToSend, fmt.Sprintf("%s\n%s", path, content))
+		}
+	}
 
+	changesMessage := fmt.Sprintf(constants.ChangesMessage, repo.Name, commitText, pullRequestDigest, strings.Join(patchesToSend, "\n"), strings.Join(contentsToSend, "\n"))
+
+	changesMessagePrompts := []gptModels.Message{
+		{
+			Role:    gptModels.RoleSystem,
+			Content: changesMessage,
+		},
 	}
 
-	commitMessage := strings.Join(commitMessages, "\n")
+	resp, err := a.chatGptClient.Chat(ctx, changesMessagePrompts, completionOptions(job))
+	if err != nil {
+		return fmt.Errorf("error chatting with gpt: %w", err)
+	}
+
+	run.TokensUsed += resp.Usage.TotalTokens
+
+	var content string
+
+	for _, choice := range resp.Choices {
+		content = choice.Message.Content
+	}
 
-	// get all file names of changed files
+	commitFrom := oldestCommit.GetCommit().GetCommitter().GetDate().Time
+	commitTo := headCommit.GetCommit().GetCommitter().GetDate().Time
 
-	filesChangesString := strings.Join(filesChanged, "\n")
+	gitBlogPost := strapiModels.GitBlogPost{
+		Title:         repo.Name,
+		Description:   repo.Name,
+		Body:          content,
+		CommitFrom:    &commitFrom,
+		CommitTo:      &commitTo,
+		Repository:    fmt.Sprint(repo.ID),
+		OwnerUsername: installation.Username,
+	}
 
-	logging.Logger.Info(fmt.Sprintf("files changed since last generation: %s, for job ID : %d", filesChangesString, job.ID))
+	createdGitBlogPost, err := a.strapiClient.StandardCreateGitBlogPost(ctx, gitBlogPost)
+	if err != nil {
+		return fmt.Errorf("error creating git blog post: %w", err)
+	}
 
-	logging.Logger.Info(fmt.Sprintf("commit messages since last generation: %s, for job ID : %d", commitMessage, job.ID))
+	a.recordPost(run, createdGitBlogPost.ID, generatedAt)
 
-	// if contents are the same, return
+	return a.updateGenerations(ctx, job, run)
+}
 
-	// if contents are different, get interested files
+// recordPost sets the created post and its generation time on the run and saves it straight
+// away, so a retry after the generation update fails finds the post instead of posting again.
+func (a *App) recordPost(run *runModels.Run, gitBlogPostID int, generatedAt time.Time) {
+	run.GitBlogPostID = gitBlogPostID
+	run.GeneratedAt = &generatedAt
 
-	// get contents from interested files
+	if err := a.runStore.Update(*run); err != nil {
+		logging.Logger.Error("error updating run", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err}, zapcore.Field{Key: "run", Type: zapcore.StringType, String: run.ID})
+	}
+}
 
-	// trim contents
+// updateGenerations writes the generation time of the run's post back to the repository
+// configuration.
+func (a *App) updateGenerations(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) error {
+	if run.GeneratedAt == nil {
+		return fmt.Errorf("run %s has a post but no generation time", run.ID)
+	}
+	generatedAt := *run.GeneratedAt
 
-	// send contents to gpt
+	// catch-up windows can finish out of order, a later window's generation is not moved back
+	if run.Until != nil {
+		current, err := a.strapiClient.GetRepositoryConfiguration(ctx, job.ID)
+		if err != nil {
+			return fmt.Errorf("error getting repository configuration: %w", err)
+		}
+		if current.LastGeneration != nil && current.LastGeneration.After(generatedAt) {
+			return nil
+		}
+	}
 
-	// create git blog post
+	// only the generation time is written, the job's snapshot of the configuration may be stale
+	_, err := a.strapiClient.UpdateRepositoryConfigurationGenerations(ctx, job.ID, strapiModels.RepositoryConfigurationGenerations{LastGeneration: &generatedAt})
+	if err != nil {
+		return fmt.Errorf("error updating repository configuration: %w", err)
+	}
 
 	return nil
 }
 
-func (a *App) trimContent(content string, tokens int) (string, error) {
-	tikToken, err := tiktoken.GetEncoding("cl100k_base")
+// onlyCommits keeps the commits that are also in refs, in their order.
+func onlyCommits(commits []*github.RepositoryCommit, refs []*github.RepositoryCommit) []*github.RepositoryCommit {
+	keep := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		keep[ref.GetSHA()] = true
+	}
+
+	var kept []*github.RepositoryCommit
+	for _, commit := range commits {
+		if keep[commit.GetSHA()] {
+			kept = append(kept, commit)
+		}
+	}
+
+	return kept
+}
+
+// withSizes fills in the sizes of the files from the tree entries at their paths.
+func withSizes(files []selection.File, treeEntries []*github.TreeEntry) []selection.File {
+	sizes := make(map[string]int, len(treeEntries))
+	for _, entry := range treeEntries {
+		sizes[entry.GetPath()] = entry.GetSize()
+	}
+
+	for i := range files {
+		if size, ok := sizes[files[i].Path]; ok {
+			files[i].Size = size
+		}
+	}
+
+	return files
+}
+
+// getChangedFiles returns the patches of the changed files keyed by path and the files that still exist,
+// vendored, generated and binary files and files outside the configuration's paths are left out.
+func (a *App) getChangedFiles(diffFiles []*github.CommitFile, paths []string) (map[string]string, []selection.File) {
+	var patches = make(map[string]string)
+	var filesChanged []selection.File
+
+	for _, file := range diffFiles {
+		if selection.Excluded(file.GetFilename()) || !selection.Matches(paths, file.GetFilename()) {
+			continue
+		}
+
+		if file.GetPatch() != "" {
+			patches[file.GetFilename()] = file.GetPatch()
+		}
+
+		if file.GetStatus() == "removed" {
+			continue
+		}
+
+		filesChanged = append(filesChanged, selection.File{Path: file.GetFilename(), Changes: file.GetChanges()})
+	}
+
+	return patches, filesChanged
+}
+
+// branchName returns the configuration's branch, or the repository's default branch when it has none.
+func branchName(ctx context.Context, userClient *github.Client, owner string, repo string, job strapiModels.RepositoryConfiguration) (string, error) {
+	if job.Branch != "" {
+		return job.Branch, nil
+	}
+
+	repoinfo, _, err := userClient.Repositories.Get(ctx, owner, repo)
 	if err != nil {
-		logging.Logger.Error("error getting tik token", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
-		return "", fmt.Errorf("error getting tik token: %w", err)
+		return "", fmt.Errorf("error getting repository info: %w", err)
 	}
 
-	contentTokens := tikToken.Encode(content, nil, nil)
+	return repoinfo.GetDefaultBranch(), nil
+}
 
-	if len(contentTokens) < tokens {
-		return content, nil
+// listCommits lists the commits touching the paths, newest first. GitHub filters commits by a
+// single path, so each directory the paths are confined to is listed and the results merged.
+func listCommits(ctx context.Context, userClient *github.Client, owner string, repo string, paths []string, options github.CommitsListOptions) ([]*github.RepositoryCommit, error) {
+	prefixes := selection.LiteralPrefixes(paths)
+	if len(prefixes) == 0 {
+		return listAllCommits(ctx, userClient, owner, repo, options)
 	}
 
-	overHangPercentage := float64(len(contentTokens)-tokens) / float64(len(contentTokens))
+	seen := make(map[string]bool)
+	var commits []*github.RepositoryCommit
 
-	// slice string based on percentage
+	for _, prefix := range prefixes {
+		options.Path = prefix
+		prefixCommits, err := listAllCommits(ctx, userClient, owner, repo, options)
+		if err != nil {
+			return nil, err
+		}
 
-	return content[:int(float64(len(content))*overHangPercentage)/100], nil
+		for _, commit := range prefixCommits {
+			if !seen[commit.GetSHA()] {
+				seen[commit.GetSHA()] = true
+				commits = append(commits, commit)
+			}
+		}
+	}
+
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].GetCommit().GetCommitter().GetDate().After(commits[j].GetCommit().GetCommitter().GetDate().Time)
+	})
+
+	return commits, nil
 }
 
-func (a *App) getContents(ctx context.Context, userClient *github.Client, username string, repo string, interestedFiles []string) (map[string]string, error) {
-	var contents = make(map[string]string)
-	for _, path := range interestedFiles {
-		content, _, _, err := userClient.Repositories.GetContents(ctx, username, repo, path, nil)
+// recentChanges returns the lines changed in each file by up to recentCommits commits before the
+// head. The counts only order files, so a failure to list or compare the commits is logged and
+// the files are ranked without them.
+func recentChanges(ctx context.Context, userClient *github.Client, owner string, repo string, headSHA string) map[string]int {
+	commits, _, err := userClient.Repositories.ListCommits(ctx, owner, repo, &github.CommitsListOptions{
+		SHA:         headSHA,
+		ListOptions: github.ListOptions{PerPage: recentCommits},
+	})
+	if err != nil {
+		logging.Logger.Warn("error listing recent commits, ranking files without them", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+		return nil
+	}
+	if len(commits) == 0 {
+		return nil
+	}
+
+	// commits are listed newest first, diff from the parent of the oldest commit to the head
+	oldestCommit := commits[len(commits)-1]
+	base := oldestCommit.GetSHA()
+	if len(oldestCommit.Parents) > 0 {
+		base = oldestCommit.Parents[0].GetSHA()
+	}
+	if base == headSHA {
+		return nil
+	}
+
+	diff, _, err := userClient.Repositories.CompareCommits(ctx, owner, repo, base, headSHA, nil)
+	if err != nil {
+		logging.Logger.Warn("error comparing recent commits, ranking files without them", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+		return nil
+	}
+
+	changes := make(map[string]int, len(diff.Files))
+	for _, file := range diff.Files {
+		changes[file.GetFilename()] = file.GetChanges()
+	}
+
+	return changes
+}
+
+// listAllCommits follows every page of the commit list, the oldest commit picks where the diff starts.
+func listAllCommits(ctx context.Context, userClient *github.Client, owner string, repo string, options github.CommitsListOptions) ([]*github.RepositoryCommit, error) {
+	options.ListOptions = github.ListOptions{PerPage: 100}
+
+	var commits []*github.RepositoryCommit
+	for {
+		page, resp, err := userClient.Repositories.ListCommits(ctx, owner, repo, &options)
 		if err != nil {
-			logging.Logger.Error("error getting contents", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
-			continue
+			return nil, err
 		}
 
-		if content == nil {
-			logging.Logger.Warn("content is nil")
-			continue
+		commits = append(commits, page...)
+
+		if resp.NextPage == 0 {
+			return commits, nil
 		}
+		options.Page = resp.NextPage
+	}
+}
+
+// completionOptions applies the repository configuration's model settings to a chat call.
+func completionOptions(job strapiModels.RepositoryConfiguration) gptModels.CompletionOptions {
+	return gptModels.CompletionOptions{
+		Model:       job.Model,
+		Temperature: job.Temperature,
+		TopP:        job.TopP,
+		MaxTokens:   job.MaxTokens,
+	}
+}
+
+// contentBudget returns the tokens available for file contents with the repository configuration's model.
+func (a *App) contentBudget(job strapiModels.RepositoryConfiguration) int {
+	model := job.Model
+	if model == "" {
+		model = a.chatGptClient.Model()
+	}
+
+	return gpt.ContentBudget(model, job.MaxTokens, job.TokenBudget)
+}
 
-		contentBytes, err := content.GetContent()
+// trimContents fits the contents into the token budget, contents smaller than their share are
+// kept whole and leave the rest of their share to larger contents. It returns the tokens of the
+// trimmed contents.
+func (a *App) trimContents(contents map[string]string, budget int) (map[string]string, int, error) {
+	sizes := make(map[string]int, len(contents))
+	for path, content := range contents {
+		size, err := tokens.Count(content)
 		if err != nil {
-			logging.Logger.Warn("error getting content bytes", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
-			continue
+			logging.Logger.Error("error counting tokens", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+			return nil, 0, err
 		}
+		sizes[path] = size
+	}
+
+	allocations := tokens.Allocate(sizes, budget)
 
-		if len(contentBytes) == 0 {
-			logging.Logger.Warn("content bytes is empty")
+	var used int
+	var trimmedContents = make(map[string]string, len(contents))
+
+	for path, content := range contents {
+		trimmedContent, err := tokens.Truncate(content, allocations[path])
+		if err != nil {
+			return nil, 0, err
+		}
+		if trimmedContent == "" {
 			continue
 		}
 
-		minifiedContent := strings.ReplaceAll(contentBytes, "\n", "")
-		minifiedContent = strings.ReplaceAll(minifiedContent, "\t", "")
-		minifiedContent = strings.ReplaceAll(minifiedContent, " ", "")
+		// text cut on a line boundary counts fewer tokens than its allocation, the rest of the
+		// budget is left to the caller
+		size := sizes[path]
+		if trimmedContent != content {
+			size, err = tokens.Count(trimmedContent)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+
+		trimmedContents[path] = trimmedContent
+		used += size
+	}
+
+	return trimmedContents, used, nil
+}
+
+// summariseTree lists the best of the ranked files and rolls the rest of the tree up by
+// directory, as far as needed for the listing to fit the token budget.
+func summariseTree(ranked []selection.File, budget int) []string {
+	files, rollups := selection.Summarise(ranked, rerankCandidates, fitsTokens(budget))
+
+	var lines []string
+	for _, file := range files {
+		lines = append(lines, file.String())
+	}
+	for _, rollup := range rollups {
+		lines = append(lines, rollup.String())
+	}
+
+	return lines
+}
+
+// fitsTokens reports whether lines fit the token budget once joined.
+func fitsTokens(budget int) func(lines []string) bool {
+	return func(lines []string) bool {
+		count, err := tokens.Count(strings.Join(lines, "\n"))
+		return err == nil && count <= budget
+	}
+}
+
+// contentSource picks where file contents are read from at the commit, blobs are looked up by path in blobSHAs.
+func (a *App) contentSource(userClient *github.Client, owner string, repo string, sha string, blobSHAs map[string]string) contents.Source {
+	if a.contentSourceKind == ContentSourceArchive {
+		return contents.NewArchiveSource(userClient, owner, repo, sha)
+	}
+	return contents.NewBlobSource(userClient, owner, repo, blobSHAs)
+}
 
-		contents[path] = minifiedContent
+// getContents reads the files from the source and normalises them, files that cannot be read are skipped.
+func (a *App) getContents(ctx context.Context, source contents.Source, interestedFiles []string) (map[string]string, error) {
+	files, err := source.Read(ctx, interestedFiles)
+	if err != nil {
+		return nil, err
+	}
 
+	var normalised = make(map[string]string, len(files))
+	for _, path := range interestedFiles {
+		content, ok := files[path]
+		if !ok || len(content) == 0 {
+			logging.Logger.Warn(fmt.Sprintf("no contents for %s", path))
+			continue
+		}
+
+		normalised[path] = a.normaliser.Normalise(path, content)
 	}
-	if len(contents) == 0 {
-		return nil, fmt.Errorf("no contents found")
+
+	if len(normalised) == 0 {
+		return nil, ErrNoContents
 	}
 
-	return contents, nil
+	return normalised, nil
 
 }
 
-func (a *App) getInterestedFiles(repoName string, allFiles []string) ([]string, error) {
-	fileToSend := strings.Join(allFiles, "\n")
+// getInterestedFiles ranks the tree locally and, when enabled, lets the model reorder the best
+// candidates. Paths the model returns that are not candidates are ignored.
+func (a *App) getInterestedFiles(ctx context.Context, job strapiModels.RepositoryConfiguration, repoName string, allFiles []selection.File, run *runModels.Run) ([]string, error) {
+	ranked := selection.Rank(allFiles, a.selectionOptions)
+	if len(ranked) == 0 {
+		return nil, nil
+	}
+
+	if !a.rerankFiles {
+		return selection.Paths(selection.Top(ranked, a.selectionOptions.MaxFiles)), nil
+	}
+
+	// the best candidates are listed for the model to choose from, the rest of the tree is
+	// rolled up by directory as far as needed to fit the budget
+	candidates, rollups := selection.Summarise(ranked, rerankCandidates, fitsTokens(a.contentBudget(job)))
+
+	if len(candidates) == 0 {
+		return selection.Paths(selection.Top(ranked, a.selectionOptions.MaxFiles)), nil
+	}
+
+	var candidateLines []string
+	for _, candidate := range candidates {
+		candidateLines = append(candidateLines, candidate.String())
+	}
+
+	var rollupLines []string
+	for _, rollup := range rollups {
+		rollupLines = append(rollupLines, rollup.String())
+	}
+
 	intestestFilesPrompts := []gptModels.Message{
 		{
 			Role:    gptModels.RoleSystem,
@@ -327,39 +808,54 @@ func (a *App) getInterestedFiles(repoName string, allFiles []string) ([]string,
 		},
 		{
 			Role:    gptModels.RoleUser,
-			Content: fileToSend,
+			Content: fmt.Sprintf(constants.InterestedFilesInput, repoName, strings.Join(candidateLines, "\n"), strings.Join(rollupLines, "\n")),
 		},
 	}
 
-	resp, err := a.chatGptClient.Chat(intestestFilesPrompts)
+	resp, err := a.chatGptClient.Chat(ctx, intestestFilesPrompts, gptModels.CompletionOptions{Model: job.Model})
 
 	if err != nil {
 		return nil, fmt.Errorf("error chatting with gpt: %w", err)
 	}
 
-	var files []string
+	run.TokensUsed += resp.Usage.TotalTokens
+
+	var reranked []selection.File
 
 	for _, choice := range resp.Choices {
-		files = append(files, strings.Split(choice.Message.Content, "\n")...)
+		reranked = append(reranked, selection.Validate(candidates, choice.Message.Content)...)
 	}
 
+	if len(reranked) == 0 {
+		logging.Logger.Warn(fmt.Sprintf("no valid files returned by the model, using local ranking for job ID : %d", job.ID))
+		reranked = ranked
+	}
+
+	files := selection.Paths(selection.Top(reranked, a.selectionOptions.MaxFiles))
+
 	logging.Logger.Info(strings.Join(files, "\n"))
 	return files, nil
+}
 
+// readPermissions lets a job read the repository's contents and pull requests.
+var readPermissions = &github.InstallationPermissions{
+	Contents:     github.String("read"),
+	Metadata:     github.String("read"),
+	PullRequests: github.String("read"),
 }
 
-func (a *App) getUserClientFromInstallation(ctx context.Context, installationID string) (*github.Client, error) {
+// getUserClientFromInstallation returns a client whose token only reaches the repository with
+// the given permissions, tokens are cached and refreshed before they expire.
+func (a *App) getUserClientFromInstallation(installationID string, repository string, permissions *github.InstallationPermissions) (*github.Client, error) {
 
 	instID, err := strconv.ParseInt(installationID, 10, 64)
 	if err != nil {
 		return nil, fmt.Errorf("error converting installation id to int: %w", err)
 	}
 
-	installationToken, _, err := a.githubClient.Apps.CreateInstallationToken(ctx, instID, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error creating installation token: %w", err)
-	}
-
-	return github.NewClient(http.DefaultClient).WithAuthToken(installationToken.GetToken()), nil
+	return a.installationTokens.Client(instID, tokenService.Scope{
+		Repository:  repository,
+		Permissions: permissions,
+	}), nil
 
 }
@@ -0,0 +1,610 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	gpt "github.com/TonyDMorris/quick-function/pkg/gpt/client"
+	gptModels "github.com/TonyDMorris/quick-function/pkg/gpt/models"
+	"github.com/TonyDMorris/quick-function/pkg/retry"
+	runModels "github.com/TonyDMorris/quick-function/pkg/runs/models"
+	"github.com/TonyDMorris/quick-function/pkg/selection"
+	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+	"github.com/TonyDMorris/quick-function/pkg/tokens"
+	"github.com/google/go-github/v56/github"
+)
+
+func TestHandleRepositoryConfigurationCreatedJob(t *testing.T) {
+	githubAPI := &fakeGitHub{
+		files: map[string]string{
+			"main.go":   "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n",
+			"README.md": "# Hello world\n\nSays hello.\n",
+		},
+	}
+	configuration := testRepositoryConfiguration(1)
+	strapiAPI := newFakeStrapi(configuration)
+	a, chatClient := newTestApp(t, githubAPI, strapiAPI)
+
+	run := &runModels.Run{}
+	if err := a.HandleRepositoryConfigurationCreatedJob(context.Background(), configuration, run); err != nil {
+		t.Fatalf("HandleRepositoryConfigurationCreatedJob() error = %v", err)
+	}
+
+	requests := chatClient.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("chat requests = %d, want 1", len(requests))
+	}
+	prompt := promptOf(requests[0])
+	for _, want := range []string{"main.go", "println", "README.md", "Says hello."} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt does not contain %q:\n%s", want, prompt)
+		}
+	}
+
+	posts := strapiAPI.Posts()
+	if len(posts) != 1 {
+		t.Fatalf("posts = %d, want 1", len(posts))
+	}
+	if !strings.HasPrefix(posts[0].Body, "# Fake post") {
+		t.Errorf("post body = %q, want the fake provider's post", posts[0].Body)
+	}
+	if posts[0].OwnerUsername != testOwner || posts[0].Title != testRepo {
+		t.Errorf("post = %+v, want it owned by %s titled %s", posts[0], testOwner, testRepo)
+	}
+
+	if run.CommitTo != testHeadSHA || run.GitBlogPostID != posts[0].ID || run.TokensUsed == 0 {
+		t.Errorf("run = %+v, want the head commit, the post and the tokens used", run)
+	}
+
+	assertGenerationUpdate(t, strapiAPI.Updates(1), "last_generation")
+}
+
+func TestHandleRepositoryConfigurationScheduledJob(t *testing.T) {
+	lastGeneration := time.Now().Add(-24 * time.Hour).UTC()
+
+	committedAt := &github.Timestamp{Time: lastGeneration.Add(time.Hour)}
+	githubAPI := &fakeGitHub{
+		files: map[string]string{
+			"main.go": "package main\n\nfunc main() {\n\tprintln(\"hello, world\")\n}\n",
+		},
+		// commits are listed newest first
+		commits: []*github.RepositoryCommit{
+			{SHA: github.String("commit-0"), Parents: []*github.Commit{{SHA: github.String("commit-1")}}},
+			{SHA: github.String("commit-1"), Parents: []*github.Commit{{SHA: github.String("base")}}},
+		},
+		comparison: &github.CommitsComparison{
+			Commits: []*github.RepositoryCommit{
+				{SHA: github.String("commit-1"), Commit: &github.Commit{Message: github.String("Greet the world"), Committer: &github.CommitAuthor{Date: committedAt}}},
+				{SHA: github.String("commit-0"), Commit: &github.Commit{Message: github.String("Add a comma"), Committer: &github.CommitAuthor{Date: committedAt}}},
+			},
+			Files: []*github.CommitFile{
+				{
+					Filename: github.String("main.go"),
+					Status:   github.String("modified"),
+					SHA:      github.String("blob-main.go"),
+					Changes:  github.Int(2),
+					Patch:    github.String("@@ -3 +3 @@\n-\tprintln(\"hello\")\n+\tprintln(\"hello, world\")"),
+				},
+			},
+		},
+	}
+	configuration := testRepositoryConfiguration(1)
+	configuration.LastGeneration = &lastGeneration
+	strapiAPI := newFakeStrapi(configuration)
+	a, chatClient := newTestApp(t, githubAPI, strapiAPI)
+
+	run := &runModels.Run{}
+	if err := a.HandleRepositoryConfigurationScheduledJob(context.Background(), configuration, run); err != nil {
+		t.Fatalf("HandleRepositoryConfigurationScheduledJob() error = %v", err)
+	}
+
+	// the diff starts at the parent of the oldest commit since the last generation
+	if compared := githubAPI.Compared(); !reflect.DeepEqual(compared, []string{"base...commit-0"}) {
+		t.Errorf("compared = %v, want [base...commit-0]", compared)
+	}
+
+	requests := chatClient.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("chat requests = %d, want 1", len(requests))
+	}
+	prompt := promptOf(requests[0])
+	for _, want := range []string{"Greet the world", "Add a comma", "+\tprintln(\"hello, world\")", testRepo} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt does not contain %q:\n%s", want, prompt)
+		}
+	}
+
+	posts := strapiAPI.Posts()
+	if len(posts) != 1 {
+		t.Fatalf("posts = %d, want 1", len(posts))
+	}
+	if !strings.HasPrefix(posts[0].Body, "# Fake post") || posts[0].CommitFrom == nil || posts[0].CommitTo == nil {
+		t.Errorf("post = %+v, want the fake provider's post with its commit range", posts[0])
+	}
+
+	assertGenerationUpdate(t, strapiAPI.Updates(1), "last_generation")
+}
+
+func TestHandleRepositoryConfigurationScheduledJobFollowsEveryPage(t *testing.T) {
+	lastGeneration := time.Now().Add(-24 * time.Hour).UTC()
+
+	// more commits than a page holds, the diff must start before the oldest of them
+	var commits []*github.RepositoryCommit
+	for i := 0; i < 150; i++ {
+		parent := fmt.Sprintf("commit-%d", i+1)
+		if i == 149 {
+			parent = "base"
+		}
+		commits = append(commits, &github.RepositoryCommit{
+			SHA:     github.String(fmt.Sprintf("commit-%d", i)),
+			Parents: []*github.Commit{{SHA: github.String(parent)}},
+		})
+	}
+
+	committedAt := &github.Timestamp{Time: lastGeneration.Add(time.Hour)}
+	githubAPI := &fakeGitHub{
+		files:   map[string]string{"main.go": "package main\n"},
+		commits: commits,
+		comparison: &github.CommitsComparison{
+			Commits: []*github.RepositoryCommit{
+				{SHA: github.String("commit-0"), Commit: &github.Commit{Message: github.String("Add a comma"), Committer: &github.CommitAuthor{Date: committedAt}}},
+			},
+			Files: []*github.CommitFile{
+				{Filename: github.String("main.go"), Status: github.String("modified"), SHA: github.String("blob-main.go"), Changes: github.Int(1), Patch: github.String("@@ -1 +1 @@\n-a\n+b")},
+			},
+		},
+	}
+	configuration := testRepositoryConfiguration(1)
+	configuration.LastGeneration = &lastGeneration
+	a, _ := newTestApp(t, githubAPI, newFakeStrapi(configuration))
+
+	if err := a.HandleRepositoryConfigurationScheduledJob(context.Background(), configuration, &runModels.Run{}); err != nil {
+		t.Fatalf("HandleRepositoryConfigurationScheduledJob() error = %v", err)
+	}
+
+	if compared := githubAPI.Compared(); !reflect.DeepEqual(compared, []string{"base...commit-0"}) {
+		t.Errorf("compared = %v, want [base...commit-0]", compared)
+	}
+}
+
+func TestHandleRepositoryConfigurationScheduledJobTrimsCommitMessages(t *testing.T) {
+	lastGeneration := time.Now().Add(-24 * time.Hour).UTC()
+	committedAt := &github.Timestamp{Time: lastGeneration.Add(time.Hour)}
+
+	// far more commit message text than the whole budget
+	var commits []*github.RepositoryCommit
+	for i := 0; i < 300; i++ {
+		commits = append(commits, &github.RepositoryCommit{
+			SHA:    github.String(fmt.Sprintf("commit-%d", i)),
+			Commit: &github.Commit{Message: github.String(fmt.Sprintf("Commit %d: %s", i, strings.Repeat("tidy up the handlers ", 20))), Committer: &github.CommitAuthor{Date: committedAt}},
+		})
+	}
+
+	githubAPI := &fakeGitHub{
+		files: map[string]string{"main.go": "package main\n"},
+		commits: []*github.RepositoryCommit{
+			{SHA: github.String("commit-0"), Parents: []*github.Commit{{SHA: github.String("base")}}},
+		},
+		comparison: &github.CommitsComparison{
+			Commits: commits,
+			Files: []*github.CommitFile{
+				{Filename: github.String("main.go"), Status: github.String("modified"), SHA: github.String("blob-main.go"), Changes: github.Int(1), Patch: github.String("@@ -1 +1 @@\n-a\n+b")},
+			},
+		},
+	}
+	configuration := testRepositoryConfiguration(1)
+	configuration.LastGeneration = &lastGeneration
+	configuration.TokenBudget = gpt.MinContentBudget
+	a, chatClient := newTestApp(t, githubAPI, newFakeStrapi(configuration))
+
+	if err := a.HandleRepositoryConfigurationScheduledJob(context.Background(), configuration, &runModels.Run{}); err != nil {
+		t.Fatalf("HandleRepositoryConfigurationScheduledJob() error = %v", err)
+	}
+
+	requests := chatClient.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("chat requests = %d, want 1", len(requests))
+	}
+	prompt := promptOf(requests[0])
+
+	// the commit messages are cut to their share of the budget, the patches still fit
+	count, err := tokens.Count(prompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count > 2*gpt.MinContentBudget {
+		t.Errorf("prompt = %d tokens, want it within the budget of %d and the instructions", count, gpt.MinContentBudget)
+	}
+	if !strings.Contains(prompt, "Commit 0:") || strings.Contains(prompt, "Commit 299:") {
+		t.Error("prompt does not hold the first commit messages only")
+	}
+	if !strings.Contains(prompt, "+b") {
+		t.Errorf("prompt does not contain the patch:\n%s", prompt)
+	}
+}
+
+func TestHandleRepositoryConfigurationScheduledJobWithoutCommits(t *testing.T) {
+	lastGeneration := time.Now().Add(-time.Hour).UTC()
+
+	configuration := testRepositoryConfiguration(1)
+	configuration.LastGeneration = &lastGeneration
+	strapiAPI := newFakeStrapi(configuration)
+	a, chatClient := newTestApp(t, &fakeGitHub{}, strapiAPI)
+
+	run := &runModels.Run{}
+	if err := a.HandleRepositoryConfigurationScheduledJob(context.Background(), configuration, run); err != nil {
+		t.Fatalf("HandleRepositoryConfigurationScheduledJob() error = %v", err)
+	}
+
+	if run.Status != runModels.RunStatusSkipped {
+		t.Errorf("run status = %s, want %s", run.Status, runModels.RunStatusSkipped)
+	}
+	if requests := chatClient.Requests(); len(requests) != 0 {
+		t.Errorf("chat requests = %d, want none", len(requests))
+	}
+	if posts := strapiAPI.Posts(); len(posts) != 0 {
+		t.Errorf("posts = %d, want none", len(posts))
+	}
+}
+
+func TestGetChangedFiles(t *testing.T) {
+	a := &App{}
+
+	diffFiles := []*github.CommitFile{
+		{Filename: github.String("main.go"), Status: github.String("modified"), Changes: github.Int(2), Patch: github.String("@@ -1 +1 @@\n-a\n+b")},
+		{Filename: github.String("old.go"), Status: github.String("removed"), Changes: github.Int(1), Patch: github.String("@@ -1 +0,0 @@\n-a")},
+		{Filename: github.String("README.md"), Status: github.String("added"), Changes: github.Int(5), Patch: github.String("@@ -0,0 +1 @@\n+# Readme")},
+		{Filename: github.String("logo.png"), Status: github.String("added")},
+		{Filename: github.String("go.sum"), Status: github.String("modified"), Changes: github.Int(2), Patch: github.String("@@ -1 +1 @@\n-a\n+b")},
+		{Filename: github.String("services/api/handler.go"), Status: github.String("modified"), Changes: github.Int(3), Patch: github.String("@@ -1 +1 @@\n-c\n+d")},
+	}
+
+	patches, filesChanged := a.getChangedFiles(diffFiles, nil)
+
+	// removed files keep their patch but have no contents to read, excluded files are dropped
+	wantPatches := map[string]string{
+		"main.go":   "@@ -1 +1 @@\n-a\n+b",
+		"old.go":    "@@ -1 +0,0 @@\n-a",
+		"README.md": "@@ -0,0 +1 @@\n+# Readme",
+
+		"services/api/handler.go": "@@ -1 +1 @@\n-c\n+d",
+	}
+	if !reflect.DeepEqual(patches, wantPatches) {
+		t.Errorf("patches = %v, want %v", patches, wantPatches)
+	}
+	if want := []selection.File{{Path: "main.go", Changes: 2}, {Path: "README.md", Changes: 5}, {Path: "services/api/handler.go", Changes: 3}}; !reflect.DeepEqual(filesChanged, want) {
+		t.Errorf("files changed = %v, want %v", filesChanged, want)
+	}
+
+	// files outside the configuration's paths are left out
+	patches, filesChanged = a.getChangedFiles(diffFiles, []string{"services/api"})
+	if want := map[string]string{"services/api/handler.go": "@@ -1 +1 @@\n-c\n+d"}; !reflect.DeepEqual(patches, want) {
+		t.Errorf("patches = %v, want %v", patches, want)
+	}
+	if want := []selection.File{{Path: "services/api/handler.go", Changes: 3}}; !reflect.DeepEqual(filesChanged, want) {
+		t.Errorf("files changed = %v, want %v", filesChanged, want)
+	}
+}
+
+func promptOf(messages []gptModels.Message) string {
+	var contents []string
+	for _, message := range messages {
+		contents = append(contents, message.Content)
+	}
+	return strings.Join(contents, "\n")
+}
+
+// assertGenerationUpdate checks the configuration was updated once and the update set only the fields.
+func assertGenerationUpdate(t *testing.T, updates []map[string]interface{}, fields ...string) {
+	t.Helper()
+
+	if len(updates) != 1 {
+		t.Fatalf("configuration updates = %d, want 1", len(updates))
+	}
+
+	// only the generation times are written back, edits made in Strapi meanwhile are kept
+	var keys []string
+	for key := range updates[0] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sort.Strings(fields)
+
+	if !reflect.DeepEqual(keys, fields) {
+		t.Errorf("configuration update fields = %v, want %v", keys, fields)
+	}
+}
+
+// panickingChatClient panics on every chat, as a bug in a provider client would.
+type panickingChatClient struct {
+	*gpt.FakeChatClient
+}
+
+func (c panickingChatClient) Chat(ctx context.Context, messages []gptModels.Message, options gptModels.CompletionOptions) (*gptModels.CompletionResponse, error) {
+	panic("provider client bug")
+}
+
+func TestHandleRepositoryConfigurationJobsFailWhenTheyPanic(t *testing.T) {
+	lastGeneration := time.Now().Add(-24 * time.Hour).UTC()
+	scheduled := testRepositoryConfiguration(1)
+	scheduled.LastGeneration = &lastGeneration
+
+	tests := []struct {
+		name          string
+		configuration strapiModels.RepositoryConfiguration
+		handle        func(a *App) func(context.Context, strapiModels.RepositoryConfiguration, *runModels.Run) error
+	}{
+		{
+			name:          "created",
+			configuration: testRepositoryConfiguration(1),
+			handle: func(a *App) func(context.Context, strapiModels.RepositoryConfiguration, *runModels.Run) error {
+				return a.HandleRepositoryConfigurationCreatedJob
+			},
+		},
+		{
+			name:          "scheduled",
+			configuration: scheduled,
+			handle: func(a *App) func(context.Context, strapiModels.RepositoryConfiguration, *runModels.Run) error {
+				return a.HandleRepositoryConfigurationScheduledJob
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			committedAt := &github.Timestamp{Time: lastGeneration.Add(time.Hour)}
+			githubAPI := &fakeGitHub{
+				files: map[string]string{"main.go": "package main\n"},
+				commits: []*github.RepositoryCommit{
+					{SHA: github.String("commit-0"), Parents: []*github.Commit{{SHA: github.String("base")}}},
+				},
+				comparison: &github.CommitsComparison{
+					Commits: []*github.RepositoryCommit{
+						{SHA: github.String("commit-0"), Commit: &github.Commit{Message: github.String("Start"), Committer: &github.CommitAuthor{Date: committedAt}}},
+					},
+					Files: []*github.CommitFile{
+						{Filename: github.String("main.go"), Status: github.String("added"), SHA: github.String("blob-main.go"), Patch: github.String("+package main")},
+					},
+				},
+			}
+			strapiAPI := newFakeStrapi(tt.configuration)
+			a, chatClient := newTestApp(t, githubAPI, strapiAPI)
+			a.chatGptClient = panickingChatClient{chatClient}
+
+			err := tt.handle(a)(context.Background(), tt.configuration, &runModels.Run{})
+			if err == nil || !strings.Contains(err.Error(), "provider client bug") {
+				t.Errorf("error = %v, want the panic", err)
+			}
+			if posts := strapiAPI.Posts(); len(posts) != 0 {
+				t.Errorf("posts = %d, want none", len(posts))
+			}
+		})
+	}
+}
+
+func TestHandleRepositoryConfigurationCreatedJobRetriesOnlyTheGenerationUpdate(t *testing.T) {
+	githubAPI := &fakeGitHub{
+		files: map[string]string{"main.go": "package main\n\nfunc main() {}\n"},
+	}
+	configuration := testRepositoryConfiguration(1)
+	strapiAPI := newFakeStrapi(configuration)
+	strapiAPI.failUpdates = 1
+	a, chatClient := newTestApp(t, githubAPI, strapiAPI)
+	a.retryPolicy = retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	run, err := a.enqueueJob(runModels.RunTypeCreated, runModels.RunTriggerManual, configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queuedJob := QueuedJob{RunID: run.ID, Type: run.Type, RepositoryConfiguration: configuration}
+
+	// the post is made but the generation update times out
+	retryAt, err := a.runJob(context.Background(), queuedJob, a.HandleRepositoryConfigurationCreatedJob)
+	if err != nil || retryAt.IsZero() {
+		t.Fatalf("runJob() = %s, %v, want a retry", retryAt, err)
+	}
+	got, err := a.runStore.Get(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GitBlogPostID == 0 || got.GeneratedAt == nil {
+		t.Fatalf("run = %+v, want the post recorded before the retry", got)
+	}
+
+	if retryAt, err := a.runJob(context.Background(), queuedJob, a.HandleRepositoryConfigurationCreatedJob); err != nil || !retryAt.IsZero() {
+		t.Fatalf("runJob() = %s, %v, want it to succeed", retryAt, err)
+	}
+
+	if posts := strapiAPI.Posts(); len(posts) != 1 {
+		t.Errorf("posts = %d, want 1", len(posts))
+	}
+	if requests := chatClient.Requests(); len(requests) != 1 {
+		t.Errorf("chat requests = %d, want 1", len(requests))
+	}
+	updates := strapiAPI.Updates(1)
+	assertGenerationUpdate(t, updates, "last_generation")
+	if updates[0]["last_generation"] != got.GeneratedAt.Format(time.RFC3339Nano) {
+		t.Errorf("update = %v, want the generation time of the post %s", updates[0], got.GeneratedAt.Format(time.RFC3339Nano))
+	}
+}
+
+func TestTrimContents(t *testing.T) {
+	var large strings.Builder
+	for i := 0; i < 400; i++ {
+		fmt.Fprintf(&large, "func handler%d(w http.ResponseWriter, r *http.Request) {}\n\n", i)
+	}
+
+	contents := map[string]string{
+		"README.md": "# Hello world\n",
+		"main.go":   large.String(),
+	}
+
+	a := &App{}
+	trimmed, used, err := a.trimContents(contents, 500)
+	if err != nil {
+		t.Fatalf("trimContents() error = %v", err)
+	}
+
+	if trimmed["README.md"] != contents["README.md"] {
+		t.Errorf("README.md = %q, want the small file kept whole", trimmed["README.md"])
+	}
+	if !strings.HasPrefix(contents["main.go"], strings.SplitAfter(trimmed["main.go"], "\n")[0]) || len(trimmed["main.go"]) >= len(contents["main.go"]) {
+		t.Errorf("main.go was not truncated to its head")
+	}
+
+	// the tokens used are those of the trimmed contents, not of their allocations
+	var want int
+	for _, content := range trimmed {
+		size, err := tokens.Count(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want += size
+	}
+	if used != want {
+		t.Errorf("used = %d, want the %d tokens of the trimmed contents", used, want)
+	}
+	if used > 500 {
+		t.Errorf("used = %d, want at most the budget of 500", used)
+	}
+}
+
+func TestHandleRepositoryConfigurationCreatedJobPrefersRecentlyChangedFiles(t *testing.T) {
+	githubAPI := &fakeGitHub{
+		files: map[string]string{
+			"pkg/a/a.go": "package a\n\nfunc Unchanged() {}\n",
+			"pkg/b/b.go": "package b\n\nfunc Changed() {}\n",
+		},
+		commits: []*github.RepositoryCommit{
+			{SHA: github.String(testHeadSHA)},
+			{SHA: github.String("oldest"), Parents: []*github.Commit{{SHA: github.String("parent")}}},
+		},
+		comparison: &github.CommitsComparison{
+			Files: []*github.CommitFile{{Filename: github.String("pkg/b/b.go"), Changes: github.Int(40)}},
+		},
+	}
+	configuration := testRepositoryConfiguration(1)
+	a, chatClient := newTestApp(t, githubAPI, newFakeStrapi(configuration))
+	a.selectionOptions.MaxFiles = 1
+
+	if err := a.HandleRepositoryConfigurationCreatedJob(context.Background(), configuration, &runModels.Run{}); err != nil {
+		t.Fatalf("HandleRepositoryConfigurationCreatedJob() error = %v", err)
+	}
+
+	// the two files rank equally but for the recent changes
+	prompt := promptOf(chatClient.Requests()[0])
+	if !strings.Contains(prompt, "func Changed") || strings.Contains(prompt, "func Unchanged") {
+		t.Errorf("prompt = %s, want only the recently changed file", prompt)
+	}
+	// the file left out is still outlined
+	if _, outline, _ := strings.Cut(prompt, "REPOSITORY OUTLINE"); !strings.Contains(outline, "pkg/a/a.go:") {
+		t.Errorf("prompt = %s, want the unchanged file in the outline", prompt)
+	}
+	if compared := githubAPI.Compared(); !reflect.DeepEqual(compared, []string{"parent..." + testHeadSHA}) {
+		t.Errorf("compared = %v, want the parent of the oldest recent commit to the head", compared)
+	}
+}
+
+func TestHandleRepositoryConfigurationScheduledJobLeavesOutLargeChangedFiles(t *testing.T) {
+	lastGeneration := time.Now().Add(-24 * time.Hour).UTC()
+	committedAt := &github.Timestamp{Time: lastGeneration.Add(time.Hour)}
+
+	githubAPI := &fakeGitHub{
+		files: map[string]string{
+			"large.go": "package main\n\nfunc Large() {}\n" + strings.Repeat("// padding\n", 100),
+			"small.go": "package main\n\nfunc Small() {}\n",
+		},
+		commits: []*github.RepositoryCommit{
+			{SHA: github.String("commit-0"), Parents: []*github.Commit{{SHA: github.String("base")}}},
+		},
+		comparison: &github.CommitsComparison{
+			Commits: []*github.RepositoryCommit{
+				{SHA: github.String("commit-0"), Commit: &github.Commit{Message: github.String("Add both"), Committer: &github.CommitAuthor{Date: committedAt}}},
+			},
+			// the comparison lists no sizes, the large file has the most changes
+			Files: []*github.CommitFile{
+				{Filename: github.String("large.go"), Status: github.String("added"), SHA: github.String("blob-large.go"), Changes: github.Int(103)},
+				{Filename: github.String("small.go"), Status: github.String("added"), SHA: github.String("blob-small.go"), Changes: github.Int(3)},
+			},
+		},
+	}
+	configuration := testRepositoryConfiguration(1)
+	configuration.LastGeneration = &lastGeneration
+	a, chatClient := newTestApp(t, githubAPI, newFakeStrapi(configuration))
+	a.selectionOptions.MaxFileSize = 100
+
+	if err := a.HandleRepositoryConfigurationScheduledJob(context.Background(), configuration, &runModels.Run{}); err != nil {
+		t.Fatalf("HandleRepositoryConfigurationScheduledJob() error = %v", err)
+	}
+
+	prompt := promptOf(chatClient.Requests()[0])
+	if !strings.Contains(prompt, "func Small") || strings.Contains(prompt, "func Large") {
+		t.Errorf("prompt = %s, want only the changed file under the size limit", prompt)
+	}
+}
+
+func TestHandleRepositoryConfigurationScheduledJobDescribesCommitsInPaths(t *testing.T) {
+	lastGeneration := time.Now().Add(-24 * time.Hour).UTC()
+	committedAt := &github.Timestamp{Time: lastGeneration.Add(time.Hour)}
+
+	tests := []struct {
+		name string
+		run  *runModels.Run
+	}{
+		{name: "since the last generation", run: &runModels.Run{}},
+		{name: "pushed range", run: &runModels.Run{CommitFrom: "base", CommitTo: "commit-0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			githubAPI := &fakeGitHub{
+				files: map[string]string{
+					"services/api/main.go": "package main\n",
+					"web/app.ts":           "export {}\n",
+				},
+				commits: []*github.RepositoryCommit{
+					{SHA: github.String("commit-0"), Parents: []*github.Commit{{SHA: github.String("commit-1")}}},
+					{SHA: github.String("commit-1"), Parents: []*github.Commit{{SHA: github.String("base")}}},
+				},
+				commitFiles: map[string][]string{
+					"commit-0": {"services/api/main.go"},
+					"commit-1": {"web/app.ts"},
+				},
+				comparison: &github.CommitsComparison{
+					Commits: []*github.RepositoryCommit{
+						{SHA: github.String("commit-1"), Commit: &github.Commit{Message: github.String("Restyle the web app"), Committer: &github.CommitAuthor{Date: committedAt}}},
+						{SHA: github.String("commit-0"), Commit: &github.Commit{Message: github.String("Add an API endpoint"), Committer: &github.CommitAuthor{Date: committedAt}}},
+					},
+					Files: []*github.CommitFile{
+						{Filename: github.String("services/api/main.go"), Status: github.String("modified"), SHA: github.String("blob-services/api/main.go"), Changes: github.Int(1), Patch: github.String("+package main")},
+						{Filename: github.String("web/app.ts"), Status: github.String("modified"), SHA: github.String("blob-web/app.ts"), Changes: github.Int(1), Patch: github.String("+export {}")},
+					},
+				},
+			}
+			configuration := testRepositoryConfiguration(1)
+			configuration.LastGeneration = &lastGeneration
+			configuration.Paths = []string{"services/api"}
+			a, chatClient := newTestApp(t, githubAPI, newFakeStrapi(configuration))
+
+			if err := a.HandleRepositoryConfigurationScheduledJob(context.Background(), configuration, tt.run); err != nil {
+				t.Fatalf("HandleRepositoryConfigurationScheduledJob() error = %v", err)
+			}
+
+			prompt := promptOf(chatClient.Requests()[0])
+			if !strings.Contains(prompt, "Add an API endpoint") || strings.Contains(prompt, "Restyle the web app") {
+				t.Errorf("prompt = %s, want only the commit touching services/api", prompt)
+			}
+			if strings.Contains(prompt, "web/app.ts") {
+				t.Errorf("prompt = %s, want no files outside services/api", prompt)
+			}
+			if lookups := githubAPI.PullLookups(); !reflect.DeepEqual(lookups, []string{"commit-0"}) {
+				t.Errorf("pull request lookups = %v, want only commit-0", lookups)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/TonyDMorris/quick-function/pkg/logging"
+	"github.com/TonyDMorris/quick-function/pkg/normalise"
+	"github.com/google/go-github/v56/github"
+	"go.uber.org/zap/zapcore"
+)
+
+// maxResolvedCommits caps the commits resolved to pull requests, each one is an API call.
+const maxResolvedCommits = 100
+
+// Pull request groups, in the order they appear in a digest.
+const (
+	pullRequestGroupFeature = "feature"
+	pullRequestGroupFix     = "fix"
+	pullRequestGroupChore   = "chore"
+	pullRequestGroupOther   = "other"
+)
+
+var pullRequestGroups = []string{pullRequestGroupFeature, pullRequestGroupFix, pullRequestGroupChore, pullRequestGroupOther}
+
+// labelGroups maps the words of label names to a group, after the labels GitHub and common release tooling create.
+var labelGroups = []struct {
+	word  string
+	group string
+}{
+	{"feature", pullRequestGroupFeature},
+	{"enhancement", pullRequestGroupFeature},
+	{"feat", pullRequestGroupFeature},
+	{"bug", pullRequestGroupFix},
+	{"fix", pullRequestGroupFix},
+	{"bugfix", pullRequestGroupFix},
+	{"regression", pullRequestGroupFix},
+	{"security", pullRequestGroupFix},
+	{"chore", pullRequestGroupChore},
+	{"maintenance", pullRequestGroupChore},
+	{"dependencies", pullRequestGroupChore},
+	{"documentation", pullRequestGroupChore},
+	{"docs", pullRequestGroupChore},
+	{"refactor", pullRequestGroupChore},
+	{"ci", pullRequestGroupChore},
+	{"test", pullRequestGroupChore},
+}
+
+// conventionalPrefix matches a conventional commit style title such as "feat(api): ...".
+var conventionalPrefix = regexp.MustCompile(`^(\w+)(\([^)]*\))?!?:`)
+
+var htmlComments = regexp.MustCompile(`(?s)<!--.*?-->`)
+
+// mergedPullRequests resolves the commits to the pull requests that merged them, in the order
+// they were first seen. Commits past maxResolvedCommits are not resolved.
+func (a *App) mergedPullRequests(ctx context.Context, userClient *github.Client, owner string, repo string, commits []*github.RepositoryCommit) []*github.PullRequest {
+	seen := make(map[int]bool)
+	var pullRequests []*github.PullRequest
+
+	for i, commit := range commits {
+		if i >= maxResolvedCommits {
+			break
+		}
+
+		commitPullRequests, _, err := userClient.PullRequests.ListPullRequestsWithCommit(ctx, owner, repo, commit.GetSHA(), nil)
+		if err != nil {
+			logging.Logger.Warn(fmt.Sprintf("error getting pull requests for commit: %s", commit.GetSHA()), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+			continue
+		}
+
+		for _, pullRequest := range commitPullRequests {
+			if pullRequest.MergedAt == nil || seen[pullRequest.GetNumber()] {
+				continue
+			}
+			seen[pullRequest.GetNumber()] = true
+			pullRequests = append(pullRequests, pullRequest)
+		}
+	}
+
+	return pullRequests
+}
+
+// pullRequestGroup picks the group of a pull request from its labels, falling back to a
+// conventional commit prefix on its title.
+func pullRequestGroup(pullRequest *github.PullRequest) string {
+	for _, label := range pullRequest.Labels {
+		words := strings.FieldsFunc(strings.ToLower(label.GetName()), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			if group, ok := groupForWord(word); ok {
+				return group
+			}
+		}
+	}
+
+	if match := conventionalPrefix.FindStringSubmatch(strings.ToLower(pullRequest.GetTitle())); match != nil {
+		if group, ok := groupForWord(match[1]); ok {
+			return group
+		}
+	}
+
+	return pullRequestGroupOther
+}
+
+func groupForWord(word string) (string, bool) {
+	for _, labelGroup := range labelGroups {
+		if word == labelGroup.word {
+			return labelGroup.group, true
+		}
+	}
+	return "", false
+}
+
+// pullRequestDigest formats the pull requests with their authors, labels and descriptions,
+// grouped by label, and fits them into the token budget. It returns the tokens used.
+func (a *App) pullRequestDigest(pullRequests []*github.PullRequest, budget int) (string, int, error) {
+	if len(pullRequests) == 0 {
+		return "", 0, nil
+	}
+
+	entries := make(map[string]string, len(pullRequests))
+	grouped := make(map[string][]string)
+
+	for _, pullRequest := range pullRequests {
+		key := fmt.Sprintf("#%d", pullRequest.GetNumber())
+
+		var labels []string
+		for _, label := range pullRequest.Labels {
+			labels = append(labels, label.GetName())
+		}
+
+		entry := fmt.Sprintf("%s %s by %s", key, pullRequest.GetTitle(), pullRequest.GetUser().GetLogin())
+		if len(labels) > 0 {
+			entry += fmt.Sprintf(" [%s]", strings.Join(labels, ", "))
+		}
+		if body := normalise.CollapseWhitespace(htmlComments.ReplaceAllString(pullRequest.GetBody(), "")); body != "" {
+			entry += "\n" + body
+		}
+
+		entries[key] = entry
+		group := pullRequestGroup(pullRequest)
+		grouped[group] = append(grouped[group], key)
+	}
+
+	trimmed, used, err := a.trimContents(entries, budget)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var sections []string
+	for _, group := range pullRequestGroups {
+		var groupEntries []string
+		for _, key := range grouped[group] {
+			if entry, ok := trimmed[key]; ok {
+				groupEntries = append(groupEntries, entry)
+			}
+		}
+		if len(groupEntries) == 0 {
+			continue
+		}
+
+		sections = append(sections, fmt.Sprintf("%s:\n%s", strings.ToUpper(group), strings.Join(groupEntries, "\n\n")))
+	}
+
+	return strings.Join(sections, "\n\n"), used, nil
+}
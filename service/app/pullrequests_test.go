@@ -0,0 +1,70 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+)
+
+func pullRequest(number int, title string, labels ...string) *github.PullRequest {
+	pullRequest := &github.PullRequest{
+		Number: github.Int(number),
+		Title:  github.String(title),
+		User:   &github.User{Login: github.String("octocat")},
+	}
+	for _, label := range labels {
+		pullRequest.Labels = append(pullRequest.Labels, &github.Label{Name: github.String(label)})
+	}
+	return pullRequest
+}
+
+func TestPullRequestGroup(t *testing.T) {
+	tests := []struct {
+		name        string
+		pullRequest *github.PullRequest
+		want        string
+	}{
+		{name: "feature label", pullRequest: pullRequest(1, "Add search", "enhancement"), want: pullRequestGroupFeature},
+		{name: "label words are split", pullRequest: pullRequest(2, "Handle nil", "type: Bug"), want: pullRequestGroupFix},
+		{name: "first matching label wins", pullRequest: pullRequest(3, "Bump deps", "dependencies", "bug"), want: pullRequestGroupChore},
+		{name: "conventional title", pullRequest: pullRequest(4, "feat(api)!: add search"), want: pullRequestGroupFeature},
+		{name: "labels before title", pullRequest: pullRequest(5, "fix: typo", "docs"), want: pullRequestGroupChore},
+		{name: "unknown label and title", pullRequest: pullRequest(6, "Update things", "needs review"), want: pullRequestGroupOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pullRequestGroup(tt.pullRequest); got != tt.want {
+				t.Errorf("pullRequestGroup() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPullRequestDigest(t *testing.T) {
+	a := &App{}
+
+	withBody := pullRequest(3, "Fix crash on empty repository", "bug")
+	withBody.Body = github.String("<!-- template -->\nReturn early when the tree is empty.\n\n\n")
+
+	digest, _, err := a.pullRequestDigest([]*github.PullRequest{
+		pullRequest(1, "Update README"),
+		pullRequest(2, "Add search", "enhancement"),
+		withBody,
+	}, 1000)
+	if err != nil {
+		t.Fatalf("pullRequestDigest() error = %v", err)
+	}
+
+	// groups appear features first and other last, template comments are dropped
+	want := "FEATURE:\n#2 Add search by octocat [enhancement]\n\n" +
+		"FIX:\n#3 Fix crash on empty repository by octocat [bug]\nReturn early when the tree is empty.\n\n" +
+		"OTHER:\n#1 Update README by octocat"
+	if digest != want {
+		t.Errorf("pullRequestDigest() = %q, want %q", digest, want)
+	}
+
+	if digest, used, err := a.pullRequestDigest(nil, 1000); digest != "" || used != 0 || err != nil {
+		t.Errorf("pullRequestDigest(nil) = %q, %d, %v, want nothing", digest, used, err)
+	}
+}
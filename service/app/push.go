@@ -0,0 +1,218 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/lease"
+	"github.com/TonyDMorris/quick-function/pkg/logging"
+	runModels "github.com/TonyDMorris/quick-function/pkg/runs/models"
+	"github.com/TonyDMorris/quick-function/pkg/selection"
+	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+	"github.com/google/go-github/v56/github"
+	"github.com/google/uuid"
+	"go.uber.org/zap/zapcore"
+)
+
+const defaultPushQuietPeriod = 30 * time.Minute
+
+// zeroSHA is the before SHA of a push creating a branch.
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// pushLockPoll is how often a held push lock is retried.
+const pushLockPoll = 10 * time.Millisecond
+
+// pushLockTTL bounds how long a replica that died while merging a push holds the lock.
+const pushLockTTL = 30 * time.Second
+
+func (a *App) handlePushEvent(ctx context.Context, event *github.PushEvent) error {
+	repo := event.GetRepo()
+
+	if event.GetDeleted() {
+		return nil
+	}
+
+	repositoryConfigurations, err := a.repositoryConfigurationsForRepository(ctx, repo.GetID())
+	if err != nil {
+		return err
+	}
+
+	for _, repositoryConfiguration := range repositoryConfigurations {
+		if repositoryConfiguration.Trigger != strapiModels.TriggerPush {
+			continue
+		}
+
+		branch := repositoryConfiguration.Branch
+		if branch == "" {
+			branch = repo.GetDefaultBranch()
+		}
+		if event.GetRef() != "refs/heads/"+branch || !pushTouchesPaths(event, repositoryConfiguration.Paths) {
+			continue
+		}
+
+		logging.Logger.Info(fmt.Sprintf("push to %s %s from %s to %s, for job ID : %d", repo.GetFullName(), event.GetRef(), event.GetBefore(), event.GetAfter(), repositoryConfiguration.ID))
+
+		if err := a.enqueuePush(ctx, repositoryConfiguration, event.GetBefore(), event.GetAfter(), event.GetSize()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pushTouchesPaths reports whether the push changed a file under the paths. The payload lists
+// at most twenty commits, a larger push is assumed to touch them.
+func pushTouchesPaths(event *github.PushEvent, paths []string) bool {
+	if len(paths) == 0 || len(event.Commits) < event.GetSize() {
+		return true
+	}
+
+	for _, commit := range event.Commits {
+		for _, files := range [][]string{commit.Added, commit.Modified, commit.Removed} {
+			for _, file := range files {
+				if selection.Matches(paths, file) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// enqueuePush queues an incremental generation over the pushed range, visible once the quiet
+// period ends or straight away when enough commits are pending. Push runs still queued for the
+// configuration are merged in, the new run starts at the first of their ranges and they are
+// skipped. The pending runs are kept in the run store and queue rather than in memory, so
+// pushes delivered across a restart are debounced together. The run store and queue files
+// belong to one replica, pushes delivered to different replicas are debounced apart.
+func (a *App) enqueuePush(ctx context.Context, repositoryConfiguration strapiModels.RepositoryConfiguration, before string, after string, commits int) error {
+	return a.withPushLock(ctx, repositoryConfiguration.ID, func() error {
+		pending, err := a.pendingPushes(repositoryConfiguration.ID)
+		if err != nil {
+			return err
+		}
+
+		run := runModels.Run{
+			Type:       runModels.RunTypeScheduled,
+			Trigger:    runModels.RunTriggerPush,
+			CommitFrom: before,
+			CommitTo:   after,
+			Commits:    commits,
+		}
+		if len(pending) > 0 {
+			run.CommitFrom = pending[0].CommitFrom
+		}
+		for _, pendingRun := range pending {
+			run.Commits += pendingRun.Commits
+		}
+
+		// a new branch has no before commit, diff from the last generation instead
+		if run.CommitFrom == zeroSHA {
+			run.CommitFrom = ""
+		}
+
+		quietPeriod := time.Duration(repositoryConfiguration.PushQuietMinutes) * time.Minute
+		if quietPeriod <= 0 {
+			quietPeriod = defaultPushQuietPeriod
+		}
+
+		at := time.Now().Add(quietPeriod)
+		if repositoryConfiguration.PushCommitThreshold > 0 && run.Commits >= repositoryConfiguration.PushCommitThreshold {
+			at = time.Time{}
+		}
+
+		queued, err := a.enqueueRunAt(run, repositoryConfiguration, at)
+		if err != nil {
+			return fmt.Errorf("error enqueueing push job: %w", err)
+		}
+
+		a.skipRuns(pending, fmt.Sprintf("merged into run %s", queued.ID))
+
+		return nil
+	})
+}
+
+// cancelPendingPushes skips the push runs still queued for the configuration, such as when
+// it stops being triggered by pushes.
+func (a *App) cancelPendingPushes(ctx context.Context, id int) error {
+	return a.withPushLock(ctx, id, func() error {
+		pending, err := a.pendingPushes(id)
+		if err != nil {
+			return err
+		}
+
+		a.skipRuns(pending, "repository configuration changed")
+
+		return nil
+	})
+}
+
+// pendingPushes returns the push runs of the configuration that are queued and were never
+// started, oldest first. A run waiting for a retry has generated from its range already.
+func (a *App) pendingPushes(id int) ([]runModels.Run, error) {
+	runs, err := a.runStore.List(runModels.RunFilter{RepositoryConfigurationID: id, Status: runModels.RunStatusQueued})
+	if err != nil {
+		return nil, fmt.Errorf("error listing queued runs: %w", err)
+	}
+
+	var pending []runModels.Run
+	for _, run := range runs {
+		if run.Trigger == runModels.RunTriggerPush && run.Attempts == 0 {
+			pending = append(pending, run)
+		}
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].QueuedAt.Before(pending[j].QueuedAt)
+	})
+
+	return pending, nil
+}
+
+// skipRuns marks the queued runs skipped, the workers drop their jobs when they come up.
+func (a *App) skipRuns(runs []runModels.Run, reason string) {
+	for _, run := range runs {
+		endedAt := time.Now().UTC()
+		run.Status = runModels.RunStatusSkipped
+		run.EndedAt = &endedAt
+		run.Error = reason
+		if err := a.runStore.Update(run); err != nil {
+			logging.Logger.Error("error updating run", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err}, zapcore.Field{Key: "run", Type: zapcore.StringType, String: run.ID})
+		}
+	}
+}
+
+// withPushLock runs fn holding the configuration's push lock, so webhooks merging pushes into
+// the pending runs at the same time do not both queue one.
+func (a *App) withPushLock(ctx context.Context, id int, fn func() error) error {
+	key := fmt.Sprintf("push:%d", id)
+	holder := uuid.NewString()
+
+	for {
+		err := a.locks.Acquire(ctx, key, holder, pushLockTTL)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, lease.ErrHeld) {
+			return fmt.Errorf("error locking pushes: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pushLockPoll):
+		}
+	}
+
+	defer func() {
+		if err := a.locks.Release(context.Background(), key, holder); err != nil {
+			logging.Logger.Error(fmt.Sprintf("error unlocking pushes of repository configuration: %d", id), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+		}
+	}()
+
+	return fn()
+}
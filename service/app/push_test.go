@@ -0,0 +1,277 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v56/github"
+
+	"github.com/TonyDMorris/quick-function/pkg/lease"
+	"github.com/TonyDMorris/quick-function/pkg/queue"
+	runModels "github.com/TonyDMorris/quick-function/pkg/runs/models"
+	runStore "github.com/TonyDMorris/quick-function/pkg/runs/store"
+	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+)
+
+// pushConfiguration is a push triggered configuration of the fake GitHub's repository.
+func pushConfiguration(quietMinutes int, commitThreshold int) strapiModels.RepositoryConfiguration {
+	configuration := testRepositoryConfiguration(1)
+	configuration.Trigger = strapiModels.TriggerPush
+	configuration.PushQuietMinutes = quietMinutes
+	configuration.PushCommitThreshold = commitThreshold
+	return configuration
+}
+
+// queuedPushes returns the queued jobs and their runs, oldest first.
+func queuedPushes(t *testing.T, a *App) ([]queue.Job, []*runModels.Run) {
+	t.Helper()
+
+	jobs, err := a.jobQueue.List(queue.StatusQueued)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var runs []*runModels.Run
+	for _, job := range jobs {
+		var queuedJob QueuedJob
+		if err := json.Unmarshal(job.Payload, &queuedJob); err != nil {
+			t.Fatal(err)
+		}
+		run, err := a.runStore.Get(queuedJob.RunID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs = append(runs, run)
+	}
+
+	return jobs, runs
+}
+
+func TestEnqueuePushMergesPendingPushes(t *testing.T) {
+	configuration := pushConfiguration(10, 0)
+	a, _ := newTestApp(t, &fakeGitHub{}, newFakeStrapi(configuration))
+
+	if err := a.enqueuePush(context.Background(), configuration, "a", "b", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.enqueuePush(context.Background(), configuration, "b", "c", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, runs := queuedPushes(t, a)
+	if len(runs) != 2 {
+		t.Fatalf("queued jobs = %d, want 2", len(runs))
+	}
+
+	// the first push is merged into the second, which covers both
+	if runs[0].Status != runModels.RunStatusSkipped || !strings.Contains(runs[0].Error, runs[1].ID) {
+		t.Errorf("first run = %+v, want it skipped and merged into %s", runs[0], runs[1].ID)
+	}
+	if runs[1].Status != runModels.RunStatusQueued || runs[1].CommitFrom != "a" || runs[1].CommitTo != "c" || runs[1].Commits != 3 {
+		t.Errorf("second run = %+v, want a queued run over a...c with 3 commits", runs[1])
+	}
+
+	// the run waits for the quiet period from the latest push
+	if wait := time.Until(jobs[1].VisibleAt); wait < 9*time.Minute || wait > 10*time.Minute {
+		t.Errorf("job visible in %s, want the quiet period of 10m", wait)
+	}
+
+	// the worker drops the merged run without generating
+	var queuedJob QueuedJob
+	if err := json.Unmarshal(jobs[0].Payload, &queuedJob); err != nil {
+		t.Fatal(err)
+	}
+	handler := func(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) error {
+		t.Errorf("handler called for run %s, want the merged run dropped", run.ID)
+		return nil
+	}
+	if _, err := a.runJob(context.Background(), queuedJob, handler); err != nil {
+		t.Errorf("runJob() error = %v", err)
+	}
+}
+
+func TestRunJobDropsPushesMergedWhileStarting(t *testing.T) {
+	configuration := pushConfiguration(10, 0)
+	a, _ := newTestApp(t, &fakeGitHub{}, newFakeStrapi(configuration))
+
+	if err := a.enqueuePush(context.Background(), configuration, "a", "b", 1); err != nil {
+		t.Fatal(err)
+	}
+	jobs, _ := queuedPushes(t, a)
+	var queuedJob QueuedJob
+	if err := json.Unmarshal(jobs[0].Payload, &queuedJob); err != nil {
+		t.Fatal(err)
+	}
+
+	// a webhook is merging a push while the worker picks up the run
+	key := fmt.Sprintf("push:%d", configuration.ID)
+	if err := a.locks.Acquire(context.Background(), key, "webhook", pushLockTTL); err != nil {
+		t.Fatal(err)
+	}
+
+	handled := make(chan struct{}, 1)
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.runJob(context.Background(), queuedJob, func(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) error {
+			handled <- struct{}{}
+			return nil
+		})
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if run, err := a.runStore.Get(queuedJob.RunID); err != nil || run.Status != runModels.RunStatusQueued {
+		t.Fatalf("run = %+v, %v, want it queued until the push lock is released", run, err)
+	}
+
+	pending, err := a.pendingPushes(configuration.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.skipRuns(pending, "merged into a later run")
+	if err := a.locks.Release(context.Background(), key, "webhook"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("runJob() error = %v", err)
+	}
+	select {
+	case <-handled:
+		t.Error("handler called, want the merged run dropped")
+	default:
+	}
+	if run, err := a.runStore.Get(queuedJob.RunID); err != nil || run.Status != runModels.RunStatusSkipped || run.Attempts != 0 {
+		t.Errorf("run = %+v, %v, want it left skipped", run, err)
+	}
+}
+
+func TestEnqueuePushCommitThreshold(t *testing.T) {
+	configuration := pushConfiguration(10, 5)
+	a, _ := newTestApp(t, &fakeGitHub{}, newFakeStrapi(configuration))
+
+	if err := a.enqueuePush(context.Background(), configuration, "a", "b", 2); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, _ := queuedPushes(t, a); time.Until(jobs[0].VisibleAt) < 9*time.Minute {
+		t.Errorf("job visible at %s, want it waiting for the quiet period", jobs[0].VisibleAt)
+	}
+
+	if err := a.enqueuePush(context.Background(), configuration, "b", "c", 3); err != nil {
+		t.Fatal(err)
+	}
+	jobs, runs := queuedPushes(t, a)
+	if time.Until(jobs[1].VisibleAt) > 0 || runs[1].CommitFrom != "a" || runs[1].CommitTo != "c" {
+		t.Errorf("run = %+v visible at %s, want a...c visible now", runs[1], jobs[1].VisibleAt)
+	}
+}
+
+func TestEnqueuePushNewBranch(t *testing.T) {
+	configuration := pushConfiguration(10, 0)
+	a, _ := newTestApp(t, &fakeGitHub{}, newFakeStrapi(configuration))
+
+	if err := a.enqueuePush(context.Background(), configuration, zeroSHA, "b", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.enqueuePush(context.Background(), configuration, "b", "c", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new branch diffs from the last generation
+	if _, runs := queuedPushes(t, a); runs[1].CommitFrom != "" || runs[1].CommitTo != "c" {
+		t.Errorf("run = %+v, want it from the last generation to c", runs[1])
+	}
+}
+
+func TestEnqueuePushAcrossARestart(t *testing.T) {
+	configuration := pushConfiguration(10, 0)
+	runsPath := filepath.Join(t.TempDir(), "runs.json")
+	queuePath := filepath.Join(t.TempDir(), "queue.json")
+
+	// each start reads the pending runs back from the run store and queue files
+	start := func() *App {
+		runs, err := runStore.NewFileStore(runsPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs, err := queue.NewFileQueue(queuePath, queue.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewApi(Config{}, github.NewClient(nil), nil, nil, runs, jobs, lease.NewMemoryLocker())
+	}
+
+	if err := start().enqueuePush(context.Background(), configuration, "a", "b", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := start()
+	if err := restarted.enqueuePush(context.Background(), configuration, "b", "c", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := restarted.pendingPushes(configuration.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].CommitFrom != "a" || pending[0].CommitTo != "c" {
+		t.Errorf("pending runs = %+v, want one over a...c", pending)
+	}
+}
+
+func TestCancelPendingPushes(t *testing.T) {
+	configuration := pushConfiguration(10, 0)
+	a, _ := newTestApp(t, &fakeGitHub{}, newFakeStrapi(configuration))
+
+	if err := a.enqueuePush(context.Background(), configuration, "a", "b", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.cancelPendingPushes(context.Background(), configuration.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, runs := queuedPushes(t, a); runs[0].Status != runModels.RunStatusSkipped {
+		t.Errorf("run = %+v, want it skipped", runs[0])
+	}
+
+	// the next push starts a new range
+	if err := a.enqueuePush(context.Background(), configuration, "b", "c", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, runs := queuedPushes(t, a); runs[1].CommitFrom != "b" || runs[1].CommitTo != "c" {
+		t.Errorf("run = %+v, want b...c", runs[1])
+	}
+}
+
+func TestPushTouchesPaths(t *testing.T) {
+	commits := []*github.HeadCommit{
+		{Added: []string{"web/app.ts"}},
+		{Modified: []string{"README.md"}, Removed: []string{"services/api/old.go"}},
+	}
+
+	tests := []struct {
+		name  string
+		event *github.PushEvent
+		paths []string
+		want  bool
+	}{
+		{name: "no paths", event: &github.PushEvent{Size: github.Int(2), Commits: commits}, want: true},
+		{name: "removed file", event: &github.PushEvent{Size: github.Int(2), Commits: commits}, paths: []string{"services/api"}, want: true},
+		{name: "glob", event: &github.PushEvent{Size: github.Int(2), Commits: commits}, paths: []string{"web/**/*.ts"}, want: true},
+		{name: "other paths", event: &github.PushEvent{Size: github.Int(2), Commits: commits}, paths: []string{"services/worker"}, want: false},
+		{name: "truncated payload", event: &github.PushEvent{Size: github.Int(25), Commits: commits}, paths: []string{"services/worker"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pushTouchesPaths(tt.event, tt.paths); got != tt.want {
+				t.Errorf("pushTouchesPaths() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
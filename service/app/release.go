@@ -0,0 +1,367 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TonyDMorris/quick-function/constants"
+	tokenService "github.com/TonyDMorris/quick-function/pkg/github_token_service/client"
+	gptModels "github.com/TonyDMorris/quick-function/pkg/gpt/models"
+	"github.com/TonyDMorris/quick-function/pkg/logging"
+	runModels "github.com/TonyDMorris/quick-function/pkg/runs/models"
+	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+	"github.com/TonyDMorris/quick-function/pkg/tokens"
+	"github.com/google/go-github/v56/github"
+)
+
+// maxReleaseCommits caps the commits listed for a first release.
+const maxReleaseCommits = 100
+
+// handleReleaseEvent queues release notes for configurations writing them to the GitHub release.
+func (a *App) handleReleaseEvent(ctx context.Context, event *github.ReleaseEvent) error {
+	if event.GetAction() != "published" {
+		return nil
+	}
+
+	return a.enqueueReleaseNotes(ctx, event.GetRepo().GetID(), event.GetRelease().GetTagName(), strapiModels.ReleaseNotesRelease)
+}
+
+// handleCreateEvent queues release notes for configurations posting them when a tag is created.
+// Publishing a release creates its tag too, so each mode listens to one of the events.
+func (a *App) handleCreateEvent(ctx context.Context, event *github.CreateEvent) error {
+	if event.GetRefType() != "tag" {
+		return nil
+	}
+
+	return a.enqueueReleaseNotes(ctx, event.GetRepo().GetID(), event.GetRef(), strapiModels.ReleaseNotesPost)
+}
+
+func (a *App) enqueueReleaseNotes(ctx context.Context, repositoryID int64, tag string, releaseNotes string) error {
+	repositoryConfigurations, err := a.repositoryConfigurationsForRepository(ctx, repositoryID)
+	if err != nil {
+		return err
+	}
+
+	for _, repositoryConfiguration := range repositoryConfigurations {
+		if repositoryConfiguration.ReleaseNotes != releaseNotes {
+			continue
+		}
+
+		fullRepositoryConfiguration, err := a.strapiClient.GetRepositoryConfiguration(ctx, repositoryConfiguration.ID)
+		if err != nil {
+			return fmt.Errorf("error getting repository configuration: %w", err)
+		}
+
+		run, err := a.enqueueRun(runModels.Run{
+			Type:    runModels.RunTypeRelease,
+			Trigger: runModels.RunTriggerWebhook,
+			Tag:     tag,
+		}, *fullRepositoryConfiguration)
+		if err != nil {
+			return fmt.Errorf("error enqueueing release notes: %w", err)
+		}
+
+		logging.Logger.Info(fmt.Sprintf("queued release notes for %s, run %s, for job ID : %d", tag, run.ID, repositoryConfiguration.ID))
+	}
+
+	return nil
+}
+
+// repositoryConfigurationsForRepository returns the configurations of the GitHub repository with the ID.
+func (a *App) repositoryConfigurationsForRepository(ctx context.Context, repositoryID int64) ([]strapiModels.RepositoryConfiguration, error) {
+	repositoryConfigurations, err := a.strapiClient.GetRepositoryConfigurations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting repository configurations: %w", err)
+	}
+
+	id := strconv.FormatInt(repositoryID, 10)
+
+	var matching []strapiModels.RepositoryConfiguration
+	for _, repositoryConfiguration := range repositoryConfigurations {
+		if repositoryConfiguration.Repository != nil && repositoryConfiguration.Repository.RepositoryID == id {
+			matching = append(matching, repositoryConfiguration)
+		}
+	}
+
+	return matching, nil
+}
+
+// HandleReleaseJob writes release notes for run.Tag covering the commits and merged pull requests
+// since the previous tag, then posts them or sets them as the GitHub release body.
+func (a *App) HandleReleaseJob(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) error {
+	if run.Tag == "" {
+		return fmt.Errorf("release run has no tag")
+	}
+
+	logging.Logger.Info(fmt.Sprintf("handling release job for repository configuration: %d, with tag: %s", job.ID, run.Tag))
+
+	installation := job.Installation
+	repo := job.Repository
+
+	if installation == nil || repo == nil {
+		return ErrNoInstallation
+	}
+
+	permissions := readPermissions
+	if job.ReleaseNotes == strapiModels.ReleaseNotesRelease {
+		// editing the release body needs write access to the contents
+		permissions = &github.InstallationPermissions{
+			Contents:     github.String("write"),
+			Metadata:     github.String("read"),
+			PullRequests: github.String("read"),
+		}
+	}
+
+	userClient, err := a.getUserClientFromInstallation(installation.InstallationID, repo.Name, permissions)
+	if err != nil {
+		return fmt.Errorf("error getting user client from installation: %w", err)
+	}
+
+	if job.ReleaseNotes == strapiModels.ReleaseNotesRelease {
+		if err := a.requireContentsWrite(ctx, installation.InstallationID, repo.Name, permissions); err != nil {
+			return err
+		}
+	}
+
+	tagNames, err := listTagNames(ctx, userClient, installation.Username, repo.Name)
+	if err != nil {
+		return fmt.Errorf("error listing tags: %w", err)
+	}
+
+	previous := previousTag(tagNames, run.Tag)
+
+	var commits []*github.RepositoryCommit
+	if previous == "" {
+		// the first release covers the history up to its tag
+		commits, _, err = userClient.Repositories.ListCommits(ctx, installation.Username, repo.Name, &github.CommitsListOptions{
+			SHA:         run.Tag,
+			ListOptions: github.ListOptions{PerPage: maxReleaseCommits},
+		})
+		if err != nil {
+			return fmt.Errorf("error getting commits: %w", err)
+		}
+		// commits are listed newest first
+		for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+			commits[i], commits[j] = commits[j], commits[i]
+		}
+	} else {
+		diff, _, err := userClient.Repositories.CompareCommits(ctx, installation.Username, repo.Name, previous, run.Tag, nil)
+		if err != nil {
+			return fmt.Errorf("error getting diff: %w", err)
+		}
+		commits = diff.Commits
+	}
+
+	if len(commits) == 0 {
+		logging.Logger.Info(fmt.Sprintf("no commits found from %s to %s, for job ID : %d", previous, run.Tag, job.ID))
+		run.Status = runModels.RunStatusSkipped
+		return nil
+	}
+
+	run.CommitFrom = previous
+	run.CommitTo = commits[len(commits)-1].GetSHA()
+
+	var commitMessages []string
+	for _, commit := range commits {
+		commitMessages = append(commitMessages, commit.GetCommit().GetMessage())
+	}
+
+	pullRequests := a.mergedPullRequests(ctx, userClient, installation.Username, repo.Name, commits)
+
+	// pull requests describe the release better than commits, commits get what they leave
+	tokenBudget := a.contentBudget(job)
+
+	pullRequestText, pullRequestTokens, err := a.pullRequestDigest(pullRequests, tokenBudget/2)
+	if err != nil {
+		return fmt.Errorf("error trimming pull requests: %w", err)
+	}
+
+	commitText, err := tokens.Truncate(strings.Join(commitMessages, "\n"), tokenBudget-pullRequestTokens)
+	if err != nil {
+		return fmt.Errorf("error trimming commit messages: %w", err)
+	}
+
+	previousName := previous
+	if previousName == "" {
+		previousName = "none, this is the first release"
+	}
+
+	releaseNotesPrompts := []gptModels.Message{
+		{
+			Role:    gptModels.RoleSystem,
+			Content: fmt.Sprintf(constants.ReleaseNotesMessage, repo.Name, run.Tag, previousName, pullRequestText, commitText),
+		},
+	}
+
+	resp, err := a.chatGptClient.Chat(ctx, releaseNotesPrompts, completionOptions(job))
+	if err != nil {
+		return fmt.Errorf("error chatting with gpt: %w", err)
+	}
+
+	run.TokensUsed += resp.Usage.TotalTokens
+
+	var content string
+
+	for _, choice := range resp.Choices {
+		content = choice.Message.Content
+	}
+
+	if job.ReleaseNotes == strapiModels.ReleaseNotesRelease {
+		release, _, err := userClient.Repositories.GetReleaseByTag(ctx, installation.Username, repo.Name, run.Tag)
+		if err != nil {
+			return fmt.Errorf("error getting release: %w", err)
+		}
+
+		_, _, err = userClient.Repositories.EditRelease(ctx, installation.Username, repo.Name, release.GetID(), &github.RepositoryRelease{
+			Body: github.String(content),
+		})
+		if err != nil {
+			return fmt.Errorf("error updating release: %w", err)
+		}
+
+		return nil
+	}
+
+	commitFrom := commits[0].GetCommit().GetCommitter().GetDate().Time
+	commitTo := commits[len(commits)-1].GetCommit().GetCommitter().GetDate().Time
+
+	gitBlogPost := strapiModels.GitBlogPost{
+		Title:         fmt.Sprintf("%s %s", repo.Name, run.Tag),
+		Description:   fmt.Sprintf("Release notes for %s %s", repo.Name, run.Tag),
+		Body:          content,
+		CommitFrom:    &commitFrom,
+		CommitTo:      &commitTo,
+		Repository:    fmt.Sprint(repo.ID),
+		OwnerUsername: installation.Username,
+	}
+
+	createdGitBlogPost, err := a.strapiClient.StandardCreateGitBlogPost(ctx, gitBlogPost)
+	if err != nil {
+		return fmt.Errorf("error creating git blog post: %w", err)
+	}
+
+	run.GitBlogPostID = createdGitBlogPost.ID
+
+	return nil
+}
+
+// requireContentsWrite creates the write scoped token up front, GitHub refuses it with a 422 when
+// the app was installed without contents:write, which fails the run with ErrNoContentsWrite
+// instead of a generic client error. The token is cached for the client using it.
+func (a *App) requireContentsWrite(ctx context.Context, installationID string, repository string, permissions *github.InstallationPermissions) error {
+	instID, err := strconv.ParseInt(installationID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("error converting installation id to int: %w", err)
+	}
+
+	_, err = a.installationTokens.Token(ctx, instID, tokenService.Scope{
+		Repository:  repository,
+		Permissions: permissions,
+	})
+
+	var githubErr *github.ErrorResponse
+	if errors.As(err, &githubErr) && githubErr.Response != nil && githubErr.Response.StatusCode == http.StatusUnprocessableEntity {
+		return fmt.Errorf("%w: %s", ErrNoContentsWrite, githubErr.Message)
+	}
+	if err != nil {
+		return fmt.Errorf("error creating installation token: %w", err)
+	}
+
+	return nil
+}
+
+// previousTag returns the greatest tag lower than tag when the tags are versions, otherwise the
+// tag listed after it. It returns an empty string for the first release.
+func previousTag(tags []string, tag string) string {
+	current, ok := parseVersion(tag)
+	if !ok {
+		for i, name := range tags {
+			if name == tag && i+1 < len(tags) {
+				return tags[i+1]
+			}
+		}
+		return ""
+	}
+
+	var previous string
+	var previousVersion []int
+	for _, name := range tags {
+		version, ok := parseVersion(name)
+		if !ok || compareVersions(version, current) >= 0 {
+			continue
+		}
+		if previous == "" || compareVersions(version, previousVersion) > 0 {
+			previous = name
+			previousVersion = version
+		}
+	}
+
+	return previous
+}
+
+// parseVersion reads the numeric parts of a tag such as v1.2.3, anything after a - or + is ignored.
+func parseVersion(tag string) ([]int, bool) {
+	tag = strings.TrimPrefix(strings.TrimPrefix(tag, "v"), "V")
+	if i := strings.IndexAny(tag, "-+"); i >= 0 {
+		tag = tag[:i]
+	}
+	if tag == "" {
+		return nil, false
+	}
+
+	var version []int
+	for _, part := range strings.Split(tag, ".") {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		version = append(version, number)
+	}
+
+	return version, true
+}
+
+func compareVersions(a []int, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// listTagNames follows every page of the repository's tags, the previous release may be on any of them.
+func listTagNames(ctx context.Context, userClient *github.Client, owner string, repo string) ([]string, error) {
+	options := &github.ListOptions{PerPage: 100}
+
+	var tagNames []string
+	for {
+		tags, resp, err := userClient.Repositories.ListTags(ctx, owner, repo, options)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tag := range tags {
+			tagNames = append(tagNames, tag.GetName())
+		}
+
+		if resp.NextPage == 0 {
+			return tagNames, nil
+		}
+		options.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/TonyDMorris/quick-function/pkg/retry"
+	runModels "github.com/TonyDMorris/quick-function/pkg/runs/models"
+	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+	"github.com/google/go-github/v56/github"
+)
+
+func TestPreviousTag(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		tag  string
+		want string
+	}{
+		{name: "greatest lower version", tags: []string{"v1.10.0", "v1.9.0", "v1.2.0", "v2.0.0"}, tag: "v1.10.0", want: "v1.9.0"},
+		{name: "versions out of order", tags: []string{"v1.0.0", "v2.0.0", "v1.5.0", "v3.0.0"}, tag: "v2.0.0", want: "v1.5.0"},
+		{name: "pre-release suffix ignored", tags: []string{"v1.1.0-rc.1", "v1.0.0"}, tag: "v1.1.0-rc.1", want: "v1.0.0"},
+		{name: "missing patch part", tags: []string{"1.2", "1.1.9"}, tag: "1.2", want: "1.1.9"},
+		{name: "first release", tags: []string{"v1.0.0"}, tag: "v1.0.0", want: ""},
+		{name: "non version tags use the listed order", tags: []string{"beta", "alpha"}, tag: "beta", want: "alpha"},
+		{name: "last non version tag", tags: []string{"beta", "alpha"}, tag: "alpha", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := previousTag(tt.tags, tt.tag); got != tt.want {
+				t.Errorf("previousTag(%v, %q) = %q, want %q", tt.tags, tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListTagNamesFollowsEveryPage(t *testing.T) {
+	githubAPI := &fakeGitHub{}
+	for i := 250; i > 0; i-- {
+		githubAPI.tags = append(githubAPI.tags, &github.RepositoryTag{Name: github.String(fmt.Sprintf("v0.%d.0", i))})
+	}
+	a, _ := newTestApp(t, githubAPI, newFakeStrapi())
+
+	userClient, err := a.getUserClientFromInstallation("1", testRepo, readPermissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tagNames, err := listTagNames(context.Background(), userClient, testOwner, testRepo)
+	if err != nil {
+		t.Fatalf("listTagNames() error = %v", err)
+	}
+	if len(tagNames) != 250 {
+		t.Fatalf("tags = %d, want 250", len(tagNames))
+	}
+
+	// the tag before the oldest release is only on the last page
+	if previous := previousTag(tagNames, "v0.2.0"); previous != "v0.1.0" {
+		t.Errorf("previousTag() = %q, want v0.1.0", previous)
+	}
+}
+
+func TestHandleReleaseJobWithoutContentsWrite(t *testing.T) {
+	githubAPI := &fakeGitHub{readOnly: true}
+	configuration := testRepositoryConfiguration(1)
+	configuration.ReleaseNotes = strapiModels.ReleaseNotesRelease
+	strapiAPI := newFakeStrapi(configuration)
+	a, chatClient := newTestApp(t, githubAPI, strapiAPI)
+
+	err := a.HandleReleaseJob(context.Background(), configuration, &runModels.Run{Tag: "v1.0.0"})
+	if !errors.Is(err, ErrNoContentsWrite) {
+		t.Fatalf("HandleReleaseJob() error = %v, want %v", err, ErrNoContentsWrite)
+	}
+	if !retry.IsPermanent(classify(err)) {
+		t.Errorf("classify(%v) is retryable, want it permanent", err)
+	}
+	if len(chatClient.Requests()) != 0 || len(strapiAPI.Posts()) != 0 {
+		t.Error("release notes were generated without a token to write them")
+	}
+}
@@ -1,19 +1,154 @@
 package app
 
-func (a *App) Run() error {
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/logging"
+	"go.uber.org/zap/zapcore"
+)
+
+// Run serves the API and runs queued jobs until ctx is done, then shuts down gracefully.
+func (a *App) Run(ctx context.Context) error {
 	a.setupRoutes()
-	go a.startWorkerPool()
-	go a.cron.StartAsync()
-	err := a.loadSchedules()
-	if err != nil {
+
+	dequeueCtx, stopDequeueing := context.WithCancel(context.Background())
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+	a.startWorkerPool(dequeueCtx, jobsCtx)
+
+	// a replica elected leader reloads the schedules, webhooks may have changed them on
+	// another replica while it followed, and catches up on the generations missed meanwhile
+	a.leader.OnElected = func() { a.syncSchedules(true) }
+	stopLeading := a.keepLeading()
+
+	a.scheduler.Start()
+	if err := a.loadSchedules(ctx, false); err != nil {
+		a.scheduler.Stop()
+		stopLeading()
+		stopDequeueing()
 		return err
 	}
-	return a.server.Run()
+	stopSyncing := a.keepSyncingSchedules()
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", a.port),
+		Handler: a.server,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		stopSyncing()
+		a.scheduler.Stop()
+		stopLeading()
+		stopDequeueing()
+		return err
+	case <-ctx.Done():
+	}
+
+	stopSyncing()
+
+	return a.shutdown(server, stopLeading, stopDequeueing, cancelJobs)
+}
+
+// keepLeading renews the leader lease until the returned function is called, which releases it.
+func (a *App) keepLeading() func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.leader.Renew(ctx)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// keepSyncingSchedules reloads the schedules every schedule sync interval until the returned
+// function is called.
+func (a *App) keepSyncingSchedules() func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(a.scheduleSync)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				a.syncSchedules(false)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// shutdown stops accepting webhooks, stops the scheduler, hands the leader lease over and waits
+// for in-flight jobs until the shutdown timeout, after which they are cancelled and requeued for
+// the next start.
+func (a *App) shutdown(server *http.Server, stopLeading func(), stopDequeueing context.CancelFunc, cancelJobs context.CancelFunc) error {
+	logging.Logger.Info(fmt.Sprintf("shutting down, waiting up to %s for in-flight jobs", a.shutdownTimeout))
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		logging.Logger.Error("error shutting down server", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+	}
+
+	a.scheduler.Stop()
+	stopLeading()
+	stopDequeueing()
+
+	drained := make(chan struct{})
+	go func() {
+		a.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		logging.Logger.Warn("in-flight jobs did not finish before the shutdown timeout, cancelling them")
+		cancelJobs()
+		<-drained
+	}
+
+	logging.Logger.Info("shut down")
+
+	return nil
 }
 
 func (a *App) setupRoutes() {
 
 	a.server.POST("/repository-configuration", a.HandleStrapiWebhook)
+	a.server.POST("/github/webhook", a.HandleGitHubWebhook)
 	a.server.GET("/jobs", a.HandleGetJobs)
+	a.server.GET("/jobs/:id/runs", a.HandleGetJobRuns)
+	a.server.GET("/runs", a.HandleGetRuns)
+	a.server.GET("/runs/:id", a.HandleGetRun)
+	a.server.GET("/queue", a.HandleGetQueue)
+	a.server.GET("/dead-letters", a.HandleGetDeadLetters)
+	a.server.GET("/dead-letters/:id", a.HandleGetDeadLetter)
+	a.server.POST("/dead-letters/:id/requeue", a.HandleRequeueDeadLetter)
+	a.server.GET("/rate-limits", a.HandleGetRateLimits)
+	a.server.POST("/repository-configurations/:id/generate", a.HandleGenerate)
 
 }
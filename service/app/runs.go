@@ -0,0 +1,443 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/lease"
+	"github.com/TonyDMorris/quick-function/pkg/logging"
+	"github.com/TonyDMorris/quick-function/pkg/queue"
+	"github.com/TonyDMorris/quick-function/pkg/ratelimit"
+	runModels "github.com/TonyDMorris/quick-function/pkg/runs/models"
+	runStore "github.com/TonyDMorris/quick-function/pkg/runs/store"
+	strapi "github.com/TonyDMorris/quick-function/pkg/strapi/client"
+	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-github/v56/github"
+	"github.com/google/uuid"
+	"go.uber.org/zap/zapcore"
+)
+
+type jobHandler func(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) error
+
+// enqueueJob records a queued run and hands the repository configuration to the worker pool.
+func (a *App) enqueueJob(runType string, trigger string, repositoryConfiguration strapiModels.RepositoryConfiguration) (*runModels.Run, error) {
+	return a.enqueueRun(runModels.Run{Type: runType, Trigger: trigger}, repositoryConfiguration)
+}
+
+// enqueueRun is enqueueJob for a run carrying more than its type and trigger, such as the
+// commit range of a push or the tag of a release.
+func (a *App) enqueueRun(run runModels.Run, repositoryConfiguration strapiModels.RepositoryConfiguration) (*runModels.Run, error) {
+	return a.enqueueRunAt(run, repositoryConfiguration, time.Time{})
+}
+
+// enqueueRunAt is enqueueRun for a run that waits until the time at, the zero time runs it now.
+func (a *App) enqueueRunAt(run runModels.Run, repositoryConfiguration strapiModels.RepositoryConfiguration, at time.Time) (*runModels.Run, error) {
+	run.ID = uuid.NewString()
+	run.Status = runModels.RunStatusQueued
+	run.RepositoryConfigurationID = repositoryConfiguration.ID
+	run.QueuedAt = time.Now().UTC()
+
+	if err := a.runStore.Create(run); err != nil {
+		return nil, fmt.Errorf("error creating run: %w", err)
+	}
+
+	payload, err := json.Marshal(QueuedJob{
+		RunID:                   run.ID,
+		Type:                    run.Type,
+		RepositoryConfiguration: repositoryConfiguration,
+	})
+	if err == nil {
+		err = a.jobQueue.Enqueue(queueFor(run.Type), run.ID, payload, at)
+	}
+	if err != nil {
+		endedAt := time.Now().UTC()
+		run.Status = runModels.RunStatusFailed
+		run.EndedAt = &endedAt
+		run.Error = err.Error()
+		if err := a.runStore.Update(run); err != nil {
+			logging.Logger.Error("error updating run", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err}, zapcore.Field{Key: "run", Type: zapcore.StringType, String: run.ID})
+		}
+		return nil, fmt.Errorf("error enqueueing run: %w", err)
+	}
+
+	return &run, nil
+}
+
+// queueFor returns the queue that runs jobs of the run type, full generations are kept apart
+// so they do not hold up the incremental ones.
+func queueFor(runType string) string {
+	if runType == runModels.RunTypeCreated {
+		return queueCreated
+	}
+	return queueScheduled
+}
+
+// runJob executes the handler and records the outcome against the queued run. Jobs of an
+// installation that is out of GitHub rate limit return the time to requeue them at, when
+// the limit resets, as do jobs failing with a retryable error until the retry policy gives up.
+func (a *App) runJob(ctx context.Context, queuedJob QueuedJob, handler jobHandler) (time.Time, error) {
+	job := queuedJob.RepositoryConfiguration
+
+	if job.Installation != nil {
+		if until, paused := a.rateLimits.PausedUntil(job.Installation.InstallationID); paused {
+			logging.Logger.Info(fmt.Sprintf("installation %s is rate limited, requeueing run %s until %s", job.Installation.InstallationID, queuedJob.RunID, until.Format(time.RFC3339)))
+			return until, nil
+		}
+	}
+
+	run, err := a.runStore.Get(queuedJob.RunID)
+	if err != nil {
+		logging.Logger.Error("error getting run", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err}, zapcore.Field{Key: "run", Type: zapcore.StringType, String: queuedJob.RunID})
+		return time.Time{}, handler(ctx, job, &runModels.Run{ID: queuedJob.RunID})
+	}
+
+	// a push run merged into a later one, or cancelled, was skipped while it waited
+	if run.Status == runModels.RunStatusSkipped {
+		logging.Logger.Info(fmt.Sprintf("dropping run %s, it was skipped while queued: %s", run.ID, run.Error))
+		return time.Time{}, nil
+	}
+
+	lockKey, idempotent := runLockKey(job, *run)
+	if err := a.locks.Acquire(ctx, lockKey, run.ID, a.jobTimeout); err != nil {
+		if !errors.Is(err, lease.ErrHeld) {
+			logging.Logger.Error(fmt.Sprintf("error locking run %s, requeueing it", run.ID), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+			return time.Now().Add(time.Minute), nil
+		}
+
+		logging.Logger.Info(fmt.Sprintf("skipping run %s, another run holds %s", run.ID, lockKey))
+		endedAt := time.Now().UTC()
+		run.EndedAt = &endedAt
+		run.Status = runModels.RunStatusSkipped
+		run.Error = err.Error()
+		if err := a.runStore.Update(*run); err != nil {
+			logging.Logger.Error("error updating run", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err}, zapcore.Field{Key: "run", Type: zapcore.StringType, String: run.ID})
+		}
+		return time.Time{}, nil
+	}
+
+	started, err := a.startRun(ctx, job, run)
+	if err != nil || !started {
+		if err := a.locks.Release(context.Background(), lockKey, run.ID); err != nil {
+			logging.Logger.Error(fmt.Sprintf("error unlocking run %s", run.ID), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+		}
+		if err != nil {
+			logging.Logger.Error(fmt.Sprintf("error starting run %s, requeueing it", run.ID), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+			return time.Now().Add(time.Minute), nil
+		}
+
+		logging.Logger.Info(fmt.Sprintf("dropping run %s, it was skipped while queued: %s", run.ID, run.Error))
+		return time.Time{}, nil
+	}
+
+	jobErr := handler(ctx, job, run)
+
+	// a lock naming the commits or tag generated from is kept until it expires so duplicates
+	// of the run are skipped, others are released for the next run or a retry. A run that
+	// skipped generating, with no commits yet, releases it so a later manual generate runs.
+	if jobErr != nil || !idempotent || run.Status == runModels.RunStatusSkipped {
+		if err := a.locks.Release(context.Background(), lockKey, run.ID); err != nil {
+			logging.Logger.Error(fmt.Sprintf("error unlocking run %s", run.ID), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err})
+		}
+	}
+
+	until, rateLimited := rateLimitedUntil(jobErr)
+	// a job cancelled by a shutdown, rather than its own timeout, is run again on the next start
+	if jobErr != nil && errors.Is(ctx.Err(), context.Canceled) {
+		until, rateLimited = time.Now(), true
+	}
+
+	if rateLimited {
+		logging.Logger.Info(fmt.Sprintf("run %s was interrupted, requeueing until %s", run.ID, until.Format(time.RFC3339)))
+		// waiting out a rate limit or a restart is not a failed attempt
+		run.Attempts--
+		run.Status = runModels.RunStatusQueued
+		run.StartedAt = nil
+		run.Error = jobErr.Error()
+		if err := a.runStore.Update(*run); err != nil {
+			logging.Logger.Error("error updating run", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err}, zapcore.Field{Key: "run", Type: zapcore.StringType, String: run.ID})
+		}
+		return until, nil
+	}
+
+	if delay, ok := a.retryPolicy.Next(run.Attempts, classify(jobErr)); ok {
+		retryAt := time.Now().Add(delay)
+		logging.Logger.Info(fmt.Sprintf("run %s failed on attempt %d, retrying at %s", run.ID, run.Attempts, retryAt.Format(time.RFC3339)), zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: jobErr})
+		run.Status = runModels.RunStatusQueued
+		run.StartedAt = nil
+		run.Error = jobErr.Error()
+		if err := a.runStore.Update(*run); err != nil {
+			logging.Logger.Error("error updating run", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err}, zapcore.Field{Key: "run", Type: zapcore.StringType, String: run.ID})
+		}
+		return retryAt, nil
+	}
+
+	endedAt := time.Now().UTC()
+	run.EndedAt = &endedAt
+
+	switch {
+	case jobErr != nil:
+		run.Status = runModels.RunStatusFailed
+		run.Error = jobErr.Error()
+	case run.Status == runModels.RunStatusRunning:
+		run.Status = runModels.RunStatusSucceeded
+	}
+
+	if err := a.runStore.Update(*run); err != nil {
+		logging.Logger.Error("error updating run", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err}, zapcore.Field{Key: "run", Type: zapcore.StringType, String: run.ID})
+	}
+
+	return time.Time{}, jobErr
+}
+
+// startRun moves the run to running, reporting false when it was skipped instead. A push run is
+// re-read and moved holding the push lock, so a push merging it into a later run cannot skip it
+// after it started and have its range generated twice.
+func (a *App) startRun(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) (bool, error) {
+	start := func() {
+		startedAt := time.Now().UTC()
+		run.StartedAt = &startedAt
+		run.Status = runModels.RunStatusRunning
+		run.Attempts++
+
+		if err := a.runStore.Update(*run); err != nil {
+			logging.Logger.Error("error updating run", zapcore.Field{Key: "error", Type: zapcore.ErrorType, Interface: err}, zapcore.Field{Key: "run", Type: zapcore.StringType, String: run.ID})
+		}
+	}
+
+	if run.Trigger != runModels.RunTriggerPush {
+		start()
+		return true, nil
+	}
+
+	started := false
+	err := a.withPushLock(ctx, job.ID, func() error {
+		current, err := a.runStore.Get(run.ID)
+		if err != nil {
+			return fmt.Errorf("error getting run: %w", err)
+		}
+
+		*run = *current
+		if run.Status == runModels.RunStatusSkipped {
+			return nil
+		}
+
+		start()
+		started = true
+		return nil
+	})
+
+	return started, err
+}
+
+// runLockKey identifies what a run generates from, so runs of one configuration over the same
+// commit range, tag or last generation share a key and only one of them generates. It reports
+// whether the key names those commits, a run keyed only by its configuration and type may
+// generate again once the first has finished.
+func runLockKey(job strapiModels.RepositoryConfiguration, run runModels.Run) (string, bool) {
+	switch {
+	case run.Type == runModels.RunTypeRelease:
+		return fmt.Sprintf("run:%d:release:%s", job.ID, run.Tag), true
+	case run.CommitFrom != "" || run.CommitTo != "":
+		return fmt.Sprintf("run:%d:%s..%s", job.ID, run.CommitFrom, run.CommitTo), true
+	case run.Since != nil && run.Until != nil:
+		return fmt.Sprintf("run:%d:window:%d..%d", job.ID, run.Since.Unix(), run.Until.Unix()), true
+	case run.Type == runModels.RunTypeScheduled && job.LastGeneration != nil:
+		return fmt.Sprintf("run:%d:since:%d", job.ID, job.LastGeneration.Unix()), true
+	default:
+		return fmt.Sprintf("run:%d:%s", job.ID, run.Type), false
+	}
+}
+
+// rateLimitedUntil reports whether the error comes from a GitHub rate limit and when it resets.
+func rateLimitedUntil(err error) (time.Time, bool) {
+	var rateLimited *ratelimit.ErrRateLimited
+	if errors.As(err, &rateLimited) {
+		return rateLimited.Until, true
+	}
+
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return rateLimitErr.Rate.Reset.Time, true
+	}
+
+	var abuseRateLimitErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseRateLimitErr) {
+		if abuseRateLimitErr.RetryAfter != nil {
+			return time.Now().Add(*abuseRateLimitErr.RetryAfter), true
+		}
+		return time.Now().Add(time.Minute), true
+	}
+
+	return time.Time{}, false
+}
+
+// HandleGetQueue lists the queued jobs, optionally narrowed to a status.
+func (a *App) HandleGetQueue(c *gin.Context) {
+	jobs, err := a.jobQueue.List(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// HandleGetRateLimits returns the last known GitHub rate limit budget of each installation.
+func (a *App) HandleGetRateLimits(c *gin.Context) {
+	c.JSON(http.StatusOK, a.rateLimits.Budgets())
+}
+
+// HandleGenerate queues a generation for a repository configuration, mode is "incremental" (default) or "full".
+func (a *App) HandleGenerate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid repository configuration id: %s", c.Param("id")),
+		})
+		return
+	}
+
+	var runType string
+	switch mode := c.DefaultQuery("mode", "incremental"); mode {
+	case "incremental":
+		runType = runModels.RunTypeScheduled
+	case "full":
+		runType = runModels.RunTypeCreated
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid mode: %s, expected full or incremental", mode),
+		})
+		return
+	}
+
+	repositoryConfiguration, err := a.strapiClient.GetRepositoryConfiguration(c.Request.Context(), id)
+	var statusErr *strapi.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("repository configuration not found: %d", id),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": fmt.Sprintf("error getting repository configuration: %s", err.Error()),
+		})
+		return
+	}
+
+	run, err := a.enqueueJob(runType, runModels.RunTriggerManual, *repositoryConfiguration)
+	if errors.Is(err, queue.ErrFull) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"run_id": run.ID,
+		"status": run.Status,
+		"url":    fmt.Sprintf("/runs/%s", run.ID),
+	})
+}
+
+func (a *App) HandleGetRuns(c *gin.Context) {
+	filter, err := runFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	a.listRuns(c, filter)
+}
+
+func (a *App) HandleGetJobRuns(c *gin.Context) {
+	filter, err := runFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid repository configuration id: %s", c.Param("id")),
+		})
+		return
+	}
+	filter.RepositoryConfigurationID = id
+
+	a.listRuns(c, filter)
+}
+
+func (a *App) HandleGetRun(c *gin.Context) {
+	run, err := a.runStore.Get(c.Param("id"))
+	if errors.Is(err, runStore.ErrRunNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
+
+func (a *App) listRuns(c *gin.Context, filter runModels.RunFilter) {
+	runs, err := a.runStore.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
+
+func runFilterFromQuery(c *gin.Context) (runModels.RunFilter, error) {
+	filter := runModels.RunFilter{
+		Status: c.Query("status"),
+		Limit:  100,
+	}
+
+	if id := c.Query("repository_configuration_id"); id != "" {
+		repositoryConfigurationID, err := strconv.Atoi(id)
+		if err != nil {
+			return filter, fmt.Errorf("invalid repository_configuration_id: %s", id)
+		}
+		filter.RepositoryConfigurationID = repositoryConfigurationID
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 {
+			return filter, fmt.Errorf("invalid limit: %s", limit)
+		}
+		filter.Limit = l
+	}
+
+	return filter, nil
+}
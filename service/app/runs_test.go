@@ -0,0 +1,389 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/lease"
+	"github.com/TonyDMorris/quick-function/pkg/queue"
+	"github.com/TonyDMorris/quick-function/pkg/ratelimit"
+	runModels "github.com/TonyDMorris/quick-function/pkg/runs/models"
+	runStore "github.com/TonyDMorris/quick-function/pkg/runs/store"
+	strapi "github.com/TonyDMorris/quick-function/pkg/strapi/client"
+	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-github/v56/github"
+)
+
+func TestHandleGenerate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	strapiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/internal/repository-configurations/1":
+			json.NewEncoder(w).Encode(strapiModels.RepositoryConfiguration{ID: 1, Cron: "1 days"})
+		case "/api/internal/repository-configurations/2":
+			// the CMS answered for a missing configuration with a 200
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "Repository configuration not found"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer strapiServer.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		runType  string
+		queuedOn string
+	}{
+		{name: "incremental by default", path: "/repository-configurations/1/generate", status: http.StatusAccepted, runType: runModels.RunTypeScheduled, queuedOn: queueScheduled},
+		{name: "full", path: "/repository-configurations/1/generate?mode=full", status: http.StatusAccepted, runType: runModels.RunTypeCreated, queuedOn: queueCreated},
+		{name: "invalid id", path: "/repository-configurations/one/generate", status: http.StatusBadRequest},
+		{name: "invalid mode", path: "/repository-configurations/1/generate?mode=partial", status: http.StatusBadRequest},
+		{name: "missing configuration", path: "/repository-configurations/2/generate", status: http.StatusNotFound},
+		{name: "missing configuration answered with a 404", path: "/repository-configurations/3/generate", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, err := runStore.NewFileStore("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := NewApi(Config{}, github.NewClient(nil), nil, strapi.NewClient("test", strapiServer.URL), runs, queue.NewMemoryQueue(queue.Options{}), lease.NewMemoryLocker())
+			a.setupRoutes()
+
+			recorder := httptest.NewRecorder()
+			a.server.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, tt.path, nil))
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body.String())
+			}
+			if tt.status != http.StatusAccepted {
+				return
+			}
+
+			var body struct {
+				RunID string `json:"run_id"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+
+			run, err := runs.Get(body.RunID)
+			if err != nil {
+				t.Fatalf("run %s was not recorded: %v", body.RunID, err)
+			}
+			if run.Type != tt.runType || run.Trigger != runModels.RunTriggerManual || run.Status != runModels.RunStatusQueued {
+				t.Errorf("run = %+v, want a queued manual %s run", run, tt.runType)
+			}
+
+			job, err := a.jobQueue.Get(run.ID)
+			if err != nil {
+				t.Fatalf("no job was queued for the workers: %v", err)
+			}
+			if job.Queue != tt.queuedOn || job.Status != queue.StatusQueued {
+				t.Errorf("job = %+v, want a queued job on %s", job, tt.queuedOn)
+			}
+
+			var queuedJob QueuedJob
+			if err := json.Unmarshal(job.Payload, &queuedJob); err != nil {
+				t.Fatal(err)
+			}
+			if queuedJob.RunID != run.ID || queuedJob.Type != tt.runType || queuedJob.RepositoryConfiguration.ID != 1 {
+				t.Errorf("queued job = %+v, want run %s of configuration 1", queuedJob, run.ID)
+			}
+		})
+	}
+}
+
+func TestHandleGenerateQueueFull(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	strapiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(strapiModels.RepositoryConfiguration{ID: 1, Cron: "1 days"})
+	}))
+	defer strapiServer.Close()
+
+	runs, err := runStore.NewFileStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := queue.NewMemoryQueue(queue.Options{Capacity: 1})
+	a := NewApi(Config{}, github.NewClient(nil), nil, strapi.NewClient("test", strapiServer.URL), runs, jobs, lease.NewMemoryLocker())
+	a.setupRoutes()
+
+	statuses := []int{http.StatusAccepted, http.StatusServiceUnavailable}
+	for _, want := range statuses {
+		recorder := httptest.NewRecorder()
+		a.server.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/repository-configurations/1/generate", nil))
+		if recorder.Code != want {
+			t.Fatalf("status = %d, want %d: %s", recorder.Code, want, recorder.Body.String())
+		}
+	}
+
+	// the run that could not be queued is recorded as failed
+	failed, err := runs.List(runModels.RunFilter{Status: runModels.RunStatusFailed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].Error == "" {
+		t.Errorf("failed runs = %+v, want the rejected run", failed)
+	}
+
+	recorder := httptest.NewRecorder()
+	a.server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/queue?status=queued", nil))
+	var queued []queue.Job
+	if err := json.Unmarshal(recorder.Body.Bytes(), &queued); err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 1 {
+		t.Errorf("queued jobs = %d, want 1", len(queued))
+	}
+}
+
+func TestRateLimitedUntil(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	retryAfter := 30 * time.Second
+
+	tests := []struct {
+		name   string
+		err    error
+		want   time.Time
+		wantOK bool
+	}{
+		{name: "limiter pause", err: fmt.Errorf("error getting tree: %w", &ratelimit.ErrRateLimited{Key: "1", Until: reset}), want: reset, wantOK: true},
+		{name: "exhausted budget", err: &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: reset}}}, want: reset, wantOK: true},
+		{name: "secondary rate limit", err: &github.AbuseRateLimitError{RetryAfter: &retryAfter}, want: time.Now().Add(retryAfter), wantOK: true},
+		{name: "other error", err: errors.New("not found")},
+		{name: "no error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := rateLimitedUntil(tt.err)
+			if ok != tt.wantOK || got.Sub(tt.want).Abs() > time.Second {
+				t.Errorf("rateLimitedUntil() = %s, %t, want %s, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRunJobRequeuesCancelledJobs(t *testing.T) {
+	a, runs, _ := newDeadLetterTestApp(t, 1)
+
+	run, err := a.enqueueJob(runModels.RunTypeScheduled, runModels.RunTriggerManual, strapiModels.RepositoryConfiguration{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a shutdown cancels the job, it is requeued without using up an attempt
+	ctx, cancel := context.WithCancel(context.Background())
+	requeueAt, err := a.runJob(ctx, QueuedJob{RunID: run.ID, Type: run.Type}, func(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) error {
+		cancel()
+		return fmt.Errorf("error chatting: %w", ctx.Err())
+	})
+	if err != nil || requeueAt.IsZero() || time.Until(requeueAt) > time.Second {
+		t.Fatalf("runJob() = %s, %v, want the job requeued now", requeueAt, err)
+	}
+
+	got, err := runs.Get(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != runModels.RunStatusQueued || got.Attempts != 0 {
+		t.Errorf("run = %+v, want it queued without an attempt", got)
+	}
+
+	// a job running past its own timeout fails like any other error
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	requeueAt, err = a.runJob(ctx, QueuedJob{RunID: run.ID, Type: run.Type}, func(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) error {
+		<-ctx.Done()
+		return fmt.Errorf("error chatting: %w", ctx.Err())
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || !requeueAt.IsZero() {
+		t.Fatalf("runJob() = %s, %v, want %v", requeueAt, err, context.DeadlineExceeded)
+	}
+
+	got, err = runs.Get(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != runModels.RunStatusFailed {
+		t.Errorf("run = %+v, want it failed", got)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	a, _, _ := newDeadLetterTestApp(t, 1)
+	a.shutdownTimeout = 50 * time.Millisecond
+
+	dequeueCtx, stopDequeueing := context.WithCancel(context.Background())
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+	a.startWorkerPool(dequeueCtx, jobsCtx)
+
+	// an in-flight job that only stops when it is cancelled
+	cancelled := make(chan struct{})
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		<-jobsCtx.Done()
+		close(cancelled)
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- a.shutdown(&http.Server{}, func() {}, stopDequeueing, cancelJobs)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("shutdown() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("shutdown() did not return after the shutdown timeout")
+	}
+
+	select {
+	case <-cancelled:
+	default:
+		t.Error("the in-flight job was not cancelled")
+	}
+	if dequeueCtx.Err() == nil {
+		t.Error("the workers are still dequeueing")
+	}
+}
+
+func TestRunLockKey(t *testing.T) {
+	lastGeneration := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	windowEnd := lastGeneration.AddDate(0, 0, 1)
+	configuration := strapiModels.RepositoryConfiguration{ID: 7, LastGeneration: &lastGeneration}
+
+	tests := []struct {
+		name           string
+		job            strapiModels.RepositoryConfiguration
+		run            runModels.Run
+		wantKey        string
+		wantIdempotent bool
+	}{
+		{name: "release", job: configuration, run: runModels.Run{Type: runModels.RunTypeRelease, Tag: "v1.2.0"}, wantKey: "run:7:release:v1.2.0", wantIdempotent: true},
+		{name: "push range", job: configuration, run: runModels.Run{Type: runModels.RunTypeScheduled, CommitFrom: "a", CommitTo: "b"}, wantKey: "run:7:a..b", wantIdempotent: true},
+		{name: "catch-up window", job: configuration, run: runModels.Run{Type: runModels.RunTypeScheduled, Since: &lastGeneration, Until: &windowEnd}, wantKey: fmt.Sprintf("run:7:window:%d..%d", lastGeneration.Unix(), windowEnd.Unix()), wantIdempotent: true},
+		{name: "since last generation", job: configuration, run: runModels.Run{Type: runModels.RunTypeScheduled}, wantKey: fmt.Sprintf("run:7:since:%d", lastGeneration.Unix()), wantIdempotent: true},
+		{name: "first scheduled run", job: strapiModels.RepositoryConfiguration{ID: 7}, run: runModels.Run{Type: runModels.RunTypeScheduled}, wantKey: "run:7:scheduled"},
+		{name: "full", job: configuration, run: runModels.Run{Type: runModels.RunTypeCreated}, wantKey: "run:7:created"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, idempotent := runLockKey(tt.job, tt.run)
+			if key != tt.wantKey || idempotent != tt.wantIdempotent {
+				t.Errorf("runLockKey() = %s, %t, want %s, %t", key, idempotent, tt.wantKey, tt.wantIdempotent)
+			}
+		})
+	}
+}
+
+func TestRunJobSkipsLockedRuns(t *testing.T) {
+	a, runs, _ := newDeadLetterTestApp(t, 1)
+
+	lastGeneration := time.Now().Add(-time.Hour).UTC()
+	configuration := strapiModels.RepositoryConfiguration{ID: 1, LastGeneration: &lastGeneration}
+
+	succeeding := func(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) error {
+		return nil
+	}
+
+	// two runs over the same range, such as a webhook and a schedule firing together
+	var ids []string
+	for i := 0; i < 2; i++ {
+		run, err := a.enqueueJob(runModels.RunTypeScheduled, runModels.RunTriggerSchedule, configuration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, run.ID)
+
+		if _, err := a.runJob(context.Background(), QueuedJob{RunID: run.ID, Type: run.Type, RepositoryConfiguration: configuration}, succeeding); err != nil {
+			t.Fatalf("runJob() error = %v", err)
+		}
+	}
+
+	for i, want := range []string{runModels.RunStatusSucceeded, runModels.RunStatusSkipped} {
+		run, err := runs.Get(ids[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.Status != want {
+			t.Errorf("run %d status = %s, want %s", i, run.Status, want)
+		}
+	}
+
+	// a run keyed only by its type releases the lock when it finishes
+	for i := 0; i < 2; i++ {
+		run, err := a.enqueueJob(runModels.RunTypeCreated, runModels.RunTriggerManual, configuration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.runJob(context.Background(), QueuedJob{RunID: run.ID, Type: run.Type, RepositoryConfiguration: configuration}, succeeding); err != nil {
+			t.Fatalf("runJob() error = %v", err)
+		}
+
+		got, err := runs.Get(run.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != runModels.RunStatusSucceeded {
+			t.Errorf("full run %d status = %s, want %s", i, got.Status, runModels.RunStatusSucceeded)
+		}
+	}
+}
+
+func TestRunJobReleasesSkippedRuns(t *testing.T) {
+	a, runs, _ := newDeadLetterTestApp(t, 1)
+
+	lastGeneration := time.Now().Add(-time.Hour).UTC()
+	configuration := strapiModels.RepositoryConfiguration{ID: 1, LastGeneration: &lastGeneration}
+
+	// the schedule fires before anything was pushed since the last generation
+	scheduled, err := a.enqueueJob(runModels.RunTypeScheduled, runModels.RunTriggerSchedule, configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipping := func(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) error {
+		run.Status = runModels.RunStatusSkipped
+		return nil
+	}
+	if _, err := a.runJob(context.Background(), QueuedJob{RunID: scheduled.ID, Type: scheduled.Type, RepositoryConfiguration: configuration}, skipping); err != nil {
+		t.Fatalf("runJob() error = %v", err)
+	}
+
+	// commits are pushed and a generate is asked for over the same last generation
+	manual, err := a.enqueueJob(runModels.RunTypeScheduled, runModels.RunTriggerManual, configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	succeeding := func(ctx context.Context, job strapiModels.RepositoryConfiguration, run *runModels.Run) error {
+		return nil
+	}
+	if _, err := a.runJob(context.Background(), QueuedJob{RunID: manual.ID, Type: manual.Type, RepositoryConfiguration: configuration}, succeeding); err != nil {
+		t.Fatalf("runJob() error = %v", err)
+	}
+
+	got, err := runs.Get(manual.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != runModels.RunStatusSucceeded {
+		t.Errorf("manual run status = %s, want %s after a skipped scheduled run", got.Status, runModels.RunStatusSucceeded)
+	}
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-co-op/gocron"
+	"github.com/robfig/cron/v3"
+)
+
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// maxScheduleSteps bounds the generation times walked by Elapsed.
+const maxScheduleSteps = 10000
+
+const (
+	ScheduleUnitDays  = "days"
+	ScheduleUnitWeeks = "weeks"
+)
+
+// Schedule is a parsed RepositoryConfiguration.Cron, either the legacy "<n> days|weeks"
+// interval or a standard cron expression such as "CRON_TZ=Europe/London 0 16 * * FRI" or "@weekly".
+type Schedule struct {
+	Interval int
+	Unit     string
+	Cron     string
+}
+
+func ParseSchedule(expression string) (*Schedule, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return nil, fmt.Errorf("%w: cron is empty", ErrInvalidSchedule)
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) == 2 {
+		if number, err := strconv.Atoi(fields[0]); err == nil {
+			return parseIntervalSchedule(number, fields[1])
+		}
+	}
+
+	if _, err := cron.ParseStandard(expression); err != nil {
+		return nil, fmt.Errorf("%w: '%s' is not a valid cron expression or '<n> days|weeks' interval: %s", ErrInvalidSchedule, expression, err.Error())
+	}
+
+	return &Schedule{Cron: expression}, nil
+}
+
+func parseIntervalSchedule(number int, unit string) (*Schedule, error) {
+	if number < 1 {
+		return nil, fmt.Errorf("%w: interval must be at least 1, got %d", ErrInvalidSchedule, number)
+	}
+
+	switch strings.ToLower(unit) {
+	case "day", ScheduleUnitDays:
+		return &Schedule{Interval: number, Unit: ScheduleUnitDays}, nil
+	case "week", ScheduleUnitWeeks:
+		return &Schedule{Interval: number, Unit: ScheduleUnitWeeks}, nil
+	default:
+		return nil, fmt.Errorf("%w: invalid interval: %s", ErrInvalidSchedule, unit)
+	}
+}
+
+func (s *Schedule) IsCron() bool {
+	return s.Cron != ""
+}
+
+// Every starts a job definition on the scheduler for this schedule.
+func (s *Schedule) Every(scheduler *gocron.Scheduler) *gocron.Scheduler {
+	if s.IsCron() {
+		return scheduler.Cron(s.Cron)
+	}
+
+	switch s.Unit {
+	case ScheduleUnitWeeks:
+		return scheduler.Every(s.Interval).Weeks()
+	default:
+		return scheduler.Every(s.Interval).Days()
+	}
+}
+
+// Next returns the first generation time after t. A cron expression without a time zone is
+// read in UTC, as the scheduler runs it, whatever the location of t.
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.IsCron() {
+		schedule, err := cron.ParseStandard(withTimeZone(s.Cron))
+		if err != nil {
+			return time.Time{}
+		}
+		return schedule.Next(t)
+	}
+
+	if s.Unit == ScheduleUnitWeeks {
+		return t.AddDate(0, 0, 7*s.Interval)
+	}
+	return t.AddDate(0, 0, s.Interval)
+}
+
+// withTimeZone prefixes the cron expression with UTC unless it names its own time zone.
+func withTimeZone(expression string) string {
+	if strings.HasPrefix(expression, "CRON_TZ=") || strings.HasPrefix(expression, "TZ=") {
+		return expression
+	}
+	return "CRON_TZ=UTC " + expression
+}
+
+// Elapsed returns the generation times from first, included, that are not after now.
+func (s *Schedule) Elapsed(first time.Time, now time.Time) []time.Time {
+	var elapsed []time.Time
+	for t := first; !t.IsZero() && !t.After(now) && len(elapsed) < maxScheduleSteps; t = s.Next(t) {
+		elapsed = append(elapsed, t)
+	}
+	return elapsed
+}
+
+func (s *Schedule) String() string {
+	if s.IsCron() {
+		return s.Cron
+	}
+	return fmt.Sprintf("%d %s", s.Interval, s.Unit)
+}
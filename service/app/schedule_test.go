@@ -0,0 +1,173 @@
+package app
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       *Schedule
+		wantErr    bool
+	}{
+		{expression: "2 days", want: &Schedule{Interval: 2, Unit: ScheduleUnitDays}},
+		{expression: "1 day", want: &Schedule{Interval: 1, Unit: ScheduleUnitDays}},
+		{expression: " 4 Weeks ", want: &Schedule{Interval: 4, Unit: ScheduleUnitWeeks}},
+		{expression: "0 16 * * FRI", want: &Schedule{Cron: "0 16 * * FRI"}},
+		{expression: "@weekly", want: &Schedule{Cron: "@weekly"}},
+		{expression: "CRON_TZ=Europe/London 0 9 * * 1", want: &Schedule{Cron: "CRON_TZ=Europe/London 0 9 * * 1"}},
+		{expression: "", wantErr: true},
+		{expression: "0 days", wantErr: true},
+		{expression: "2 months", wantErr: true},
+		{expression: "every friday", wantErr: true},
+		{expression: "61 * * * *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got, err := ParseSchedule(tt.expression)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSchedule) {
+					t.Errorf("ParseSchedule() error = %v, want %v", err, ErrInvalidSchedule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSchedule() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSchedule() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleString(t *testing.T) {
+	for expression, want := range map[string]string{
+		"2 day":        "2 days",
+		"1 weeks":      "1 weeks",
+		"0 16 * * FRI": "0 16 * * FRI",
+	} {
+		schedule, err := ParseSchedule(expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := schedule.String(); got != want {
+			t.Errorf("ParseSchedule(%q).String() = %q, want %q", expression, got, want)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	from := time.Date(2026, 10, 16, 10, 30, 0, 0, time.UTC) // a Friday
+
+	tests := []struct {
+		expression string
+		want       time.Time
+	}{
+		{expression: "1 days", want: time.Date(2026, 10, 17, 10, 30, 0, 0, time.UTC)},
+		{expression: "3 days", want: time.Date(2026, 10, 19, 10, 30, 0, 0, time.UTC)},
+		{expression: "2 weeks", want: time.Date(2026, 10, 30, 10, 30, 0, 0, time.UTC)},
+		{expression: "0 16 * * FRI", want: time.Date(2026, 10, 16, 16, 0, 0, 0, time.UTC)},
+		{expression: "0 9 * * FRI", want: time.Date(2026, 10, 23, 9, 0, 0, 0, time.UTC)},
+		{expression: "@daily", want: time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := schedule.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", from, got, tt.want)
+			}
+		})
+	}
+
+	// the scheduler runs in UTC, a time in another location does not move the generation
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for expression, want := range map[string]time.Time{
+		"0 16 * * FRI":                       time.Date(2026, 10, 16, 16, 0, 0, 0, time.UTC),
+		"CRON_TZ=America/New_York 0 9 * * *": time.Date(2026, 10, 16, 13, 0, 0, 0, time.UTC),
+		"TZ=America/New_York 0 9 * * *":      time.Date(2026, 10, 16, 13, 0, 0, 0, time.UTC),
+	} {
+		schedule, err := ParseSchedule(expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := schedule.Next(from.In(newYork)); !got.Equal(want) {
+			t.Errorf("Next(%s) of %q = %s, want %s", from.In(newYork), expression, got, want.In(got.Location()))
+		}
+	}
+
+	// an expression that no longer parses has no next time
+	invalid := &Schedule{Cron: "61 * * * *"}
+	if got := invalid.Next(from); !got.IsZero() {
+		t.Errorf("Next() of an invalid expression = %s, want the zero time", got)
+	}
+}
+
+func TestScheduleElapsed(t *testing.T) {
+	first := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		expression string
+		now        time.Time
+		want       []time.Time
+	}{
+		{
+			name:       "interval",
+			expression: "2 days",
+			now:        time.Date(2026, 10, 5, 9, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				first,
+				time.Date(2026, 10, 3, 9, 0, 0, 0, time.UTC),
+				time.Date(2026, 10, 5, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:       "cron",
+			expression: "0 9 * * MON",
+			now:        time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				first,
+				time.Date(2026, 10, 5, 9, 0, 0, 0, time.UTC),
+				time.Date(2026, 10, 12, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:       "nothing missed",
+			expression: "1 weeks",
+			now:        first.Add(-time.Minute),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := schedule.Elapsed(first, tt.now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Elapsed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// a long outage of a frequent schedule is bounded
+	schedule, err := ParseSchedule("* * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := schedule.Elapsed(first, first.AddDate(1, 0, 0)); len(got) != maxScheduleSteps {
+		t.Errorf("Elapsed() = %d times, want %d", len(got), maxScheduleSteps)
+	}
+}
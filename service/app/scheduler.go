@@ -0,0 +1,206 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	strapi "github.com/TonyDMorris/quick-function/pkg/strapi/client"
+	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+	"github.com/go-co-op/gocron"
+)
+
+// Scheduler owns the gocron jobs of every repository configuration, keyed by configuration ID.
+type Scheduler struct {
+	cron         *gocron.Scheduler
+	strapiClient *strapi.Client
+	enqueue      func(id int)
+
+	mu   sync.Mutex
+	jobs map[int]*scheduledJob
+}
+
+type scheduledJob struct {
+	job  *gocron.Job
+	cron string
+}
+
+func NewScheduler(cron *gocron.Scheduler, strapiClient *strapi.Client, enqueue func(id int)) *Scheduler {
+	return &Scheduler{
+		cron:         cron,
+		strapiClient: strapiClient,
+		enqueue:      enqueue,
+		jobs:         make(map[int]*scheduledJob),
+	}
+}
+
+func (s *Scheduler) Start() {
+	s.cron.StartAsync()
+}
+
+// Stop stops scheduling new runs, jobs already enqueued are left to the workers.
+func (s *Scheduler) Stop() {
+	s.cron.Stop()
+}
+
+// Schedule registers a job for the repository configuration, replacing any existing job,
+// and persists the next generation time. Interval schedules resume from NextGeneration when it
+// is set, moved past now when it elapsed while the service was down, catching up on the missed
+// generations is left to the caller.
+func (s *Scheduler) Schedule(ctx context.Context, repositoryConfiguration strapiModels.RepositoryConfiguration) (*gocron.Job, error) {
+	schedule, err := ParseSchedule(repositoryConfiguration.Cron)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.unschedule(repositoryConfiguration.ID); err != nil {
+		return nil, err
+	}
+
+	scheduler := schedule.Every(s.cron).Tag(scheduleTag(repositoryConfiguration.ID))
+	if !schedule.IsCron() && repositoryConfiguration.NextGeneration != nil {
+		start := *repositoryConfiguration.NextGeneration
+		if elapsed := schedule.Elapsed(start, time.Now()); len(elapsed) > 0 {
+			start = schedule.Next(elapsed[len(elapsed)-1])
+		}
+		scheduler = scheduler.StartAt(start)
+	} else {
+		scheduler = scheduler.WaitForSchedule()
+	}
+
+	job, err := scheduler.Do(s.enqueue, repositoryConfiguration.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error scheduling job: %w", err)
+	}
+
+	s.jobs[repositoryConfiguration.ID] = &scheduledJob{job: job, cron: repositoryConfiguration.Cron}
+
+	nextRun := job.NextRun()
+	_, err = s.strapiClient.UpdateRepositoryConfigurationGenerations(ctx, repositoryConfiguration.ID, strapiModels.RepositoryConfigurationGenerations{NextGeneration: &nextRun})
+	if err != nil {
+		return nil, fmt.Errorf("error updating repository configuration: %w", err)
+	}
+
+	return job, nil
+}
+
+// Advance persists the generation following the one that fired at firedAt as NextGeneration,
+// so a restart does not take a generation that already ran for a missed one.
+func (s *Scheduler) Advance(ctx context.Context, id int, firedAt time.Time) error {
+	s.mu.Lock()
+	scheduled, ok := s.jobs[id]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	schedule, err := ParseSchedule(scheduled.cron)
+	if err != nil {
+		return err
+	}
+
+	nextGeneration := schedule.Next(firedAt)
+	_, err = s.strapiClient.UpdateRepositoryConfigurationGenerations(ctx, id, strapiModels.RepositoryConfigurationGenerations{NextGeneration: &nextGeneration})
+	if err != nil {
+		return fmt.Errorf("error updating repository configuration: %w", err)
+	}
+
+	return nil
+}
+
+// Reschedule replaces the job for the repository configuration when its cron has changed,
+// starting the new schedule from now. A configuration without a cron is unscheduled.
+func (s *Scheduler) Reschedule(ctx context.Context, repositoryConfiguration strapiModels.RepositoryConfiguration) (*gocron.Job, error) {
+	if repositoryConfiguration.Cron == "" {
+		return nil, s.Unschedule(repositoryConfiguration.ID)
+	}
+
+	s.mu.Lock()
+	existing, ok := s.jobs[repositoryConfiguration.ID]
+	s.mu.Unlock()
+
+	// our own next and last generation updates come back as update events, only a new cron needs a new job
+	if ok && existing.cron == repositoryConfiguration.Cron {
+		return existing.job, nil
+	}
+
+	repositoryConfiguration.NextGeneration = nil
+
+	return s.Schedule(ctx, repositoryConfiguration)
+}
+
+// Scheduled reports whether the repository configuration has a job.
+func (s *Scheduler) Scheduled(id int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.jobs[id]
+	return ok
+}
+
+// Cron returns the cron the repository configuration's job was scheduled with, if it has one.
+func (s *Scheduler) Cron(id int) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scheduled, ok := s.jobs[id]
+	if !ok {
+		return "", false
+	}
+	return scheduled.cron, true
+}
+
+// IDs returns the IDs of the scheduled repository configurations.
+func (s *Scheduler) IDs() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []int
+	for id := range s.jobs {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func (s *Scheduler) Unschedule(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.unschedule(id)
+}
+
+func (s *Scheduler) unschedule(id int) error {
+	if _, ok := s.jobs[id]; !ok {
+		return nil
+	}
+
+	delete(s.jobs, id)
+
+	if err := s.cron.RemoveByTag(scheduleTag(id)); err != nil {
+		return fmt.Errorf("error removing job: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Scheduler) Jobs() []*gocron.Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []*gocron.Job
+	for _, scheduled := range s.jobs {
+		jobs = append(jobs, scheduled.job)
+	}
+
+	return jobs
+}
+
+func scheduleTag(id int) string {
+	return fmt.Sprint(id)
+}
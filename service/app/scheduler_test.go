@@ -0,0 +1,405 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TonyDMorris/quick-function/pkg/lease"
+	"github.com/TonyDMorris/quick-function/pkg/queue"
+	runStore "github.com/TonyDMorris/quick-function/pkg/runs/store"
+	strapi "github.com/TonyDMorris/quick-function/pkg/strapi/client"
+	strapiModels "github.com/TonyDMorris/quick-function/pkg/strapi/models"
+	"github.com/gin-gonic/gin"
+	"github.com/go-co-op/gocron"
+	"github.com/google/go-github/v56/github"
+)
+
+// newTestScheduler schedules on a stopped gocron scheduler and counts the configuration
+// updates persisting the next generation.
+func newTestScheduler(t *testing.T) (*Scheduler, *gocron.Scheduler, func() int) {
+	t.Helper()
+
+	var mu sync.Mutex
+	updates := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		updates++
+		mu.Unlock()
+
+		// Strapi answers with the updated configuration
+		id, _ := strconv.Atoi(path.Base(r.URL.Path))
+		writeJSON(w, http.StatusOK, strapiModels.RepositoryConfiguration{ID: id})
+	}))
+	t.Cleanup(server.Close)
+
+	cron := gocron.NewScheduler(time.UTC)
+	scheduler := NewScheduler(cron, strapi.NewClient("test", server.URL), func(id int) {})
+
+	return scheduler, cron, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return updates
+	}
+}
+
+func TestSchedulerReschedule(t *testing.T) {
+	scheduler, cron, updates := newTestScheduler(t)
+
+	configuration := strapiModels.RepositoryConfiguration{ID: 1, Cron: "1 days"}
+	job, err := scheduler.Schedule(context.Background(), configuration)
+	if err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+	if updates() != 1 {
+		t.Errorf("updates = %d, want the next generation persisted once", updates())
+	}
+
+	// an update that leaves the cron alone, such as our own generation times, keeps the job
+	unchanged, err := scheduler.Reschedule(context.Background(), configuration)
+	if err != nil {
+		t.Fatalf("Reschedule() error = %v", err)
+	}
+	if unchanged != job || len(cron.Jobs()) != 1 {
+		t.Errorf("Reschedule() with the same cron replaced the job")
+	}
+
+	configuration.Cron = "0 9 * * 1"
+	replaced, err := scheduler.Reschedule(context.Background(), configuration)
+	if err != nil {
+		t.Fatalf("Reschedule() error = %v", err)
+	}
+	if replaced == job || len(cron.Jobs()) != 1 {
+		t.Errorf("jobs = %d, want the job replaced by one for the new cron", len(cron.Jobs()))
+	}
+	if jobs := cron.Jobs(); len(jobs) == 1 && jobs[0].Tags()[0] != "1" {
+		t.Errorf("job tags = %v, want the configuration ID", jobs[0].Tags())
+	}
+
+	// clearing the cron stops generating
+	configuration.Cron = ""
+	if _, err := scheduler.Reschedule(context.Background(), configuration); err != nil {
+		t.Fatalf("Reschedule() error = %v", err)
+	}
+	if jobs := cron.Jobs(); len(jobs) != 0 || len(scheduler.Jobs()) != 0 {
+		t.Errorf("jobs = %d, want none once the cron is cleared", len(jobs))
+	}
+}
+
+func TestSchedulerUnschedule(t *testing.T) {
+	scheduler, cron, _ := newTestScheduler(t)
+
+	for id := 1; id <= 2; id++ {
+		if _, err := scheduler.Schedule(context.Background(), strapiModels.RepositoryConfiguration{ID: id, Cron: "@weekly"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := scheduler.Unschedule(1); err != nil {
+		t.Fatalf("Unschedule() error = %v", err)
+	}
+	if jobs := cron.Jobs(); len(jobs) != 1 || jobs[0].Tags()[0] != "2" {
+		t.Errorf("jobs = %d, want only configuration 2 scheduled", len(jobs))
+	}
+
+	// unscheduling a configuration without a job is not an error
+	if err := scheduler.Unschedule(1); err != nil {
+		t.Errorf("Unschedule() of a missing job error = %v", err)
+	}
+}
+
+func TestSchedulerRejectsInvalidSchedules(t *testing.T) {
+	scheduler, cron, updates := newTestScheduler(t)
+
+	if _, err := scheduler.Schedule(context.Background(), strapiModels.RepositoryConfiguration{ID: 1, Cron: "2 months"}); err == nil {
+		t.Error("Schedule() error = nil, want an invalid schedule")
+	}
+	if len(cron.Jobs()) != 0 || updates() != 0 {
+		t.Errorf("jobs = %d and updates = %d, want nothing scheduled", len(cron.Jobs()), updates())
+	}
+}
+
+func TestScheduledRunsAdvanceNextGeneration(t *testing.T) {
+	ctx := context.Background()
+
+	lastGeneration := time.Now().Add(-7 * 24 * time.Hour).UTC()
+	configuration := testRepositoryConfiguration(1)
+	configuration.Cron = "0 9 * * 1"
+	configuration.LastGeneration = &lastGeneration
+	strapiAPI := newFakeStrapi(configuration)
+
+	a, _ := newTestApp(t, &fakeGitHub{}, strapiAPI)
+	if _, err := a.scheduler.Schedule(ctx, configuration); err != nil {
+		t.Fatal(err)
+	}
+
+	firedAt := time.Now()
+	a.enqueueScheduledRepositoryConfiguration(configuration.ID)
+
+	if jobs, err := a.jobQueue.List(queue.StatusQueued); err != nil || len(jobs) != 1 {
+		t.Fatalf("queued jobs = %d (%v), want 1", len(jobs), err)
+	}
+
+	// the first update is the schedule's, the second the run's
+	updates := strapiAPI.Updates(configuration.ID)
+	if len(updates) != 2 {
+		t.Fatalf("configuration updates = %d, want 2", len(updates))
+	}
+	assertGenerationUpdate(t, updates[1:], "next_generation")
+
+	nextGeneration, err := time.Parse(time.RFC3339, updates[1]["next_generation"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule, err := ParseSchedule(configuration.Cron)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := schedule.Next(firedAt); !nextGeneration.Equal(want) {
+		t.Errorf("next generation = %s, want %s", nextGeneration, want)
+	}
+
+	// a restart reads the advanced next generation and finds no generation missed
+	strapiAPI.configurations[0].NextGeneration = &nextGeneration
+	restarted, _ := newTestApp(t, &fakeGitHub{}, strapiAPI)
+	if err := restarted.loadSchedules(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := restarted.jobQueue.List(queue.StatusQueued); err != nil || len(jobs) != 0 {
+		t.Errorf("queued jobs after a restart = %d (%v), want none", len(jobs), err)
+	}
+}
+
+// newTestReplicas runs replicas of the app against one fake Strapi, sharing their leases as
+// replicas on a common volume do. Each keeps its own schedules, run store and queue.
+func newTestReplicas(t *testing.T, strapiAPI *fakeStrapi, count int) []*App {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	strapiServer := httptest.NewServer(strapiAPI)
+	t.Cleanup(strapiServer.Close)
+
+	locks := lease.NewFileLocker(filepath.Join(t.TempDir(), "leases.json"))
+
+	var replicas []*App
+	for i := 0; i < count; i++ {
+		runs, err := runStore.NewFileStore("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := NewApi(Config{
+			ReplicaID:     fmt.Sprintf("replica-%d", i),
+			StrapiWebhook: StrapiWebhookConfig{Secret: "secret"},
+		}, github.NewClient(nil), nil, strapi.NewClient("test", strapiServer.URL), runs, queue.NewMemoryQueue(queue.Options{}), locks)
+		a.setupRoutes()
+		replicas = append(replicas, a)
+	}
+
+	return replicas
+}
+
+// postRepositoryConfigurationWebhook delivers a Strapi webhook for the configuration to the replica.
+func postRepositoryConfigurationWebhook(t *testing.T, a *App, event string, configuration strapiModels.RepositoryConfiguration) {
+	t.Helper()
+
+	body, err := json.Marshal(strapiModels.StrapiWebhookPayload{
+		Event:     event,
+		Model:     "repository-configuration",
+		CreatedAt: time.Now(),
+		Entry:     configuration,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/repository-configuration", bytes.NewReader(body))
+	req.Header.Set("X-Strapi-Webhook-Secret", "secret")
+	recorder := httptest.NewRecorder()
+	a.server.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("%s status = %d, want %d: %s", event, recorder.Code, http.StatusOK, recorder.Body.String())
+	}
+}
+
+func TestSchedulesFollowWebhooksHandledByAnotherReplica(t *testing.T) {
+	ctx := context.Background()
+
+	configuration := testRepositoryConfiguration(1)
+	configuration.Cron = "1 days"
+	strapiAPI := newFakeStrapi()
+	replicas := newTestReplicas(t, strapiAPI, 2)
+	leader, follower := replicas[0], replicas[1]
+
+	if err := leader.leader.IsLeader(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cronOf := func(a *App) string {
+		cron, _ := a.scheduler.Cron(configuration.ID)
+		return cron
+	}
+
+	// created through the follower, the leader's next sync schedules it
+	strapiAPI.SetConfigurations(configuration)
+	postRepositoryConfigurationWebhook(t, follower, "entry.create", configuration)
+	if cronOf(leader) != "" {
+		t.Fatalf("leader scheduled %q before syncing", cronOf(leader))
+	}
+	if err := leader.loadSchedules(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if cronOf(leader) != "1 days" {
+		t.Errorf("leader cron = %q after the sync, want 1 days", cronOf(leader))
+	}
+
+	// updated through the follower, the leader's old job reschedules instead of generating
+	configuration.Cron = "0 9 * * 1"
+	strapiAPI.SetConfigurations(configuration)
+	postRepositoryConfigurationWebhook(t, follower, "entry.update", configuration)
+	leader.enqueueScheduledRepositoryConfiguration(configuration.ID)
+	if jobs, err := leader.jobQueue.List(queue.StatusQueued); err != nil || len(jobs) != 0 {
+		t.Errorf("leader queued jobs = %d (%v), want none on the old schedule", len(jobs), err)
+	}
+	if cronOf(leader) != "0 9 * * 1" {
+		t.Errorf("leader cron = %q after firing, want the new 0 9 * * 1", cronOf(leader))
+	}
+
+	// deleted through the follower, the leader's next sync unschedules it
+	strapiAPI.SetConfigurations()
+	postRepositoryConfigurationWebhook(t, follower, "entry.delete", configuration)
+	if err := leader.loadSchedules(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if leader.scheduler.Scheduled(configuration.ID) || follower.scheduler.Scheduled(configuration.ID) {
+		t.Errorf("scheduled = %v on the leader, %v on the follower, want neither", leader.scheduler.Scheduled(configuration.ID), follower.scheduler.Scheduled(configuration.ID))
+	}
+
+	// a deleted configuration whose job fires before a sync is unscheduled, though Strapi
+	// answers for it with a 200 and {success:false}
+	strapiAPI.SetConfigurations(configuration)
+	if _, err := leader.scheduler.Schedule(ctx, configuration); err != nil {
+		t.Fatal(err)
+	}
+	strapiAPI.SetConfigurations()
+	leader.enqueueScheduledRepositoryConfiguration(configuration.ID)
+	if leader.scheduler.Scheduled(configuration.ID) {
+		t.Error("leader kept the job of a deleted configuration")
+	}
+	if jobs, err := leader.jobQueue.List(queue.StatusQueued); err != nil || len(jobs) != 0 {
+		t.Errorf("leader queued jobs = %d (%v), want none for a deleted configuration", len(jobs), err)
+	}
+}
+
+func TestElectedReplicaSyncsSchedules(t *testing.T) {
+	ctx := context.Background()
+
+	configuration := testRepositoryConfiguration(1)
+	configuration.Cron = "1 days"
+	strapiAPI := newFakeStrapi()
+	replicas := newTestReplicas(t, strapiAPI, 2)
+	leader, follower := replicas[0], replicas[1]
+	follower.leader.OnElected = func() { follower.syncSchedules(true) }
+
+	if err := leader.leader.IsLeader(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// created through the leader, the follower has not synced yet
+	strapiAPI.SetConfigurations(configuration)
+	postRepositoryConfigurationWebhook(t, leader, "entry.create", configuration)
+	if follower.scheduler.Scheduled(configuration.ID) {
+		t.Fatal("follower scheduled the configuration before syncing")
+	}
+
+	// the leader hands over, the follower reloads the schedules once it is elected
+	if err := leader.locks.Release(ctx, leaderLeaseKey, leader.replicaID); err != nil {
+		t.Fatal(err)
+	}
+	if err := follower.leader.IsLeader(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !follower.scheduler.Scheduled(configuration.ID) {
+		if time.Now().After(deadline) {
+			t.Fatal("elected follower did not schedule the configuration")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestElectedReplicaCatchesUpOnScheduledConfigurations(t *testing.T) {
+	ctx := context.Background()
+
+	configuration := testRepositoryConfiguration(1)
+	configuration.Cron = "1 days"
+	strapiAPI := newFakeStrapi(configuration)
+	replicas := newTestReplicas(t, strapiAPI, 2)
+	leader, follower := replicas[0], replicas[1]
+
+	if err := leader.leader.IsLeader(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, replica := range replicas {
+		if err := replica.loadSchedules(ctx, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the leader stopped before its generation two days ago and nobody led until now
+	nextGeneration := time.Now().AddDate(0, 0, -2).UTC()
+	configuration.NextGeneration = &nextGeneration
+	strapiAPI.SetConfigurations(configuration)
+
+	// a sync while following leaves the catch-up to the leader
+	if err := follower.loadSchedules(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := follower.jobQueue.List(queue.StatusQueued); err != nil || len(jobs) != 0 {
+		t.Fatalf("follower queued jobs = %d (%v), want none before it is elected", len(jobs), err)
+	}
+
+	if err := leader.locks.Release(ctx, leaderLeaseKey, leader.replicaID); err != nil {
+		t.Fatal(err)
+	}
+	if err := follower.leader.IsLeader(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := follower.loadSchedules(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := follower.jobQueue.List(queue.StatusQueued)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("elected follower queued jobs = %d (%v), want one catch-up run", len(jobs), err)
+	}
+
+	// the next generation moves past the missed ones, another election catches up on nothing
+	updates := strapiAPI.Updates(configuration.ID)
+	advanced, err := time.Parse(time.RFC3339, updates[len(updates)-1]["next_generation"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !advanced.After(time.Now()) {
+		t.Fatalf("next generation = %s, want it moved past now", advanced)
+	}
+	configuration.NextGeneration = &advanced
+	strapiAPI.SetConfigurations(configuration)
+
+	if err := follower.loadSchedules(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := follower.jobQueue.List(queue.StatusQueued); err != nil || len(jobs) != 1 {
+		t.Errorf("queued jobs = %d (%v) after another election, want still one", len(jobs), err)
+	}
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/TonyDMorris/quick-function/pkg/logging"
+	"github.com/TonyDMorris/quick-function/pkg/selection"
+	"github.com/google/go-github/v56/github"
+)
+
+// maxTreeRequests bounds the GetTree calls made walking a truncated tree.
+const maxTreeRequests = 500
+
+// getTreeEntries returns the blobs of the tree at the SHA with paths from the repository root.
+// GitHub truncates large recursive trees, those are walked one level at a time, recursing into
+// each subtree and skipping directories that are vendored or outside the paths.
+func getTreeEntries(ctx context.Context, userClient *github.Client, owner string, repo string, sha string, paths []string) ([]*github.TreeEntry, error) {
+	walker := treeWalker{
+		ctx:        ctx,
+		userClient: userClient,
+		owner:      owner,
+		repo:       repo,
+		paths:      paths,
+	}
+
+	if err := walker.walk(sha, "", true); err != nil {
+		return nil, err
+	}
+
+	if walker.truncated {
+		logging.Logger.Warn(fmt.Sprintf("tree of %s/%s is still truncated after %d requests", owner, repo, maxTreeRequests))
+	}
+
+	return walker.entries, nil
+}
+
+type treeWalker struct {
+	ctx        context.Context
+	userClient *github.Client
+	owner      string
+	repo       string
+	paths      []string
+
+	requests  int
+	truncated bool
+	entries   []*github.TreeEntry
+}
+
+func (w *treeWalker) walk(sha string, prefix string, recursive bool) error {
+	if w.requests >= maxTreeRequests {
+		w.truncated = true
+		return nil
+	}
+	w.requests++
+
+	tree, _, err := w.userClient.Git.GetTree(w.ctx, w.owner, w.repo, sha, recursive)
+	if err != nil {
+		return fmt.Errorf("error getting tree: %w", err)
+	}
+
+	if recursive && tree.GetTruncated() {
+		if prefix == "" {
+			logging.Logger.Info(fmt.Sprintf("tree of %s/%s is truncated, walking it by directory", w.owner, w.repo))
+		}
+		return w.walk(sha, prefix, false)
+	}
+
+	for _, entry := range tree.Entries {
+		entryPath := entry.GetPath()
+		if prefix != "" {
+			entryPath = path.Join(prefix, entryPath)
+		}
+
+		switch entry.GetType() {
+		case "blob":
+			entry.Path = github.String(entryPath)
+			w.entries = append(w.entries, entry)
+		case "tree":
+			// a recursive listing already holds the subtrees' blobs
+			if recursive {
+				continue
+			}
+			if selection.Excluded(entryPath+"/") || !selection.MayContain(w.paths, entryPath) {
+				continue
+			}
+			if err := w.walk(entry.GetSHA(), entryPath, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
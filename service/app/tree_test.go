@@ -0,0 +1,170 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+)
+
+// fakeTrees serves trees by SHA, a recursive request for a tree in truncated is answered truncated.
+type fakeTrees struct {
+	trees     map[string][]*github.TreeEntry
+	truncated map[string]bool
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func (f *fakeTrees) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sha := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	recursive := r.URL.Query().Get("recursive") != ""
+
+	f.mu.Lock()
+	f.requests = append(f.requests, fmt.Sprintf("%s recursive=%t", sha, recursive))
+	f.mu.Unlock()
+
+	entries, ok := f.trees[sha]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if recursive && f.truncated[sha] {
+		writeJSON(w, http.StatusOK, github.Tree{SHA: github.String(sha), Entries: entries[:1], Truncated: github.Bool(true)})
+		return
+	}
+	writeJSON(w, http.StatusOK, github.Tree{SHA: github.String(sha), Entries: entries, Truncated: github.Bool(false)})
+}
+
+func newTreeClient(t *testing.T, trees *fakeTrees) *github.Client {
+	t.Helper()
+
+	server := httptest.NewServer(trees)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = baseURL
+
+	return client
+}
+
+func blobEntry(path string) *github.TreeEntry {
+	return &github.TreeEntry{Path: github.String(path), Type: github.String("blob"), Size: github.Int(10), SHA: github.String("blob-" + path)}
+}
+
+func treeEntry(path string, sha string) *github.TreeEntry {
+	return &github.TreeEntry{Path: github.String(path), Type: github.String("tree"), SHA: github.String(sha)}
+}
+
+func entryPaths(entries []*github.TreeEntry) []string {
+	var paths []string
+	for _, entry := range entries {
+		paths = append(paths, entry.GetPath())
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestGetTreeEntries(t *testing.T) {
+	trees := &fakeTrees{
+		trees: map[string][]*github.TreeEntry{
+			"root": {
+				blobEntry("go.mod"),
+				treeEntry("services", "services"),
+				treeEntry("vendor", "vendor"),
+				treeEntry("web", "web"),
+			},
+			// recursive listings hold the blobs of their subtrees with paths relative to the tree
+			"services": {
+				treeEntry("api", "api"),
+				blobEntry("api/main.go"),
+				blobEntry("api/handler.go"),
+			},
+			"vendor": {blobEntry("lib.go")},
+			"web":    {blobEntry("app.ts")},
+		},
+		truncated: map[string]bool{"root": true},
+	}
+
+	entries, err := getTreeEntries(context.Background(), newTreeClient(t, trees), testOwner, testRepo, "root", nil)
+	if err != nil {
+		t.Fatalf("getTreeEntries() error = %v", err)
+	}
+
+	// vendored directories are not walked
+	want := []string{"go.mod", "services/api/handler.go", "services/api/main.go", "web/app.ts"}
+	if got := entryPaths(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+
+	// directories that cannot match the paths are skipped too
+	trees.requests = nil
+	entries, err = getTreeEntries(context.Background(), newTreeClient(t, trees), testOwner, testRepo, "root", []string{"services/api"})
+	if err != nil {
+		t.Fatalf("getTreeEntries() error = %v", err)
+	}
+	if got, want := entryPaths(entries), []string{"go.mod", "services/api/handler.go", "services/api/main.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+	if want := []string{"root recursive=true", "root recursive=false", "services recursive=true"}; !reflect.DeepEqual(trees.requests, want) {
+		t.Errorf("requests = %v, want %v", trees.requests, want)
+	}
+}
+
+func TestGetTreeEntriesUntruncated(t *testing.T) {
+	trees := &fakeTrees{
+		trees: map[string][]*github.TreeEntry{
+			"root": {blobEntry("go.mod"), treeEntry("cmd", "cmd"), blobEntry("cmd/main.go")},
+		},
+	}
+
+	entries, err := getTreeEntries(context.Background(), newTreeClient(t, trees), testOwner, testRepo, "root", nil)
+	if err != nil {
+		t.Fatalf("getTreeEntries() error = %v", err)
+	}
+
+	if got, want := entryPaths(entries), []string{"cmd/main.go", "go.mod"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+	if len(trees.requests) != 1 {
+		t.Errorf("requests = %v, want a single recursive request", trees.requests)
+	}
+}
+
+func TestGetTreeEntriesRequestCap(t *testing.T) {
+	trees := &fakeTrees{
+		trees:     map[string][]*github.TreeEntry{"root": {blobEntry("go.mod")}},
+		truncated: map[string]bool{"root": true},
+	}
+	for i := 0; i < maxTreeRequests+100; i++ {
+		name := fmt.Sprintf("dir-%03d", i)
+		trees.trees["root"] = append(trees.trees["root"], treeEntry(name, name))
+		trees.trees[name] = []*github.TreeEntry{blobEntry("file.go")}
+	}
+
+	entries, err := getTreeEntries(context.Background(), newTreeClient(t, trees), testOwner, testRepo, "root", nil)
+	if err != nil {
+		t.Fatalf("getTreeEntries() error = %v", err)
+	}
+
+	// the truncated request and the listing count towards the cap, the files walked so far are kept
+	if len(trees.requests) != maxTreeRequests {
+		t.Errorf("requests = %d, want %d", len(trees.requests), maxTreeRequests)
+	}
+	if want := 1 + maxTreeRequests - 2; len(entries) != want {
+		t.Errorf("entries = %d, want %d", len(entries), want)
+	}
+}